@@ -1,9 +1,11 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"github.com/ryanbressler/CloudForest"
+	"github.com/ryanbressler/CloudForest/metrics"
 	"log"
 	"os"
 	"strings"
@@ -13,11 +15,31 @@ func main() {
 	fm := flag.String("fm",
 		"featurematrix.afm", "AFM formated feature matrix containing data.")
 	rf := flag.String("rfpred",
-		"rface.sf", "A predictor forest.")
+		"rface.sf", "A predictor forest in .sf or binary format.")
 	predfn := flag.String("preds",
 		"", "The name of a file to write the predictions into.")
 	votefn := flag.String("votes",
 		"", "The name of a file to write categorical vote totals to.")
+	shapfn := flag.String("shap",
+		"", "The name of a file to write per case TreeSHAP feature contributions to.")
+	shapref := flag.String("shapref",
+		"", "AFM formated feature matrix to derive node covers from for -shap if the forest has none. Defaults to -fm.")
+	anomalyfn := flag.String("anomaly",
+		"", "The name of a file to write per case anomaly scores from an isolation forest to.")
+	metricnames := flag.String("metrics",
+		"", "Comma separated metrics to report if the data contains the target (auc,prauc,logloss,brier,mcc,kappa,accuracy,confusion or mae,rmse,mape,r2,quantile[:q]).")
+	positive := flag.String("positive",
+		"", "Positive class for auc, prauc and brier metrics. Classes are averaged if empty.")
+	pdfeatures := flag.String("pd",
+		"", "Comma separated list of one or two features to calculate partial dependence on.")
+	pdfn := flag.String("pdfile",
+		"partialdependence.tsv", "The name of a file to write partial dependence to.")
+	scikitfn := flag.String("scikit",
+		"", "The name of a file to write the forest to as scikit-learn style json with node values, counts and impurities from -fm.")
+	var pdgrid int
+	flag.IntVar(&pdgrid, "pdgrid", 20, "Number of grid points for numerical features in partial dependence.")
+	var ice bool
+	flag.BoolVar(&ice, "ice", false, "Also write individual conditional expectation curves for each case with -pd.")
 	var num bool
 	flag.BoolVar(&num, "mean", false, "Force numeric (mean) voting.")
 	var sum bool
@@ -26,24 +48,52 @@ func main() {
 	flag.BoolVar(&expit, "expit", false, "Expit (inverst logit) transform data (for gradient boosting classification).")
 	var cat bool
 	flag.BoolVar(&cat, "mode", false, "Force categorical (mode) voting.")
+	configfn := flag.String("config",
+		"", "A json or yaml (.yaml or .yml) file of option names and values. Options given on the command line override it.")
+	dumpconfig := flag.String("dumpconfig",
+		"", "Write the resolved configuration as json to this file (- for stdout) and exit.")
 
 	flag.Parse()
 
+	if *configfn != "" {
+		config, err := CloudForest.LoadConfig(*configfn)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err = CloudForest.ApplyConfig(flag.CommandLine, config); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *dumpconfig != "" {
+		w := os.Stdout
+		if *dumpconfig != "-" {
+			f, err := os.Create(*dumpconfig)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer f.Close()
+			w = f
+		}
+		if err := CloudForest.WriteConfig(w, flag.CommandLine, nil, "config", "dumpconfig"); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	//Parse Data
 	data, err := CloudForest.LoadAFM(*fm)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	forestfile, err := os.Open(*rf) // For read access.
+	forest, err := CloudForest.LoadForest(*rf)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer forestfile.Close()
-	forestreader := CloudForest.NewForestReader(forestfile)
-	forest, err := forestreader.ReadForest()
-	if err != nil {
-		log.Fatal(err)
+
+	if *anomalyfn != "" {
+		writeAnomalyScores(*anomalyfn, data, forest)
+		return
 	}
 
 	var predfile *os.File
@@ -76,6 +126,13 @@ func main() {
 		fmt.Printf("Target is %v in feature %v\n", forest.Target, targeti)
 		er := bb.TallyError(data.Data[targeti])
 		fmt.Printf("Error: %v\n", er)
+		if *metricnames != "" {
+			results, err := metrics.EvaluateVotes(*metricnames, bb, data.Data[targeti], forest.Intercept, *positive)
+			if err != nil {
+				log.Fatal(err)
+			}
+			metrics.WriteResults(os.Stdout, "METRIC", results)
+		}
 	}
 	if *predfn != "" {
 		fmt.Printf("Outputting label predicted actual tsv to %v\n", *predfn)
@@ -106,6 +163,18 @@ func main() {
 		}
 	}
 
+	if *shapfn != "" {
+		writeSHAP(*shapfn, *shapref, data, forest, bb, sum)
+	}
+
+	if *pdfeatures != "" {
+		writePartialDependence(*pdfn, strings.Split(*pdfeatures, ","), pdgrid, ice, data, forest, bb, sum)
+	}
+
+	if *scikitfn != "" {
+		writeScikit(*scikitfn, data, forest, sum)
+	}
+
 	//Not thread safe code!
 	if *votefn != "" {
 		fmt.Printf("Outputting vote totals to %v\n", *votefn)
@@ -137,3 +206,189 @@ func main() {
 		}
 	}
 }
+
+//writeSHAP writes a tsv with a row for each case (and class for classification) giving the expected
+//value and the contribution of each feature used in the forest.
+func writeSHAP(shapfn string, shapref string, data *CloudForest.FeatureMatrix, forest *CloudForest.Forest, bb CloudForest.VoteTallyer, sum bool) {
+	used := make([]bool, len(data.Data))
+	needCovers := false
+	for _, tree := range forest.Trees {
+		if tree.Root.Cover == 0 {
+			needCovers = true
+		}
+		tree.Root.Climb(func(n *CloudForest.Node) {
+			//only the first feature of an oblique split is attributed (see Tree.SHAP)
+			if n.Splitter != nil {
+				if i, ok := data.Map[n.Splitter.UsedFeatures()[0]]; ok {
+					used[i] = true
+				}
+			}
+		})
+	}
+
+	if needCovers {
+		ref := data
+		if shapref != "" {
+			var err error
+			ref, err = CloudForest.LoadAFM(shapref)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		fmt.Println("Forest has no node covers, deriving them for TreeSHAP from reference data.")
+		cases := make([]int, 0, ref.Data[0].Length())
+		for i := 0; i < ref.Data[0].Length(); i++ {
+			cases = append(cases, i)
+		}
+		for _, tree := range forest.Trees {
+			tree.SetCovers(ref, cases)
+		}
+	}
+
+	classes := []string{""}
+	if cbb, ok := bb.(*CloudForest.CatBallotBox); ok {
+		classes = cbb.CatMap.Back
+	}
+
+	fmt.Printf("Outputting TreeSHAP feature contributions to %v\n", shapfn)
+	shapfile, err := os.Create(shapfn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer shapfile.Close()
+
+	fmt.Fprint(shapfile, "Case")
+	if classes[0] != "" {
+		fmt.Fprint(shapfile, "\tClass")
+	}
+	fmt.Fprint(shapfile, "\tExpected")
+	for i, f := range data.Data {
+		if used[i] {
+			fmt.Fprintf(shapfile, "\t%v", f.GetName())
+		}
+	}
+	fmt.Fprint(shapfile, "\n")
+
+	for c, l := range data.CaseLabels {
+		for _, class := range classes {
+			phi, expected := forest.SHAP(data, c, class, sum)
+			fmt.Fprint(shapfile, l)
+			if class != "" {
+				fmt.Fprintf(shapfile, "\t%v", class)
+			}
+			fmt.Fprintf(shapfile, "\t%v", expected)
+			for i, v := range phi {
+				if used[i] {
+					fmt.Fprintf(shapfile, "\t%v", v)
+				}
+			}
+			fmt.Fprint(shapfile, "\n")
+		}
+	}
+}
+
+//writePartialDependence writes a tidy tsv of partial dependence and, optionally, individual
+//conditional expectation curves.
+func writePartialDependence(pdfn string, features []string, pdgrid int, ice bool, data *CloudForest.FeatureMatrix, forest *CloudForest.Forest, bb CloudForest.VoteTallyer, sum bool) {
+	grid := make([][]string, 0, len(features))
+	for _, feature := range features {
+		g, err := data.DependenceGrid(feature, pdgrid)
+		if err != nil {
+			log.Fatal(err)
+		}
+		grid = append(grid, g)
+	}
+
+	var classes []string
+	if cbb, ok := bb.(*CloudForest.CatBallotBox); ok {
+		classes = cbb.CatMap.Back
+	}
+
+	fmt.Printf("Calculating partial dependence on %v\n", strings.Join(features, ", "))
+	points, err := forest.PartialDependence(data, features, grid, classes, sum)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("Outputting partial dependence to %v\n", pdfn)
+	pdfile, err := os.Create(pdfn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer pdfile.Close()
+
+	fmt.Fprint(pdfile, "Type\tCase")
+	for _, feature := range features {
+		fmt.Fprintf(pdfile, "\t%v", feature)
+	}
+	if classes != nil {
+		fmt.Fprint(pdfile, "\tClass")
+	}
+	fmt.Fprint(pdfile, "\tPrediction\n")
+
+	write := func(curvetype string, label string, values []string, class string, pred float64) {
+		fmt.Fprintf(pdfile, "%v\t%v\t%v", curvetype, label, strings.Join(values, "\t"))
+		if classes != nil {
+			fmt.Fprintf(pdfile, "\t%v", class)
+		}
+		fmt.Fprintf(pdfile, "\t%v\n", pred)
+	}
+
+	for _, p := range points {
+		for k, pd := range p.PD {
+			class := ""
+			if classes != nil {
+				class = classes[k]
+			}
+			write("PD", ".", p.Values, class, pd)
+			if ice {
+				for c, pred := range p.ICE[k] {
+					write("ICE", data.CaseLabels[c], p.Values, class, pred)
+				}
+			}
+		}
+	}
+}
+
+//writeAnomalyScores writes the mean path length and anomaly score of each case in an isolation
+//forest.
+func writeAnomalyScores(fn string, data *CloudForest.FeatureMatrix, forest *CloudForest.Forest) {
+	fmt.Printf("Outputting anomaly scores to %v\n", fn)
+	scores, depths := forest.AnomalyScores(data)
+	anomalyfile, err := os.Create(fn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer anomalyfile.Close()
+	fmt.Fprintln(anomalyfile, "Case\tPathLength\tScore")
+	for i, l := range data.CaseLabels {
+		fmt.Fprintf(anomalyfile, "%v\t%v\t%v\n", l, depths[i], scores[i])
+	}
+}
+
+//writeScikit converts the forest with node statistics from every case of data and writes it as json.
+func writeScikit(fn string, data *CloudForest.FeatureMatrix, forest *CloudForest.Forest, sum bool) {
+	//Boosted trees don't predict the target so their values come from their predictions.
+	var target CloudForest.Feature
+	if targeti, ok := data.Map[forest.Target]; ok && !sum && forest.Intercept == 0.0 {
+		target = data.Data[targeti]
+	}
+	cases := make([]int, 0, data.Data[0].Length())
+	for i := 0; i < data.Data[0].Length(); i++ {
+		cases = append(cases, i)
+	}
+	sf, err := CloudForest.BuildScikitForest(forest, data, target, cases)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("Outputting scikit-learn style forest to %v\n", fn)
+	file, err := os.Create(fn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
+	if err = json.NewEncoder(file).Encode(sf); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,526 @@
+package CloudForest
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//BinaryForestMagic starts each forest in the binary format and BinaryForestVersion is the
+//version of the format written by BinaryForestWriter.
+const (
+	BinaryForestMagic   = "CFBF"
+	BinaryForestVersion = 1
+)
+
+//Flags describing the fields present on each node of a binary forest.
+const (
+	binSplitter = 1 << iota
+	binLeft
+	binRight
+	binMissing
+	binNumPred
+	binStrPred
+	binCover
+	binSurrogates
+	binMissingLeft
+)
+
+//Kinds of splitters in a binary forest.
+const (
+	binNumerical = iota
+	binCategorical
+	binOblique
+)
+
+//maxBinaryCount bounds the lengths read from a binary forest so corrupt files fail instead of
+//allocating huge slices.
+const maxBinaryCount = 1 << 28
+
+/*
+BinaryForestWriter saves forests in a compact binary format that is much faster to load than
+.sf. Each forest starts with a header of BinaryForestMagic and the format version (a uvarint)
+followed by:
+
+	target, intercept and metadata (as .sf METADATA lines)
+	a table of the features used by splitters each with the categories used in its splits
+	a table of predictions that aren't numbers
+	the trees as their target, weight, node count and nodes in pre order
+
+Strings are a uvarint length followed by bytes, floats are 8 little endian bytes and counts and
+indexes are uvarints. Each node starts with uvarint flags giving the fields present which are
+written in the order of the flags. Categorical splitters store the categories sent left as a
+bitset over the feature's category table. Like .sf files, binary forests can be concatenated.
+*/
+type BinaryForestWriter struct {
+	w   *bufio.Writer
+	err error
+
+	features  map[string]int
+	names     []string
+	levels    [][]string
+	levelis   []map[string]int
+	preds     map[string]int
+	predtable []string
+}
+
+//NewBinaryForestWriter returns a BinaryForestWriter writing to w.
+func NewBinaryForestWriter(w io.Writer) *BinaryForestWriter {
+	return &BinaryForestWriter{w: bufio.NewWriter(w)}
+}
+
+func (bw *BinaryForestWriter) uvarint(v uint64) {
+	if bw.err == nil {
+		var buf [binary.MaxVarintLen64]byte
+		_, bw.err = bw.w.Write(buf[:binary.PutUvarint(buf[:], v)])
+	}
+}
+
+func (bw *BinaryForestWriter) float(v float64) {
+	if bw.err == nil {
+		var buf [8]byte
+		binary.LittleEndian.PutUint64(buf[:], math.Float64bits(v))
+		_, bw.err = bw.w.Write(buf[:])
+	}
+}
+
+func (bw *BinaryForestWriter) str(s string) {
+	bw.uvarint(uint64(len(s)))
+	if bw.err == nil {
+		_, bw.err = bw.w.WriteString(s)
+	}
+}
+
+//numericPred returns the value of a prediction and true if it is a number that will be
+//formatted back to the same string.
+func numericPred(pred string) (float64, bool) {
+	v, err := strconv.ParseFloat(pred, 64)
+	return v, err == nil && fmt.Sprintf("%v", v) == pred
+}
+
+//addFeature returns the index of the named feature in the feature table adding it if needed.
+func (bw *BinaryForestWriter) addFeature(name string) int {
+	fi, ok := bw.features[name]
+	if !ok {
+		fi = len(bw.names)
+		bw.features[name] = fi
+		bw.names = append(bw.names, name)
+		bw.levels = append(bw.levels, nil)
+		bw.levelis = append(bw.levelis, make(map[string]int))
+	}
+	return fi
+}
+
+//addSplitter adds the features and categories used by s to the tables.
+func (bw *BinaryForestWriter) addSplitter(s *Splitter) {
+	if s.IsOblique() {
+		for _, f := range s.Features {
+			bw.addFeature(f)
+		}
+		return
+	}
+	fi := bw.addFeature(s.Feature)
+	if s.Numerical {
+		return
+	}
+	cats := make([]string, 0, len(s.Left))
+	for cat := range s.Left {
+		cats = append(cats, cat)
+	}
+	sort.Strings(cats)
+	for _, cat := range cats {
+		if _, ok := bw.levelis[fi][cat]; !ok {
+			bw.levelis[fi][cat] = len(bw.levels[fi])
+			bw.levels[fi] = append(bw.levels[fi], cat)
+		}
+	}
+}
+
+//WriteForest writes a forest including its header, tables and any metadata.
+func (bw *BinaryForestWriter) WriteForest(forest *Forest) error {
+	bw.features = make(map[string]int)
+	bw.names, bw.levels, bw.levelis = nil, nil, nil
+	bw.preds = make(map[string]int)
+	bw.predtable = nil
+	for _, tree := range forest.Trees {
+		tree.Root.Climb(func(n *Node) {
+			if _, ok := numericPred(n.Pred); !ok && n.Pred != "" {
+				if _, ok := bw.preds[n.Pred]; !ok {
+					bw.preds[n.Pred] = len(bw.predtable)
+					bw.predtable = append(bw.predtable, n.Pred)
+				}
+			}
+			if n.Splitter != nil {
+				bw.addSplitter(n.Splitter)
+			}
+			for _, s := range n.Surrogates {
+				bw.addSplitter(s.Splitter)
+			}
+		})
+	}
+
+	_, bw.err = bw.w.WriteString(BinaryForestMagic)
+	bw.uvarint(BinaryForestVersion)
+	bw.str(forest.Target)
+	bw.float(forest.Intercept)
+	metadata := ""
+	if forest.Metadata != nil {
+		lines, err := forest.Metadata.Lines()
+		if err != nil {
+			return err
+		}
+		metadata = strings.Join(lines, "\n")
+	}
+	bw.str(metadata)
+
+	bw.uvarint(uint64(len(bw.names)))
+	for fi, name := range bw.names {
+		bw.str(name)
+		bw.uvarint(uint64(len(bw.levels[fi])))
+		for _, level := range bw.levels[fi] {
+			bw.str(level)
+		}
+	}
+	bw.uvarint(uint64(len(bw.predtable)))
+	for _, pred := range bw.predtable {
+		bw.str(pred)
+	}
+
+	bw.uvarint(uint64(len(forest.Trees)))
+	for _, tree := range forest.Trees {
+		bw.str(tree.Target)
+		bw.float(tree.Weight)
+		nodes := 0
+		tree.Root.Climb(func(*Node) { nodes++ })
+		bw.uvarint(uint64(nodes))
+		bw.writeNode(tree.Root)
+	}
+
+	if bw.err == nil {
+		bw.err = bw.w.Flush()
+	}
+	return bw.err
+}
+
+//writeNode writes n and its children in pre order.
+func (bw *BinaryForestWriter) writeNode(n *Node) {
+	flags := 0
+	numpred, isnum := numericPred(n.Pred)
+	switch {
+	case isnum:
+		flags |= binNumPred
+	case n.Pred != "":
+		flags |= binStrPred
+	}
+	if n.Cover != 0.0 {
+		flags |= binCover
+	}
+	if n.Left != nil {
+		flags |= binLeft
+	}
+	if n.Right != nil {
+		flags |= binRight
+	}
+	if n.Missing != nil {
+		flags |= binMissing
+	}
+	if n.Splitter != nil {
+		flags |= binSplitter
+		if n.Surrogates != nil {
+			flags |= binSurrogates
+		}
+		if n.MissingLeft {
+			flags |= binMissingLeft
+		}
+	}
+	bw.uvarint(uint64(flags))
+	if flags&binNumPred != 0 {
+		bw.float(numpred)
+	}
+	if flags&binStrPred != 0 {
+		bw.uvarint(uint64(bw.preds[n.Pred]))
+	}
+	if flags&binCover != 0 {
+		bw.float(n.Cover)
+	}
+	if flags&binSplitter != 0 {
+		bw.writeSplitter(n.Splitter)
+	}
+	if flags&binSurrogates != 0 {
+		bw.uvarint(uint64(len(n.Surrogates)))
+		for _, s := range n.Surrogates {
+			bw.writeSplitter(s.Splitter)
+			reversed := uint64(0)
+			if s.Reversed {
+				reversed = 1
+			}
+			bw.uvarint(reversed)
+		}
+	}
+	for _, child := range []*Node{n.Left, n.Right, n.Missing} {
+		if child != nil {
+			bw.writeNode(child)
+		}
+	}
+}
+
+//writeSplitter writes the kind, feature indexes and split of s.
+func (bw *BinaryForestWriter) writeSplitter(s *Splitter) {
+	switch {
+	case s.IsOblique():
+		bw.uvarint(binOblique)
+		bw.uvarint(uint64(len(s.Features)))
+		for _, f := range s.Features {
+			bw.uvarint(uint64(bw.features[f]))
+		}
+		for _, w := range s.Weights {
+			bw.float(w)
+		}
+		bw.float(s.Value)
+	case s.Numerical:
+		bw.uvarint(binNumerical)
+		bw.uvarint(uint64(bw.features[s.Feature]))
+		bw.float(s.Value)
+	default:
+		fi := bw.features[s.Feature]
+		bw.uvarint(binCategorical)
+		bw.uvarint(uint64(fi))
+		bits := make([]byte, (len(bw.levels[fi])+7)/8)
+		for cat := range s.Left {
+			j := bw.levelis[fi][cat]
+			bits[j/8] |= 1 << uint(j%8)
+		}
+		bw.str(string(bits))
+	}
+}
+
+/*
+BinaryForestReader reads forests written by BinaryForestWriter. ReadForest returns io.EOF once
+there are no more forests.
+*/
+type BinaryForestReader struct {
+	br  *bufio.Reader
+	err error
+
+	names     []string
+	levels    [][]string
+	predtable []string
+}
+
+//NewBinaryForestReader wraps the supplied io.Reader as a BinaryForestReader.
+func NewBinaryForestReader(r io.Reader) *BinaryForestReader {
+	return &BinaryForestReader{br: bufio.NewReader(r)}
+}
+
+func (br *BinaryForestReader) uvarint() (v uint64) {
+	if br.err == nil {
+		v, br.err = binary.ReadUvarint(br.br)
+	}
+	return
+}
+
+//count reads a uvarint length or index and checks that it is less than max.
+func (br *BinaryForestReader) count(max int) int {
+	v := br.uvarint()
+	if br.err == nil && v >= uint64(max) {
+		br.err = errors.New("Poorly formed binary forest: count or index out of range.")
+	}
+	if br.err != nil {
+		return 0
+	}
+	return int(v)
+}
+
+func (br *BinaryForestReader) float() float64 {
+	var buf [8]byte
+	if br.err == nil {
+		_, br.err = io.ReadFull(br.br, buf[:])
+	}
+	return math.Float64frombits(binary.LittleEndian.Uint64(buf[:]))
+}
+
+func (br *BinaryForestReader) str() string {
+	buf := make([]byte, br.count(maxBinaryCount))
+	if br.err == nil {
+		_, br.err = io.ReadFull(br.br, buf)
+	}
+	return string(buf)
+}
+
+//ReadForest reads the next forest.
+func (br *BinaryForestReader) ReadForest() (forest *Forest, err error) {
+	magic := make([]byte, len(BinaryForestMagic))
+	if _, err = io.ReadFull(br.br, magic); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = errors.New("Binary forest header not found.")
+		}
+		return
+	}
+	if string(magic) != BinaryForestMagic {
+		return nil, errors.New("Binary forest header not found.")
+	}
+	br.err = nil
+	if version := br.uvarint(); br.err == nil && version > BinaryForestVersion {
+		return nil, fmt.Errorf("Binary forest version %v is newer than the supported version %v.", version, BinaryForestVersion)
+	}
+
+	forest = new(Forest)
+	forest.Target = br.str()
+	forest.Intercept = br.float()
+	if metadata := br.str(); metadata != "" {
+		forest.Metadata = new(ForestMetadata)
+		for _, line := range strings.Split(metadata, "\n") {
+			if e := forest.Metadata.ParseLine(line); e != nil {
+				return nil, e
+			}
+		}
+	}
+
+	nFeatures := br.count(maxBinaryCount)
+	br.names = make([]string, nFeatures)
+	br.levels = make([][]string, nFeatures)
+	for fi := 0; fi < nFeatures && br.err == nil; fi++ {
+		br.names[fi] = br.str()
+		br.levels[fi] = make([]string, br.count(maxBinaryCount))
+		for j := range br.levels[fi] {
+			br.levels[fi][j] = br.str()
+		}
+	}
+	br.predtable = make([]string, br.count(maxBinaryCount))
+	for i := range br.predtable {
+		br.predtable[i] = br.str()
+	}
+
+	nTrees := br.count(maxBinaryCount)
+	forest.Trees = make([]*Tree, 0, nTrees)
+	for i := 0; i < nTrees && br.err == nil; i++ {
+		tree := &Tree{nil, br.str(), br.float()}
+		nodes := br.count(maxBinaryCount)
+		tree.Root = br.readNode()
+		read := 0
+		tree.Root.Climb(func(*Node) { read++ })
+		if br.err == nil && read != nodes {
+			br.err = fmt.Errorf("Tree %v has %v nodes not %v.", i, read, nodes)
+		}
+		forest.Trees = append(forest.Trees, tree)
+	}
+	if br.err == io.EOF {
+		br.err = io.ErrUnexpectedEOF
+	}
+	if br.err != nil {
+		return nil, br.err
+	}
+	return
+}
+
+//readNode reads a node and its children.
+func (br *BinaryForestReader) readNode() *Node {
+	n := new(Node)
+	flags := br.uvarint()
+	if flags&binNumPred != 0 {
+		n.Pred = fmt.Sprintf("%v", br.float())
+	}
+	if flags&binStrPred != 0 {
+		if i := br.count(len(br.predtable)); br.err == nil {
+			n.Pred = br.predtable[i]
+		}
+	}
+	if flags&binCover != 0 {
+		n.Cover = br.float()
+	}
+	if flags&binSplitter != 0 {
+		n.Splitter = br.readSplitter()
+		n.MissingLeft = flags&binMissingLeft != 0
+	}
+	if flags&binSurrogates != 0 {
+		n.Surrogates = make([]*Surrogate, br.count(maxBinaryCount))
+		for i := range n.Surrogates {
+			n.Surrogates[i] = &Surrogate{br.readSplitter(), br.uvarint() == 1, 0.0}
+		}
+	}
+	if flags&binLeft != 0 && br.err == nil {
+		n.Left = br.readNode()
+	}
+	if flags&binRight != 0 && br.err == nil {
+		n.Right = br.readNode()
+	}
+	if flags&binMissing != 0 && br.err == nil {
+		n.Missing = br.readNode()
+	}
+	return n
+}
+
+//feature reads the index of a feature in the feature table.
+func (br *BinaryForestReader) feature() int {
+	fi := br.count(len(br.names))
+	if br.err == nil {
+		return fi
+	}
+	return -1
+}
+
+//name returns the name of feature fi or "" after an error.
+func (br *BinaryForestReader) name(fi int) string {
+	if fi < 0 {
+		return ""
+	}
+	return br.names[fi]
+}
+
+//readSplitter reads a splitter written by BinaryForestWriter.writeSplitter.
+func (br *BinaryForestReader) readSplitter() *Splitter {
+	switch kind := br.uvarint(); {
+	case br.err != nil:
+		return new(Splitter)
+	case kind == binOblique:
+		features := make([]string, br.count(len(br.names)+1))
+		for i := range features {
+			features[i] = br.name(br.feature())
+		}
+		weights := make([]float64, len(features))
+		for i := range weights {
+			weights[i] = br.float()
+		}
+		return NewObliqueSplitter(features, weights, br.float())
+	case kind == binNumerical:
+		return &Splitter{br.name(br.feature()), true, br.float(), nil, nil, nil}
+	case kind == binCategorical:
+		fi := br.feature()
+		bits := br.str()
+		left := make(map[string]bool)
+		if fi >= 0 {
+			for j, level := range br.levels[fi] {
+				if j/8 < len(bits) && bits[j/8]&(1<<uint(j%8)) != 0 {
+					left[level] = true
+				}
+			}
+		}
+		return &Splitter{br.name(fi), false, 0.0, left, nil, nil}
+	}
+	br.err = errors.New("Poorly formed binary forest: unknown splitter type.")
+	return new(Splitter)
+}
+
+/*
+LoadForest reads the first forest from a file in either the .sf or binary format detecting the
+format from the header.
+*/
+func LoadForest(fn string) (forest *Forest, err error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	if magic, _ := r.Peek(len(BinaryForestMagic)); string(magic) == BinaryForestMagic {
+		return NewBinaryForestReader(r).ReadForest()
+	}
+	return NewForestReader(r).ReadForest()
+}
@@ -0,0 +1,254 @@
+package CloudForest
+
+import (
+	"math"
+)
+
+/*
+ConditionalPermutationImportance adds the conditional permutation importance of Strobl et al.
+("Conditional variable importance for random forests") for a single tree to imp.
+
+It is calculated as in PermutationImportance except that each feature is only permuted within
+the cells of the grid defined by the tree's splits on the features it is associated with,
+which are listed by index in conditioning[feature] (see FeatureMatrix.ConditioningFeatures).
+This preserves the relationship between a feature and the features it is correlated with so
+that, unlike marginal permutation importance, a feature that is only important because it is
+correlated with an important feature gets a low score.
+*/
+func (t *Tree) ConditionalPermutationImportance(fm *FeatureMatrix,
+	target Feature,
+	oob []int,
+	candidates []int,
+	conditioning [][]int,
+	allocs *BestSplitAllocs,
+	imp *[]*RunningMean,
+	classImp []*[]*RunningMean) {
+	t.permutationImportance(fm, target, oob, candidates, conditioning, allocs, imp, classImp)
+}
+
+//conditioningCells groups the cases by which side of each of the tree's splits on the
+//specified features they fall on.
+func (t *Tree) conditioningCells(fm *FeatureMatrix, cases []int, features []int) (cells [][]int) {
+	conditional := make(map[string]bool, len(features))
+	for _, i := range features {
+		conditional[fm.Data[i].GetName()] = true
+	}
+	splitters := make([]*Splitter, 0)
+	t.Root.Climb(func(n *Node) {
+		if n.Splitter == nil {
+			return
+		}
+		for _, name := range n.Splitter.UsedFeatures() {
+			if conditional[name] {
+				splitters = append(splitters, n.Splitter)
+				break
+			}
+		}
+	})
+	if len(splitters) == 0 {
+		return [][]int{cases}
+	}
+
+	cellis := make(map[string]int)
+	key := make([]byte, len(splitters))
+	for _, c := range cases {
+		for k, s := range splitters {
+			left, ok := s.GoesLeft(fm, c)
+			switch {
+			case !ok:
+				key[k] = 'M'
+			case left:
+				key[k] = 'L'
+			default:
+				key[k] = 'R'
+			}
+		}
+		ci, ok := cellis[string(key)]
+		if !ok {
+			ci = len(cells)
+			cellis[string(key)] = ci
+			cells = append(cells, make([]int, 0))
+		}
+		cells[ci] = append(cells[ci], c)
+	}
+	return
+}
+
+/*
+Association returns a measure of association between 0 and 1 of features i and j calculated
+over the cases where both are present. It is the absolute value of Pearson's correlation for
+two numerical features, the correlation ratio for a numerical and a categorical feature and
+Cramer's V for two categorical features.
+*/
+func (fm *FeatureMatrix) Association(i int, j int) (a float64) {
+	fi := fm.Data[i]
+	fj := fm.Data[j]
+	if fi.NCats() == 0 && fj.NCats() != 0 {
+		fi, fj = fj, fi
+	}
+
+	cases := make([]int, 0, fi.Length())
+	for c := 0; c < fi.Length(); c++ {
+		if !fi.IsMissing(c) && !fj.IsMissing(c) {
+			cases = append(cases, c)
+		}
+	}
+	n := float64(len(cases))
+	if n < 2 {
+		return
+	}
+
+	switch {
+	case fi.NCats() == 0:
+		//pearson correlation
+		x := fi.(NumFeature)
+		y := fj.(NumFeature)
+		mx := x.Mean(&cases)
+		my := y.Mean(&cases)
+		var sxy, sxx, syy float64
+		for _, c := range cases {
+			dx := x.Get(c) - mx
+			dy := y.Get(c) - my
+			sxy += dx * dy
+			sxx += dx * dx
+			syy += dy * dy
+		}
+		if sxx > 0 && syy > 0 {
+			a = math.Abs(sxy / math.Sqrt(sxx*syy))
+		}
+	case fj.NCats() == 0:
+		//correlation ratio
+		x := fi.(CatFeature)
+		y := fj.(NumFeature)
+		my := y.Mean(&cases)
+		sums := make([]float64, x.NCats())
+		counts := make([]float64, x.NCats())
+		total := 0.0
+		for _, c := range cases {
+			v := y.Get(c)
+			sums[x.Geti(c)] += v
+			counts[x.Geti(c)]++
+			total += (v - my) * (v - my)
+		}
+		between := 0.0
+		for k, count := range counts {
+			if count > 0 {
+				d := sums[k]/count - my
+				between += count * d * d
+			}
+		}
+		if total > 0 {
+			a = math.Sqrt(between / total)
+		}
+	default:
+		//cramer's v
+		x := fi.(CatFeature)
+		y := fj.(CatFeature)
+		table := make([][]float64, x.NCats())
+		for k := range table {
+			table[k] = make([]float64, y.NCats())
+		}
+		rows := make([]float64, x.NCats())
+		cols := make([]float64, y.NCats())
+		for _, c := range cases {
+			table[x.Geti(c)][y.Geti(c)]++
+			rows[x.Geti(c)]++
+			cols[y.Geti(c)]++
+		}
+		nrows, ncols := 0, 0
+		for _, r := range rows {
+			if r > 0 {
+				nrows++
+			}
+		}
+		for _, c := range cols {
+			if c > 0 {
+				ncols++
+			}
+		}
+		k := nrows
+		if ncols < k {
+			k = ncols
+		}
+		if k < 2 {
+			return
+		}
+		chi2 := 0.0
+		for r, row := range table {
+			for c, o := range row {
+				if e := rows[r] * cols[c] / n; e > 0 {
+					chi2 += (o - e) * (o - e) / e
+				}
+			}
+		}
+		a = math.Sqrt(chi2 / (n * float64(k-1)))
+	}
+	return
+}
+
+/*
+ConditioningFeatures returns, for each of the candidate features, the indexes of the other
+features marked in use with an Association of at least threshold. Features that aren't in use
+can't define any cells so associations are only calculated between features in use.
+*/
+func (fm *FeatureMatrix) ConditioningFeatures(candidates []int, used []bool, threshold float64) (conditioning [][]int) {
+	conditioning = make([][]int, len(fm.Data))
+	for _, i := range candidates {
+		if !used[i] {
+			continue
+		}
+		for j, u := range used {
+			if u && j != i && fm.Association(i, j) >= threshold {
+				conditioning[i] = append(conditioning[i], j)
+			}
+		}
+	}
+	return
+}
+
+/*
+ConditionalPermutationImportance returns the conditional permutation importance (see
+Tree.ConditionalPermutationImportance) of the candidate features averaged over the trees in
+the forest. Features are conditioned on all other features used in the forest with an Association
+of at least threshold.
+
+oob should contain the out of bag cases for each tree. If it is nil all cases in fm are used
+which is appropriate if fm contains cases that weren't used to grow the forest.
+*/
+func (f *Forest) ConditionalPermutationImportance(fm *FeatureMatrix,
+	target Feature,
+	oob [][]int,
+	candidates []int,
+	threshold float64) (imp *[]*RunningMean) {
+
+	used := make([]bool, len(fm.Data))
+	for _, t := range f.Trees {
+		t.Root.Climb(func(n *Node) {
+			if n.Splitter != nil {
+				for _, name := range n.Splitter.UsedFeatures() {
+					used[fm.Map[name]] = true
+				}
+			}
+		})
+	}
+	conditioning := fm.ConditioningFeatures(candidates, used, threshold)
+
+	var allcases []int
+	if oob == nil {
+		allcases = make([]int, 0, target.Length())
+		for i := 0; i < target.Length(); i++ {
+			allcases = append(allcases, i)
+		}
+	}
+
+	imp = NewRunningMeans(len(fm.Data))
+	allocs := NewBestSplitAllocs(0, target)
+	for i, t := range f.Trees {
+		cases := allcases
+		if oob != nil {
+			cases = oob[i]
+		}
+		t.ConditionalPermutationImportance(fm, target, cases, candidates, conditioning, allocs, imp, nil)
+	}
+	return
+}
@@ -0,0 +1,229 @@
+package CloudForest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+LoadConfig reads a config file giving values for command line flags by name. It is parsed as
+yaml if the file name ends in .yaml or .yml and as a json object otherwise. Values may be strings,
+numbers or booleans (nulls are ignored). Objects (like the category to cost map of growforest
+-cost) are converted back to json strings.
+
+Only the simple yaml needed for flat configs is understood: "name: value" lines, comments, quoted
+strings, flow maps like "{a: 1, b: 2}" and maps given as indented "key: value" lines under a
+"name:" line.
+*/
+func LoadConfig(fn string) (config map[string]string, err error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	if strings.HasSuffix(fn, ".yaml") || strings.HasSuffix(fn, ".yml") {
+		return ParseYAMLConfig(f)
+	}
+	return ParseJSONConfig(f)
+}
+
+//ParseJSONConfig parses a json object of flag names and values as LoadConfig does.
+func ParseJSONConfig(r io.Reader) (config map[string]string, err error) {
+	raw := make(map[string]json.RawMessage)
+	if err = json.NewDecoder(r).Decode(&raw); err != nil {
+		return
+	}
+	config = make(map[string]string, len(raw))
+	for name, value := range raw {
+		if string(bytes.TrimSpace(value)) == "null" {
+			continue
+		}
+		var s string
+		if json.Unmarshal(value, &s) == nil {
+			config[name] = s
+			continue
+		}
+		var compact bytes.Buffer
+		if err = json.Compact(&compact, value); err != nil {
+			return nil, err
+		}
+		config[name] = compact.String()
+	}
+	return
+}
+
+//ParseYAMLConfig parses a simple yaml config of flag names and values as LoadConfig does.
+func ParseYAMLConfig(r io.Reader) (config map[string]string, err error) {
+	config = make(map[string]string)
+	var mapname string
+	var mapped map[string]interface{}
+	endMap := func() {
+		if mapname != "" {
+			encoded, _ := json.Marshal(mapped)
+			config[mapname] = string(encoded)
+			mapname = ""
+		}
+	}
+
+	scanner := bufio.NewScanner(r)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := stripYAMLComment(scanner.Text())
+		if strings.TrimSpace(line) == "" || strings.TrimSpace(line) == "---" {
+			continue
+		}
+		indented := line[0] == ' ' || line[0] == '\t'
+		i := strings.Index(line, ":")
+		if i < 0 {
+			return nil, fmt.Errorf("Line %v of config isn't name: value.", lineno)
+		}
+		name := unquoteYAML(strings.TrimSpace(line[:i]))
+		value := strings.TrimSpace(line[i+1:])
+
+		switch {
+		case indented && mapname != "":
+			mapped[name] = yamlScalar(value)
+		case indented:
+			return nil, fmt.Errorf("Unexpected indentation on line %v of config.", lineno)
+		case value == "":
+			endMap()
+			mapname = name
+			mapped = make(map[string]interface{})
+		default:
+			endMap()
+			if strings.HasPrefix(value, "{") && strings.HasSuffix(value, "}") {
+				flow := make(map[string]interface{})
+				for _, pair := range strings.Split(value[1:len(value)-1], ",") {
+					if strings.TrimSpace(pair) == "" {
+						continue
+					}
+					j := strings.Index(pair, ":")
+					if j < 0 {
+						return nil, fmt.Errorf("Line %v of config has an invalid map.", lineno)
+					}
+					flow[unquoteYAML(strings.TrimSpace(pair[:j]))] = yamlScalar(strings.TrimSpace(pair[j+1:]))
+				}
+				encoded, _ := json.Marshal(flow)
+				config[name] = string(encoded)
+			} else {
+				config[name] = unquoteYAML(value)
+			}
+		}
+	}
+	endMap()
+	return config, scanner.Err()
+}
+
+//stripYAMLComment removes a # comment that isn't inside quotes from a line.
+func stripYAMLComment(line string) string {
+	var quote rune
+	for i, c := range line {
+		switch {
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return strings.TrimRight(line[:i], " \t")
+		}
+	}
+	return strings.TrimRight(line, " \t")
+}
+
+//unquoteYAML removes the quotes around a quoted yaml string.
+func unquoteYAML(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		if s[0] == '"' {
+			if unquoted, err := strconv.Unquote(s); err == nil {
+				return unquoted
+			}
+		}
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+//yamlScalar returns a yaml map value as a number, boolean or string for json encoding.
+func yamlScalar(s string) interface{} {
+	if len(s) > 0 && s[0] != '"' && s[0] != '\'' {
+		if v, err := strconv.ParseFloat(s, 64); err == nil {
+			return v
+		}
+		if v, err := strconv.ParseBool(s); err == nil {
+			return v
+		}
+	}
+	return unquoteYAML(s)
+}
+
+/*
+ApplyConfig sets the flags in fs to the values in config except for flags that were set on the
+command line so they override the config. fs should already be parsed. Names in ignore (like the
+options of another utility that don't apply) are skipped. It returns an error for other names
+that aren't flags or values that the flag can't parse.
+*/
+func ApplyConfig(fs *flag.FlagSet, config map[string]string, ignore ...string) error {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	names := make([]string, 0, len(config))
+	for name := range config {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range ignore {
+		set[name] = true
+	}
+	for _, name := range names {
+		if set[name] {
+			continue
+		}
+		if fs.Lookup(name) == nil {
+			return fmt.Errorf("Unknown option %v in config.", name)
+		}
+		if err := fs.Set(name, config[name]); err != nil {
+			return fmt.Errorf("Invalid value %v for %v in config: %v", config[name], name, err)
+		}
+	}
+	return nil
+}
+
+/*
+ConfigValues returns the value of every flag in fs not named in skip by name. Values in resolved
+(such as parameters inferred from the data) replace the values of the flags with the same names.
+*/
+func ConfigValues(fs *flag.FlagSet, resolved map[string]interface{}, skip ...string) map[string]interface{} {
+	config := make(map[string]interface{})
+	fs.VisitAll(func(f *flag.Flag) {
+		if getter, ok := f.Value.(flag.Getter); ok {
+			config[f.Name] = getter.Get()
+		} else {
+			config[f.Name] = f.Value.String()
+		}
+	})
+	for name, value := range resolved {
+		config[name] = value
+	}
+	for _, name := range skip {
+		delete(config, name)
+	}
+	return config
+}
+
+//WriteConfig writes the ConfigValues of fs as a json config readable by LoadConfig.
+func WriteConfig(w io.Writer, fs *flag.FlagSet, resolved map[string]interface{}, skip ...string) error {
+	encoded, err := json.MarshalIndent(ConfigValues(fs, resolved, skip...), "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", encoded)
+	return err
+}
@@ -0,0 +1,71 @@
+package CloudForest
+
+import (
+	"bytes"
+	"flag"
+	"strings"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	jsonconfig, err := ParseJSONConfig(strings.NewReader(`{"nTrees": 50, "mTry": ".5", "nobag": true, "blockRE": null, "cost": {"a": 2}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	yamlconfig, err := ParseYAMLConfig(strings.NewReader("# growforest options\nnTrees: 50\nmTry: \".5\" # half\nnobag: true\ncost:\n  a: 2\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, config := range []map[string]string{jsonconfig, yamlconfig} {
+		if len(config) != 4 || config["nTrees"] != "50" || config["mTry"] != ".5" || config["nobag"] != "true" || config["cost"] != `{"a":2}` {
+			t.Errorf("Config parsed as %v.", config)
+		}
+	}
+	flow, err := ParseYAMLConfig(strings.NewReader("cost: {a: 2}\n"))
+	if err != nil || flow["cost"] != `{"a":2}` {
+		t.Errorf("Flow map parsed as %v with error %v.", flow, err)
+	}
+	if _, err := ParseYAMLConfig(strings.NewReader("nTrees 50\n")); err == nil {
+		t.Error("Invalid yaml line parsed.")
+	}
+}
+
+func TestApplyAndWriteConfig(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	nTrees := fs.Int("nTrees", 100, "")
+	mTry := fs.String("mTry", "0", "")
+	nobag := fs.Bool("nobag", false, "")
+	fs.Int("leafSize", 0, "")
+	fs.String("config", "", "")
+	if err := fs.Parse([]string{"-nTrees", "10"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ApplyConfig(fs, map[string]string{"nTrees": "50", "mTry": ".5", "nobag": "true"}); err != nil {
+		t.Fatal(err)
+	}
+	if *nTrees != 10 || *mTry != ".5" || !*nobag {
+		t.Errorf("Applied config gave nTrees %v mTry %v nobag %v.", *nTrees, *mTry, *nobag)
+	}
+	if err := ApplyConfig(fs, map[string]string{"nTree": "50"}); err == nil {
+		t.Error("Unknown option applied.")
+	}
+	if err := ApplyConfig(fs, map[string]string{"nTree": "50"}, "nTree"); err != nil {
+		t.Errorf("Ignored option gave %v.", err)
+	}
+	if err := ApplyConfig(fs, map[string]string{"leafSize": "many"}); err == nil {
+		t.Error("Invalid value applied.")
+	}
+
+	var buf bytes.Buffer
+	if err := WriteConfig(&buf, fs, map[string]interface{}{"mTry": "3"}, "config"); err != nil {
+		t.Fatal(err)
+	}
+	config, err := ParseJSONConfig(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config) != 4 || config["nTrees"] != "10" || config["mTry"] != "3" || config["nobag"] != "true" {
+		t.Errorf("Written config was %v.", config)
+	}
+}
@@ -0,0 +1,258 @@
+package CloudForest
+
+import (
+	"errors"
+	"github.com/ryanbressler/CloudForest/sortby"
+	"math/rand"
+	"sync"
+)
+
+/*
+Subset returns a feature matrix holding the listed cases of fm in order. Categorical features
+share their CatMap with fm so categories keep the same codes. Features other than DenseNumFeature
+and DenseCatFeature are rebuilt from their string values as one of them.
+*/
+func (fm *FeatureMatrix) Subset(cases []int) *FeatureMatrix {
+	sub := &FeatureMatrix{make([]Feature, 0, len(fm.Data)), make(map[string]int, len(fm.Data)), make([]string, 0, len(cases))}
+	for _, f := range fm.Data {
+		var subf Feature
+		switch f := f.(type) {
+		case *DenseNumFeature:
+			numf := &DenseNumFeature{make([]float64, 0, len(cases)), make([]bool, 0, len(cases)), f.Name, false}
+			for _, c := range cases {
+				numf.NumData = append(numf.NumData, f.NumData[c])
+				numf.Missing = append(numf.Missing, f.Missing[c])
+				numf.HasMissing = numf.HasMissing || f.Missing[c]
+			}
+			subf = numf
+		case *DenseCatFeature:
+			catf := &DenseCatFeature{f.CatMap, make([]int, 0, len(cases)), make([]bool, 0, len(cases)), f.Name, f.RandomSearch, false}
+			for _, c := range cases {
+				catf.CatData = append(catf.CatData, f.CatData[c])
+				catf.Missing = append(catf.Missing, f.Missing[c])
+				catf.HasMissing = catf.HasMissing || f.Missing[c]
+			}
+			subf = catf
+		default:
+			if f.NCats() == 0 {
+				subf = &DenseNumFeature{make([]float64, 0, len(cases)), make([]bool, 0, len(cases)), f.GetName(), false}
+			} else {
+				subf = &DenseCatFeature{&CatMap{make(map[string]int), make([]string, 0)}, make([]int, 0, len(cases)), make([]bool, 0, len(cases)), f.GetName(), false, false}
+			}
+			for _, c := range cases {
+				subf.Append(f.GetStr(c))
+			}
+		}
+		sub.Map[subf.GetName()] = len(sub.Data)
+		sub.Data = append(sub.Data, subf)
+	}
+	for _, c := range cases {
+		sub.CaseLabels = append(sub.CaseLabels, fm.CaseLabels[c])
+	}
+	return sub
+}
+
+/*
+StratifiedFolds randomly divides the cases that aren't missing target into nFolds folds of
+(nearly) equal size and returns the cases in each. If target is categorical the cases of each
+class are dealt out separately so each fold has roughly the same class balance.
+*/
+func StratifiedFolds(target Feature, nFolds int) (folds [][]int) {
+	strata := make(map[int][]int)
+	catf, categorical := target.(CatFeature)
+	for i := 0; i < target.Length(); i++ {
+		if target.IsMissing(i) {
+			continue
+		}
+		stratum := 0
+		if categorical {
+			stratum = catf.Geti(i)
+		}
+		strata[stratum] = append(strata[stratum], i)
+	}
+
+	folds = make([][]int, nFolds)
+	next := rand.Intn(nFolds)
+	for stratum := 0; stratum <= target.NCats(); stratum++ {
+		cases := strata[stratum]
+		for _, j := range rand.Perm(len(cases)) {
+			folds[next] = append(folds[next], cases[j])
+			next = (next + 1) % nFolds
+		}
+	}
+	return
+}
+
+//NonMissingCases returns the cases that aren't missing f.
+func NonMissingCases(f Feature) (cases []int) {
+	cases = make([]int, 0, f.Length())
+	for i := 0; i < f.Length(); i++ {
+		if !f.IsMissing(i) {
+			cases = append(cases, i)
+		}
+	}
+	return
+}
+
+/*
+GroupedFolds divides cases into nFolds folds so that all cases sharing a value of group (such as
+repeated measures of a patient) are in the same fold and returns the cases in each. Cases missing
+group are each their own group. Groups are assigned largest first (ties in random order) to the
+fold with the fewest cases so folds are as even as the groups allow.
+*/
+func GroupedFolds(group Feature, cases []int, nFolds int) (folds [][]int) {
+	groupi := make(map[string]int)
+	groups := make([][]int, 0)
+	for _, c := range cases {
+		if group.IsMissing(c) {
+			groups = append(groups, []int{c})
+			continue
+		}
+		i, ok := groupi[group.GetStr(c)]
+		if !ok {
+			i = len(groups)
+			groupi[group.GetStr(c)] = i
+			groups = append(groups, make([]int, 0, 1))
+		}
+		groups[i] = append(groups[i], c)
+	}
+
+	order := make([]int, 0, len(groups))
+	sizes := make([]float64, 0, len(groups))
+	for _, i := range rand.Perm(len(groups)) {
+		order = append(order, i)
+		sizes = append(sizes, -float64(len(groups[i])))
+	}
+	sortby.SortBy(&order, &sizes)
+
+	folds = make([][]int, nFolds)
+	for _, i := range order {
+		smallest := 0
+		for j := range folds {
+			if len(folds[j]) < len(folds[smallest]) {
+				smallest = j
+			}
+		}
+		folds[smallest] = append(folds[smallest], groups[i]...)
+	}
+	return
+}
+
+/*
+TimeSeriesFolds returns nFolds forward chaining folds of the cases not missing the numerical
+feature order. The cases are sorted by order and divided into nFolds+1 consecutive blocks of
+(nearly) equal size with cases of equal order kept in the same block. Fold k tests on block k+1
+and trains on all earlier blocks so no fold is trained on cases after those it is tested on.
+*/
+func TimeSeriesFolds(order Feature, cases []int, nFolds int) (folds []*CVFold, err error) {
+	nf, ok := order.(NumFeature)
+	if !ok {
+		return nil, errors.New("Time series folds need a numerical ordering feature.")
+	}
+	sorted := make([]int, 0, len(cases))
+	vals := make([]float64, 0, len(cases))
+	for _, c := range cases {
+		if !nf.IsMissing(c) {
+			sorted = append(sorted, c)
+			vals = append(vals, nf.Get(c))
+		}
+	}
+	if len(sorted) < nFolds+1 {
+		return nil, errors.New("Too few cases for the number of time series folds.")
+	}
+	sortby.SortBy(&sorted, &vals)
+
+	//Block b starts at starts[b] moved forward past cases tied with the previous one.
+	starts := make([]int, nFolds+2)
+	for b := 1; b <= nFolds; b++ {
+		start := b * len(sorted) / (nFolds + 1)
+		if start < starts[b-1] {
+			start = starts[b-1]
+		}
+		for start > 0 && start < len(sorted) && vals[start] == vals[start-1] {
+			start++
+		}
+		starts[b] = start
+	}
+	starts[nFolds+1] = len(sorted)
+
+	folds = make([]*CVFold, 0, nFolds)
+	for b := 1; b <= nFolds; b++ {
+		if starts[b] >= starts[b+1] {
+			return nil, errors.New("Too many ties in the ordering feature for the number of time series folds.")
+		}
+		train := append([]int(nil), sorted[:starts[b]]...)
+		test := append([]int(nil), sorted[starts[b]:starts[b+1]]...)
+		folds = append(folds, &CVFold{Test: test, Train: train})
+	}
+	return
+}
+
+//CVFold holds a fold of a cross validation: the cases held out for testing, the cases to train
+//on, the forest grown on them and its votes on the test cases (which are indexed by their
+//position in Test).
+type CVFold struct {
+	Test     []int
+	Train    []int
+	TestData *FeatureMatrix
+	Forest   *Forest
+	Votes    VoteTallyer
+	Err      error
+}
+
+//NewCVFolds returns a fold for each set of test cases trained on the rest of the nCases cases.
+func NewCVFolds(tests [][]int, nCases int) (folds []*CVFold) {
+	folds = make([]*CVFold, 0, len(tests))
+	for _, test := range tests {
+		intest := make([]bool, nCases)
+		for _, c := range test {
+			intest[c] = true
+		}
+		train := make([]int, 0, nCases-len(test))
+		for c := 0; c < nCases; c++ {
+			if !intest[c] {
+				train = append(train, c)
+			}
+		}
+		folds = append(folds, &CVFold{Test: test, Train: train})
+	}
+	return
+}
+
+/*
+CrossValidate grows a forest to predict the named target on the Train cases of each fold with
+GrowForest and has it vote on the Test cases. Each forest is grown on a Subset of fm so boosting
+targets never see the test cases. Up to nCores folds are run in parallel.
+
+The TestData, Forest, Votes and Err of each fold are set. Votes are in a ballot box from
+GrowOptions.NewBallotBox so gradient boosting predictions need the forest's Intercept added.
+*/
+func CrossValidate(fm *FeatureMatrix, targetname string, folds []*CVFold, opts *GrowOptions, nCores int) {
+	if nCores < 1 {
+		nCores = 1
+	}
+	var wg sync.WaitGroup
+	todo := make(chan *CVFold, len(folds))
+	for _, fold := range folds {
+		todo <- fold
+	}
+	close(todo)
+	for core := 0; core < nCores; core++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for fold := range todo {
+				fold.Forest, fold.Err = opts.GrowForest(fm.Subset(fold.Train), targetname)
+				if fold.Err != nil {
+					continue
+				}
+				fold.TestData = fm.Subset(fold.Test)
+				fold.Votes = opts.NewBallotBox(fold.TestData.Data[fold.TestData.Map[targetname]], len(fold.Test))
+				for _, tree := range fold.Forest.Trees {
+					tree.Vote(fold.TestData, fold.Votes)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
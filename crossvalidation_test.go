@@ -0,0 +1,185 @@
+package CloudForest
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestSubset(t *testing.T) {
+	fm := ParseAFM(strings.NewReader(".\ta\tb\tc\td\nN:x\t1\tNA\t3\t4\nC:y\tu\tv\tu\tw\n"))
+	sub := fm.Subset([]int{3, 1})
+	if strings.Join(sub.CaseLabels, ",") != "d,b" || sub.Data[0].Length() != 2 {
+		t.Fatalf("Subset had cases %v.", sub.CaseLabels)
+	}
+	x, y := sub.Data[sub.Map["N:x"]], sub.Data[sub.Map["C:y"]]
+	if x.GetStr(0) != "4" || !x.IsMissing(1) || !x.MissingVals() {
+		t.Errorf("Numerical subset was %v %v.", x.GetStr(0), x.GetStr(1))
+	}
+	if y.GetStr(0) != "w" || y.GetStr(1) != "v" || y.(CatFeature).Geti(0) != fm.Data[1].(CatFeature).Geti(3) {
+		t.Errorf("Categorical subset was %v %v.", y.GetStr(0), y.GetStr(1))
+	}
+}
+
+func TestGrowOptionsData(t *testing.T) {
+	fm := ParseAFM(strings.NewReader(".\ta\tb\tc\td\nC:y\tu\tv\tu\tv\nN:x\t1\tNA\t3\t4\nN:noise\t1\t2\t3\t4\n"))
+	opts := NewGrowOptions()
+	opts.Blacklist = []string{"N:x"}
+	if candidates, err := opts.Candidates(fm, 0); err != nil || len(candidates) != 1 || candidates[0] != 2 {
+		t.Errorf("Blacklisted candidates were %v.", candidates)
+	}
+
+	opts.Impute = true
+	opts.ShuffleRE = "noise"
+	work, err := opts.workingData(fm, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if work.Data[0] != fm.Data[0] || work.Data[1].MissingVals() || !fm.Data[1].MissingVals() || work.Data[2] == fm.Data[2] {
+		t.Error("Imputed and shuffled features weren't copies of the originals.")
+	}
+}
+
+func TestCrossValidate(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	ncases := 120
+	fm := syntheticAFM(rnd, ncases, []string{"C:y", "N:x", "N:noise"}, func(i int, rnd *rand.Rand) []interface{} {
+		x := rnd.Float64()
+		y := "a"
+		if x > 0.5 {
+			y = "b"
+		}
+		if i%10 == 0 {
+			y = "NA"
+		}
+		return []interface{}{y, x, rnd.Float64()}
+	})
+	target := fm.Data[0].(CatFeature)
+
+	classTotals := make(map[string]int)
+	nLabeled := 0
+	for c := 0; c < ncases; c++ {
+		if !target.IsMissing(c) {
+			classTotals[target.GetStr(c)]++
+			nLabeled++
+		}
+	}
+
+	tests := StratifiedFolds(target, 4)
+	seen := make(map[int]bool)
+	for _, test := range tests {
+		counts := make(map[string]int)
+		for _, c := range test {
+			if seen[c] || target.IsMissing(c) {
+				t.Errorf("Case %v repeated or missing the target.", c)
+			}
+			seen[c] = true
+			counts[target.GetStr(c)]++
+		}
+		for class, n := range counts {
+			expected := len(test) * classTotals[class] / nLabeled
+			if n < expected-1 || n > expected+1 {
+				t.Errorf("Fold with %v cases had %v of class %v.", len(test), n, class)
+			}
+		}
+	}
+	if len(seen) != ncases-ncases/10 {
+		t.Errorf("Folds held %v cases not %v.", len(seen), ncases-ncases/10)
+	}
+
+	opts := NewGrowOptions()
+	opts.NTrees = 20
+	folds := NewCVFolds(tests, ncases)
+	CrossValidate(fm, "C:y", folds, opts, 2)
+	for i, fold := range folds {
+		if fold.Err != nil {
+			t.Fatal(fold.Err)
+		}
+		if len(fold.Train)+len(fold.Test) != ncases || len(fold.Forest.Trees) != 20 {
+			t.Errorf("Fold %v had %v training cases and %v trees.", i, len(fold.Train), len(fold.Forest.Trees))
+		}
+		testtarget := fold.TestData.Data[fold.TestData.Map["C:y"]]
+		if e := fold.Votes.TallyError(testtarget); e > 0.2 {
+			t.Errorf("Fold %v had error %v.", i, e)
+		}
+	}
+
+	opts.GradBoost = 0.1
+	folds = NewCVFolds(StratifiedFolds(fm.Data[1], 3), ncases)
+	CrossValidate(fm, "N:x", folds, opts, 1)
+	if folds[0].Err != nil || folds[0].Forest.Intercept == 0.0 {
+		t.Errorf("Gradient boosting fold had error %v and intercept %v.", folds[0].Err, folds[0].Forest.Intercept)
+	}
+	if _, ok := folds[0].Votes.(*SumBallotBox); !ok {
+		t.Error("Gradient boosting fold wasn't voted into a SumBallotBox.")
+	}
+
+	//Gradient boosting classification folds are scored as probabilities of the positive class.
+	opts.Positive = "b"
+	folds = NewCVFolds(tests, ncases)
+	CrossValidate(fm, "C:y", folds, opts, 2)
+	for i, fold := range folds {
+		if fold.Err != nil {
+			t.Fatal(fold.Err)
+		}
+		testtarget := fold.TestData.Data[fold.TestData.Map["C:y"]]
+		wrong := 0
+		for j := range fold.Test {
+			p := Expit(fold.Votes.(*SumBallotBox).TallyNum(j) + fold.Forest.Intercept)
+			if (p > 0.5) != (testtarget.GetStr(j) == "b") {
+				wrong++
+			}
+		}
+		if e := float64(wrong) / float64(len(fold.Test)); e > 0.2 {
+			t.Errorf("Gradient boosting classification fold %v had error %v.", i, e)
+		}
+	}
+}
+
+func TestGroupedAndTimeSeriesFolds(t *testing.T) {
+	fm := ParseAFM(strings.NewReader(".\t0\t1\t2\t3\t4\t5\t6\t7\t8\t9\n" +
+		"C:patient\tp1\tp2\tp1\tp3\tp2\tp4\tp4\tNA\tp1\tp5\n" +
+		"N:time\t5\t3\t9\t1\t7\t2\t2\t8\t6\tNA\n"))
+
+	folds := GroupedFolds(fm.Data[0], []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, 3)
+	foldof := make(map[string]int)
+	total := 0
+	for i, fold := range folds {
+		total += len(fold)
+		for _, c := range fold {
+			if fm.Data[0].IsMissing(c) {
+				continue
+			}
+			patient := fm.Data[0].GetStr(c)
+			if j, ok := foldof[patient]; ok && j != i {
+				t.Errorf("Cases of %v were in folds %v and %v.", patient, j, i)
+			}
+			foldof[patient] = i
+		}
+	}
+	if total != 10 {
+		t.Errorf("Grouped folds held %v cases not 10.", total)
+	}
+
+	time := fm.Data[1].(NumFeature)
+	cvfolds, err := TimeSeriesFolds(time, NonMissingCases(time), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cvfolds) != 2 || len(cvfolds[1].Train) != len(cvfolds[0].Train)+len(cvfolds[0].Test) {
+		t.Fatalf("Wrong time series folds %v.", cvfolds)
+	}
+	for i, fold := range cvfolds {
+		for _, tr := range fold.Train {
+			for _, te := range fold.Test {
+				if time.Get(tr) >= time.Get(te) {
+					t.Errorf("Fold %v trained on time %v and tested on %v.", i, time.Get(tr), time.Get(te))
+				}
+			}
+		}
+	}
+
+	if _, err := TimeSeriesFolds(fm.Data[0], NonMissingCases(time), 2); err == nil {
+		t.Error("Time series folds ordered by a categorical feature.")
+	}
+}
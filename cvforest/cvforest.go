@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/ryanbressler/CloudForest"
+	"github.com/ryanbressler/CloudForest/metrics"
+	"log"
+	"math/rand"
+	"os"
+	"runtime"
+	"time"
+)
+
+//parseJSONFlag unmarshals the json value of a flag if it was given.
+func parseJSONFlag(name string, value string, v interface{}) {
+	if value == "" {
+		return
+	}
+	if err := json.Unmarshal([]byte(value), v); err != nil {
+		log.Fatalf("Error parsing -%v: %v", name, err)
+	}
+}
+
+//growforestOutputs are growforest options in its configs that only affect its output or threading.
+var growforestOutputs = []string{"condimportance", "condthreshold", "cpuprofile", "dumpconfig",
+	"importance", "inbag", "multiboost", "oob", "oobpreds", "progress", "rfpred", "scikitforest",
+	"selftest", "test"}
+
+/*
+growforestModels returns the growforest model options that cvforest doesn't support with their
+defaults so growforest configs can be applied if they are left unset.
+*/
+func growforestModels() *flag.FlagSet {
+	fs := flag.NewFlagSet("growforest", flag.ContinueOnError)
+	fs.Int("ace", 0, "")
+	fs.Bool("contrastall", false, "")
+	fs.Int("nContrasts", 0, "")
+	fs.Float64("cutoff", 0.0, "")
+	fs.Bool("density", false, "")
+	fs.Bool("isolation", false, "")
+	fs.Bool("permute", false, "")
+	fs.Int("proximpute", 0, "")
+	fs.Bool("unsupervised", false, "")
+	fs.String("trans_unlabeled", "", "")
+	fs.Float64("trans_alpha", 10.0, "")
+	fs.Float64("trans_beta", 0.0, "")
+	return fs
+}
+
+//applyConfig applies a cvforest, tuneforest or growforest config to the command line flags.
+func applyConfig(config map[string]string) error {
+	models := growforestModels()
+	modelConfig := make(map[string]string)
+	ignore := append([]string{}, growforestOutputs...)
+	models.VisitAll(func(f *flag.Flag) {
+		if value, ok := config[f.Name]; ok {
+			modelConfig[f.Name] = value
+		}
+		ignore = append(ignore, f.Name)
+	})
+	if err := CloudForest.ApplyConfig(models, modelConfig); err != nil {
+		return err
+	}
+	var err error
+	models.VisitAll(func(f *flag.Flag) {
+		if err == nil && f.Value.String() != f.DefValue {
+			err = fmt.Errorf("Option %v=%v in config isn't supported by cvforest.", f.Name, f.Value)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return CloudForest.ApplyConfig(flag.CommandLine, config, ignore...)
+}
+
+func main() {
+	fm := flag.String("train",
+		"featurematrix.afm", "AFM formated feature matrix containing training data.")
+	targetname := flag.String("target",
+		"", "The row header of the target in the feature matrix.")
+	oofpreds := flag.String("oofpreds",
+		"", "File name to write out-of-fold predictions (caselabel predicted actual fold) to.")
+	metricnames := flag.String("metrics",
+		"", "Comma separated metrics to report (auc,prauc,logloss,brier,mcc,kappa,accuracy,confusion or mae,rmse,mape,r2,quantile[:q]). Defaults to accuracy,auc,logloss,mcc or rmse,mae,r2.")
+	costs := flag.String("cost",
+		"", "For categorical targets, a json string to float map of the cost of falsely identifying each category.")
+	dentropy := flag.String("dentropy",
+		"", "Class disutilities for disutility entropy.")
+	adacosts := flag.String("adacost",
+		"", "Json costs for cost sentive AdaBoost.")
+	rfweights := flag.String("rfweights",
+		"", "For categorical targets, a json string to float map of the weights to use for each category in Weighted RF.")
+	monotonejson := flag.String("monotone",
+		"", "For numerical targets, a json string to int map of features to monotonicity constraints (1 increasing, -1 decreasing).")
+	blacklist := flag.String("blacklist",
+		"", "A list of feature id's to exclude from the set of predictors.")
+
+	opts := CloudForest.NewGrowOptions()
+
+	var nFolds int
+	flag.IntVar(&nFolds, "folds", 5, "Number of cross validation folds.")
+
+	var groupby string
+	flag.StringVar(&groupby, "groupby", "", "Keep all cases with the same value of this feature in the same fold.")
+
+	var timeseries string
+	flag.StringVar(&timeseries, "timeseries", "", "Use forward chaining folds ordered by this numerical feature (each fold trains on earlier cases only).")
+
+	var nCores int
+	flag.IntVar(&nCores, "nCores", 1, "The number of cores to use (folds are grown in parallel).")
+
+	flag.StringVar(&opts.NSamples, "nSamples", opts.NSamples, "The number of cases to sample (with replacement) for each tree as a count (ex: 10) or portion of total (ex: .5). If <=0 set to total number of cases.")
+	flag.StringVar(&opts.MTry, "mTry", opts.MTry, "Number of candidate features for each split as a count (ex: 10) or portion of total (ex: .5). Ceil(sqrt(nFeatures)) if <=0.")
+	flag.StringVar(&opts.LeafSize, "leafSize", opts.LeafSize, "The minimum number of cases on a leaf node. If <=0 will be inferred to 1 for classification 4 for regression.")
+	flag.IntVar(&opts.MaxDepth, "maxDepth", opts.MaxDepth, "Maximum tree depth. Ignored if 0.")
+	flag.IntVar(&opts.NTrees, "nTrees", opts.NTrees, "Number of trees to grow in each predictor.")
+	flag.StringVar(&opts.BlockRE, "blockRE", opts.BlockRE, "A regular expression to identify features that should be filtered out.")
+	flag.StringVar(&opts.IncludeRE, "includeRE", opts.IncludeRE, "Filter features that DON'T match this RE.")
+	flag.StringVar(&opts.ShuffleRE, "shuffleRE", opts.ShuffleRE, "A regular expression to identify features that should be shuffled.")
+	flag.BoolVar(&opts.Impute, "impute", opts.Impute, "Impute missing values to feature mean/mode before growth.")
+	flag.BoolVar(&opts.NoBag, "nobag", opts.NoBag, "Don't bag samples for each tree.")
+	flag.BoolVar(&opts.Balance, "balance", opts.Balance, "Balance bagging of samples by target class for unbalanced classification.")
+	flag.StringVar(&opts.BalanceBy, "balanceby", opts.BalanceBy, "Roughly balanced bag the target within each class of this feature.")
+	flag.BoolVar(&opts.Extra, "extra", opts.Extra, "Grow Extra Random Trees using a single random split of each numerical or categorical candidate.")
+	flag.StringVar(&opts.Oblique, "oblique", opts.Oblique, "Also consider oblique splits on a combination of numerical features with random or lda weights at each node.")
+	flag.IntVar(&opts.ObliqueFeatures, "obliqueFeatures", opts.ObliqueFeatures, "Number of numerical features to combine in oblique splits.")
+	flag.BoolVar(&opts.SplitMissing, "splitmissing", opts.SplitMissing, "Split missing values onto a third branch at each node (experimental).")
+	flag.IntVar(&opts.Surrogates, "surrogates", opts.Surrogates, "Record up to n surrogate splitters per node to route cases with missing values at prediction time.")
+	flag.BoolVar(&opts.Force, "force", opts.Force, "Force at least one non constant feature to be tested for each split.")
+	flag.BoolVar(&opts.Vet, "vet", opts.Vet, "Penalize potential splitter impurity decrease by subtracting the best split of a permuted target.")
+	flag.BoolVar(&opts.EvalOOB, "evaloob", opts.EvalOOB, "Evaluate potential splitting features on OOB cases after finding split value in bag.")
+	flag.BoolVar(&opts.Jungle, "jungle", opts.Jungle, "Grow unserializable and experimental decision jungle with node recombination.")
+	flag.BoolVar(&opts.L1, "l1", opts.L1, "Use l1 norm regression (target must be numeric).")
+	flag.BoolVar(&opts.Ordinal, "ordinal", opts.Ordinal, "Use ordinal regression (target must be numeric).")
+	flag.Float64Var(&opts.GradBoost, "gbt", opts.GradBoost, "Use gradient boosting with the specified learning rate.")
+	flag.BoolVar(&opts.AdaBoost, "adaboost", opts.AdaBoost, "Use Adaptive boosting for regression/classification.")
+	flag.BoolVar(&opts.Entropy, "entropy", opts.Entropy, "Use entropy minimizing classification (target must be categorical).")
+	flag.BoolVar(&opts.Hellinger, "hellinger", opts.Hellinger, "Build trees using hellinger distance.")
+	flag.StringVar(&opts.Positive, "positive", opts.Positive, "Positive class for hellinger distance, gradient boosting classification and the auc, prauc and brier metrics.")
+	flag.BoolVar(&opts.NP, "NP", opts.NP, "Do approximate Neyman-Pearson classification.")
+	flag.StringVar(&opts.NPPos, "NP_pos", opts.NPPos, "Class label to constrain percision in NP classification.")
+	flag.Float64Var(&opts.NPA, "NP_a", opts.NPA, "Constraint on percision in NP classification [0,1]")
+	flag.Float64Var(&opts.NPK, "NP_k", opts.NPK, "Weight of constraint in NP classification [0,Inf+)")
+
+	var noseed bool
+	flag.BoolVar(&noseed, "noseed", false, "Don't seed the random number generator from time.")
+
+	var configfn string
+	flag.StringVar(&configfn, "config", "", "A json or yaml (.yaml or .yml) file of option names and values such as the best.json of tuneforest or a growforest -dumpconfig. Options given on the command line override it.")
+
+	flag.Parse()
+
+	if configfn != "" {
+		config, err := CloudForest.LoadConfig(configfn)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err = applyConfig(config); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	parseJSONFlag("cost", *costs, &opts.Costs)
+	parseJSONFlag("dentropy", *dentropy, &opts.DEntropy)
+	parseJSONFlag("adacost", *adacosts, &opts.AdaCosts)
+	parseJSONFlag("rfweights", *rfweights, &opts.RFWeights)
+	parseJSONFlag("monotone", *monotonejson, &opts.Monotone)
+	if *blacklist != "" {
+		var err error
+		if opts.Blacklist, err = CloudForest.LoadBlacklist(*blacklist); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if !noseed {
+		rand.Seed(time.Now().UTC().UnixNano())
+	}
+	if nFolds < 2 {
+		log.Fatal("-folds must be at least 2.")
+	}
+	if nCores > 1 {
+		runtime.GOMAXPROCS(nCores)
+	}
+
+	fmt.Printf("Loading data from: %v\n", *fm)
+	data, err := CloudForest.LoadAFM(*fm)
+	if err != nil {
+		log.Fatal(err)
+	}
+	targeti, ok := data.Map[*targetname]
+	if !ok {
+		log.Fatal("Target not found in data.")
+	}
+	targetf := data.Data[targeti]
+
+	if *metricnames == "" {
+		if targetf.NCats() == 0 {
+			*metricnames = "rmse,mae,r2"
+		} else {
+			*metricnames = "accuracy,auc,logloss,mcc"
+		}
+	}
+
+	nCases := targetf.Length()
+	var folds []*CloudForest.CVFold
+	switch {
+	case timeseries != "":
+		orderi, ok := data.Map[timeseries]
+		if !ok {
+			log.Fatal("Time series ordering feature not found in data.")
+		}
+		folds, err = CloudForest.TimeSeriesFolds(data.Data[orderi], CloudForest.NonMissingCases(targetf), nFolds)
+		if err != nil {
+			log.Fatal(err)
+		}
+	case groupby != "":
+		groupi, ok := data.Map[groupby]
+		if !ok {
+			log.Fatal("Groupby feature not found in data.")
+		}
+		folds = CloudForest.NewCVFolds(CloudForest.GroupedFolds(data.Data[groupi], CloudForest.NonMissingCases(targetf), nFolds), nCases)
+	default:
+		folds = CloudForest.NewCVFolds(CloudForest.StratifiedFolds(targetf, nFolds), nCases)
+	}
+	fmt.Printf("Cross validating %v with %v folds on %v cores.\n", *targetname, nFolds, nCores)
+
+	start := time.Now()
+	CloudForest.CrossValidate(data, *targetname, folds, opts, nCores)
+	fmt.Printf("Total cross validation time (seconds): %v\n", time.Now().Sub(start).Seconds())
+
+	foldresults := make([][]metrics.Result, 0, len(folds))
+	for i, fold := range folds {
+		if fold.Err != nil {
+			log.Fatalf("Fold %v: %v", i, fold.Err)
+		}
+		foldtarget := fold.TestData.Data[fold.TestData.Map[*targetname]]
+		results, err := metrics.EvaluateVotes(*metricnames, fold.Votes, foldtarget, fold.Forest.Intercept, opts.Positive)
+		if err != nil {
+			log.Fatalf("Fold %v: %v", i, err)
+		}
+		fmt.Printf("Fold %v: %v training cases, %v testing cases, %v trees.\n", i, len(fold.Train), len(fold.Test), len(fold.Forest.Trees))
+		metrics.WriteResults(os.Stdout, fmt.Sprintf("FOLD\t%v", i), results)
+		foldresults = append(foldresults, results)
+	}
+	means, sds := metrics.Summarize(foldresults)
+	metrics.WriteResults(os.Stdout, "MEAN", means)
+	metrics.WriteResults(os.Stdout, "SD", sds)
+
+	if *oofpreds != "" {
+		fmt.Printf("Outputting out-of-fold predictions to %v\n", *oofpreds)
+		predfile, err := os.Create(*oofpreds)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer predfile.Close()
+		preds := make([]string, nCases)
+		foldof := make([]int, nCases)
+		for c := range foldof {
+			foldof[c] = -1
+		}
+		for i, fold := range folds {
+			for j, c := range fold.Test {
+				foldof[c] = i
+				if sbb, ok := fold.Votes.(*CloudForest.SumBallotBox); ok {
+					pred := sbb.TallyNum(j) + fold.Forest.Intercept
+					if targetf.NCats() != 0 {
+						//Probability of the positive class for gradient boosting classification.
+						pred = CloudForest.Expit(pred)
+					}
+					preds[c] = fmt.Sprintf("%v", pred)
+				} else {
+					preds[c] = fold.Votes.Tally(j)
+				}
+			}
+		}
+		for c, label := range data.CaseLabels {
+			if foldof[c] >= 0 {
+				fmt.Fprintf(predfile, "%v\t%v\t%v\t%v\n", label, preds[c], targetf.GetStr(c), foldof[c])
+			}
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package CloudForest
 
 import (
+	"fmt"
 	"math/rand"
 	"strings"
 	"testing"
@@ -26,6 +27,20 @@ N:FloatVar	.9	NA	.9	.9	.2	.9	.9	.9`
 
 //Note: Iris and Boston Housing Data in string literals at end of File.
 
+//syntheticAFM parses a feature matrix of the named features with ncases cases labeled by their
+//index. row returns the values (formated with %v, "NA" for missing) of the features for case i
+//drawing any randomness from rnd so tests with a seeded rnd are reproducible.
+func syntheticAFM(rnd *rand.Rand, ncases int, features []string, row func(i int, rnd *rand.Rand) []interface{}) *FeatureMatrix {
+	lines := append([]string{"."}, features...)
+	for i := 0; i < ncases; i++ {
+		lines[0] += fmt.Sprintf("\t%v", i)
+		for j, v := range row(i, rnd) {
+			lines[j+1] += fmt.Sprintf("\t%v", v)
+		}
+	}
+	return ParseAFM(strings.NewReader(strings.Join(lines, "\n")))
+}
+
 func GetAllClassificationTargets(f CatFeature) []Target {
 	costs := make(map[string]float64)
 
@@ -103,7 +118,7 @@ func TestWierdTargets(t *testing.T) {
 		target := &DensityTarget{&fm.Data, fm.Data[0].Length()}
 		tree := NewTree()
 		allocs := NewBestSplitAllocs(len(cases), cattarget)
-		tree.Grow(fm, target, cases, canidates, nil, 3, 1, 0, false, false, false, false, false, nil, nil, allocs)
+		tree.Grow(fm, target, cases, canidates, nil, 3, 1, 0, false, false, false, false, false, 0, nil, nil, allocs)
 		count := 0
 		tree.Root.Recurse(func(*Node, []int, int) { count++ }, fm, cases, 0)
 		if count < 1 {
@@ -131,7 +146,7 @@ func TestTreeTargets(t *testing.T) {
 	for _, target := range regressiontargets {
 		tree := NewTree()
 		allocs := NewBestSplitAllocs(len(cases), target)
-		tree.Grow(fm, target, cases, canidates, nil, 3, 1, 0, false, false, false, false, false, nil, nil, allocs)
+		tree.Grow(fm, target, cases, canidates, nil, 3, 1, 0, false, false, false, false, false, 0, nil, nil, allocs)
 
 		count := 0
 		tree.Root.Recurse(func(*Node, []int, int) { count++ }, fm, cases, 0)
@@ -156,7 +171,7 @@ func TestTreeTargets(t *testing.T) {
 		tree := NewTree()
 
 		allocs := NewBestSplitAllocs(len(cases), target)
-		tree.Grow(fm, target, cases, canidates, nil, 3, 1, 0, false, false, false, false, false, nil, nil, allocs)
+		tree.Grow(fm, target, cases, canidates, nil, 3, 1, 0, false, false, false, false, false, 0, nil, nil, allocs)
 
 		count := 0
 		tree.Root.Recurse(func(*Node, []int, int) { count++ }, fm, cases, 0)
@@ -230,7 +245,7 @@ func TestMissing(t *testing.T) {
 	for _, target := range regressiontargets {
 		tree := NewTree()
 		allocs := NewBestSplitAllocs(len(cases), target)
-		tree.Grow(fm, target, cases, canidates, nil, len(canidates), 1, 0, true, false, false, false, false, nil, nil, allocs)
+		tree.Grow(fm, target, cases, canidates, nil, len(canidates), 1, 0, true, false, false, false, false, 0, nil, nil, allocs)
 
 		votes := NewNumBallotBox(numtarget.Length())
 
@@ -243,7 +258,7 @@ func TestMissing(t *testing.T) {
 
 		tree = NewTree()
 		allocs = NewBestSplitAllocs(len(cases), target)
-		tree.Grow(fm, target, cases, canidates, nil, len(canidates), 1, 0, false, false, false, false, false, nil, nil, allocs)
+		tree.Grow(fm, target, cases, canidates, nil, len(canidates), 1, 0, false, false, false, false, false, 0, nil, nil, allocs)
 
 		votes = NewNumBallotBox(numtarget.Length())
 
@@ -256,7 +271,7 @@ func TestMissing(t *testing.T) {
 
 		tree = NewTree()
 		allocs = NewBestSplitAllocs(len(cases), target)
-		tree.Grow(fmimputed, target, cases, canidates, nil, len(canidates), 1, 0, false, false, false, false, false, nil, nil, allocs)
+		tree.Grow(fmimputed, target, cases, canidates, nil, len(canidates), 1, 0, false, false, false, false, false, 0, nil, nil, allocs)
 
 		votes = NewNumBallotBox(numtarget.Length())
 
@@ -276,7 +291,7 @@ func TestMissing(t *testing.T) {
 		tree := NewTree()
 
 		allocs := NewBestSplitAllocs(len(cases), target)
-		tree.Grow(fm, target, cases, canidates, nil, len(canidates), 1, 0, true, false, false, false, false, nil, nil, allocs)
+		tree.Grow(fm, target, cases, canidates, nil, len(canidates), 1, 0, true, false, false, false, false, 0, nil, nil, allocs)
 
 		catvotes := NewCatBallotBox(cattarget.Length())
 
@@ -290,7 +305,7 @@ func TestMissing(t *testing.T) {
 		tree = NewTree()
 
 		allocs = NewBestSplitAllocs(len(cases), target)
-		tree.Grow(fm, target, cases, canidates, nil, len(canidates), 1, 0, false, false, false, false, false, nil, nil, allocs)
+		tree.Grow(fm, target, cases, canidates, nil, len(canidates), 1, 0, false, false, false, false, false, 0, nil, nil, allocs)
 
 		catvotes = NewCatBallotBox(cattarget.Length())
 
@@ -304,7 +319,7 @@ func TestMissing(t *testing.T) {
 		tree = NewTree()
 
 		allocs = NewBestSplitAllocs(len(cases), target)
-		tree.Grow(fmimputed, target, cases, canidates, nil, len(canidates), 1, 0, false, false, false, false, false, nil, nil, allocs)
+		tree.Grow(fmimputed, target, cases, canidates, nil, len(canidates), 1, 0, false, false, false, false, false, 0, nil, nil, allocs)
 
 		catvotes = NewCatBallotBox(cattarget.Length())
 
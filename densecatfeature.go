@@ -206,7 +206,9 @@ func (f *DenseCatFeature) BestSplit(target Target,
 
 	//TODO: reverse this list, common cases first and maybe make it a switch statement
 	nCats := f.NCats()
-	if f.RandomSearch == false && nCats > maxNonBigCats {
+	if randomSplit {
+		codedSplit, impurityDecrease, constant = f.RandomCatSplit(target, tosplit, nonmissingparentImp, leafSize, allocs)
+	} else if f.RandomSearch == false && nCats > maxNonBigCats {
 		codedSplit, impurityDecrease, constant = f.BestCatSplitIterBig(target, tosplit, nonmissingparentImp, leafSize, allocs)
 	} else if f.RandomSearch == false && nCats > maxExhaustiveCats {
 		codedSplit, impurityDecrease, constant = f.BestCatSplitIter(target, tosplit, nonmissingparentImp, leafSize, allocs)
@@ -225,6 +227,79 @@ func (f *DenseCatFeature) BestSplit(target Target,
 
 }
 
+/*
+RandomCatSplit makes an extremely randomized split sending a random subset of the categories
+present in cases left. Subsets are drawn until one leaves leafSize cases on each side (or a
+few attempts fail) and the split is scored once using target.SplitImpurity so it works with any
+target. The coded split is an int or, for features with many categories, a *big.Int with bits
+set for the categories that go left.
+*/
+func (f *DenseCatFeature) RandomCatSplit(target Target,
+	cases *[]int,
+	parentImp float64,
+	leafSize int,
+	allocs *BestSplitAllocs) (codedSplit interface{}, impurityDecrease float64, constant bool) {
+
+	impurityDecrease = minImp
+
+	nCats := f.NCats()
+	counts := make([]int, nCats)
+	present := make([]int, 0, nCats)
+	for _, c := range *cases {
+		cat := f.CatData[c]
+		if counts[cat] == 0 {
+			present = append(present, cat)
+		}
+		counts[cat]++
+	}
+	if len(present) < 2 {
+		constant = true
+		return
+	}
+
+	var left []int
+	for try := 0; try < 10; try++ {
+		order := allocs.Rnd.Perm(len(present))
+		left = order[:1+allocs.Rnd.Intn(len(present)-1)]
+		nleft := 0
+		for _, k := range left {
+			nleft += counts[present[k]]
+		}
+		if nleft >= leafSize && len(*cases)-nleft >= leafSize {
+			break
+		}
+		left = nil
+	}
+	if left == nil {
+		return
+	}
+
+	if nCats > maxNonBigCats {
+		bits := big.NewInt(0)
+		for _, k := range left {
+			bits.SetBit(bits, present[k], 1)
+		}
+		codedSplit = bits
+	} else {
+		bits := 0
+		for _, k := range left {
+			bits |= 1 << uint(present[k])
+		}
+		codedSplit = bits
+	}
+
+	l, r, _ := f.Split(codedSplit, *cases)
+	allocs.LM = l
+	allocs.RM = r
+	if parentImp < 0 {
+		impurityDecrease = target.SplitImpurity(&allocs.LM, &allocs.RM, nil, allocs)
+	} else {
+		impurityDecrease = parentImp
+		impurityDecrease -= target.SplitImpurity(&allocs.LM, &allocs.RM, nil, allocs)
+	}
+	return
+}
+
 //Split does an inplace split from a coded spli value which should be an int or Big.Int with bit flags
 //representing which class labels go left.
 func (f *DenseCatFeature) Split(codedSplit interface{}, cases []int) (l []int, r []int, m []int) {
@@ -360,7 +435,7 @@ func (f *DenseCatFeature) SplitPoints(codedSplit interface{}, cs *[]int) (int, i
 func (f *DenseCatFeature) DecodeSplit(codedSplit interface{}) (s *Splitter) {
 
 	nCats := f.NCats()
-	s = &Splitter{f.Name, false, 0.0, make(map[string]bool, nCats)}
+	s = &Splitter{f.Name, false, 0.0, make(map[string]bool, nCats), nil, nil}
 
 	switch codedSplit.(type) {
 	case int:
@@ -210,7 +210,7 @@ func (f *DenseNumFeature) SplitPoints(codedSplit interface{}, cs *[]int) (int, i
 //splitters are decoded to send categorical values for which the bit in cat is 1 left.
 func (f *DenseNumFeature) DecodeSplit(codedSplit interface{}) (s *Splitter) {
 
-	s = &Splitter{f.Name, true, codedSplit.(float64), nil}
+	s = &Splitter{f.Name, true, codedSplit.(float64), nil, nil, nil}
 
 	return
 }
@@ -312,11 +312,38 @@ func (f *DenseNumFeature) BestNumSplit(target Target,
 		}
 		lasti := leafSize - 1
 
-		if randomSplit  && stop > leafSize {
-			leafSize = leafSize + allocs.Rnd.Intn(stop-leafSize)
-			lasti = leafSize - 1
-			stop = leafSize + 1
+		//violates checks if splitting before the i'th sorted case breaks a monotonicity constraint.
+		violates := func(i int) bool { return false }
+		if allocs.Monotone != nil && allocs.Monotone[f.Name] != 0 {
+			violates = monotoneViolation(target, sorted, allocs.Monotone[f.Name])
+		}
 
+		if randomSplit {
+			//extremely randomized trees score a single cut point drawn from those between
+			//distinct values that leave leafSize cases on each side
+			cuts := make([]int, 0, stop-leafSize)
+			for i := leafSize; i < stop; i++ {
+				if sortedData[i] > (sortedData[i-1] + constant_cutoff) {
+					cuts = append(cuts, i)
+				}
+			}
+			if len(cuts) == 0 {
+				return
+			}
+			i := cuts[allocs.Rnd.Intn(len(cuts))]
+			if violates(i) {
+				return
+			}
+			allocs.LM = sorted[:i]
+			allocs.RM = sorted[i:]
+			if parentImp < 0 {
+				impurityDecrease = target.SplitImpurity(&allocs.LM, &allocs.RM, nil, allocs)
+			} else {
+				impurityDecrease = parentImp
+				impurityDecrease -= target.SplitImpurity(&allocs.LM, &allocs.RM, nil, allocs)
+			}
+			codedSplit = (sortedData[i-1] + sortedData[i]) / 2.0
+			return
 		}
 
 		for i := leafSize; i < stop; i++ {
@@ -324,9 +351,6 @@ func (f *DenseNumFeature) BestNumSplit(target Target,
 			//skip cases where the next sorted case has the same value as these can't be split on
 			if sortedData[i] <= (sortedData[lasti] + constant_cutoff) {
 				continue
-				if randomSplit {
-					stop++
-				}
 			}
 
 			if lastsplit == 0 {
@@ -353,7 +377,7 @@ func (f *DenseNumFeature) BestNumSplit(target Target,
 				lastsplit = i
 			}
 
-			if innerimp > impurityDecrease {
+			if innerimp > impurityDecrease && !violates(i) {
 				impurityDecrease = innerimp
 				splitf = sortedData[lasti]
 				splitf += sortedData[i]
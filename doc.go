@@ -75,7 +75,31 @@ function/closure passed to a tree's root node's Recurse method:
 This allows a researcher to include whatever additional analysis they need (importance scores,
 proximity etc) in tree growth. The same Recurse method can also be used to analyze existing forests
 to tabulate scores or extract structure. Utilities like leafcount and errorrate use this
-method to tabulate data about the tree in collection objects.
+method to tabulate data about the tree in collection objects. Tree.SHAP and Forest.SHAP use the
+number of training cases that reached each node (Node.Cover) to explain individual predictions
+with TreeSHAP. Forest.PartialDependence calculates partial dependence and individual conditional
+expectation curves. Tree.CountProximity counts leaf co-occurrence in a ShardedCounter and
+NormalizeProximity, OutlierScores and ClassicalMDS turn the counts into proximities, Breiman's
+outlier measure and multidimensional scaling coordinates. FeatureMatrix.UnsupervisedCopy adds
+synthetic cases with independent features for unsupervised forests. Tree.GrowIsolation grows
+isolation trees with random splits and Forest.AnomalyScores scores cases by their mean path length.
+Tree.GrowOblique also considers oblique splits on random or linear discriminant combinations of
+numerical features found by FeatureMatrix.BestObliqueSplitter.
+Setting BestSplitAllocs.Monotone constrains regression trees grown by Tree.Grow to be monotone in
+chosen features.
+
+Tree.WriteText and Tree.WriteDOT render trees as indented text or Graphviz DOT using
+Splitter.Describe to give the condition for each branch. Tree.Rules extracts the conjunction of
+conditions leading to each node as a Rule with its support and out of bag confidence and
+FitRuleFit selects and weights rules with a sparse linear model as in RuleFit.
+The metrics subpackage calculates classification and regression metrics (AUC, log loss, MCC,
+R² etc) from the votes in a ballot box.
+GrowOptions.GrowForest grows a forest in memory with the model options of growforest (and
+GrowForestOOB also records out of bag votes) and CrossValidate uses it to cross validate on folds
+from StratifiedFolds, GroupedFolds (which keep groups of cases together) or TimeSeriesFolds
+(which only train on earlier cases).
+LoadConfig reads json or yaml files of command line options which ApplyConfig applies to a
+flag.FlagSet and WriteConfig writes the resolved options back out.
 
 
 Stackable Interfaces
@@ -133,7 +157,8 @@ For categorical predictors, BestSplit will also attempt to intelligently choose
 different implementations depending on user input and the number of categories.
 These include exhaustive, random, and iterative searches for the best combination of categories
 implemented with bitwise operations against int and big.Int. See BestCatSplit, BestCatSplitIter,
-BestCatSplitBig and BestCatSplitIterBig.
+BestCatSplitBig and BestCatSplitIterBig. When extraRandom is set RandomCatSplit instead
+scores a single random subset of the categories present as in extremely randomized trees.
 
 All numerical predictors are handled by BestNumSplit which
 relies on go's sorting package.
@@ -148,12 +173,22 @@ Trees can be grown in separate go routines. The growforest utility provides an e
 of this that uses go routines and channels to grow trees in parallel and write trees
 to disk as the are finished by the "worker" go routines. The few summary statistics
 like mean impurity decrease per feature (importance) can be calculated using thread
-safe data structures like RunningMean.
+safe data structures like RunningMean. Tree.PermutationImportance adds each tree's out of bag
+permutation importance to RunningMeans in the same way and Forest.ConditionalPermutationImportance
+does conditional permutation importance for correlated features.
 
 Trees can also be grown on separate machines. The .sf stochastic forest format
 allows several small forests to be combined by concatenation and the ForestReader
 and ForestWriter structs allow these forests to be accessed tree by tree (or even node
 by node) from disk.
+Optional METADATA lines record the options, features, category levels and out of bag metrics
+of a forest as ForestMetadata which ForestReader exposes as Forest.Metadata.
+BinaryForestWriter and BinaryForestReader save and load forests in a compact binary format that
+loads much faster and LoadForest reads either format.
+BuildScikitForest converts a forest into the node arrays scikit-learn uses for its trees with
+node values, sample counts and impurities from a FeatureMatrix and categorical features one
+hot encoded, WritePMML writes a forest as a PMML MiningModel and WriteONNX writes it as an ONNX
+tree ensemble.
 
 For data sets that are too big to fit in memory on a single machine Tree.Grow and
 FeatureMatrix.BestSplitter can be reimplemented to load candidate features from disk,
@@ -176,12 +211,19 @@ Optionally, feature.ImputeMissing or featurematrixImputeMissing can be called be
 to impute missing values to the feature mean/mode which Brieman [2] suggests as a fast method for
 imputing values.
 
-This forest could also be analyzed for proximity (using leafcount or tree.GetLeaves) to do the
-more accurate proximity weighted imputation Brieman describes.
+FeatureMatrix.ImputeByProximity (or ImputeByProximityTrees to set the number of trees) does the more
+accurate proximity weighted imputation Brieman describes using leaf co-occurrence found with
+Tree.GetLeaves.
+
+FeatureMatrix.ImputeByForest does unsupervised MissForest style imputation by iteratively predicting
+each feature with missing values from all of the others.
 
 Experimental support is provided for 3 way splitting which splits missing cases onto a third branch.
 [2] This has so far yielded mixed results in testing.
 
+Tree.Grow can also record CART style Surrogates at each node which Node.Recurse uses to route
+cases missing the splitting feature at prediction time.
+
 At some point in the future support may be added for local imputing of missing values during tree growth
 as described in [3]
 
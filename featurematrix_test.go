@@ -66,3 +66,43 @@ func TestBestSplitter(t *testing.T) {
 		}
 	}
 }
+
+func TestExtraRandomSplits(t *testing.T) {
+	fm := ParseAFM(strings.NewReader(`.	0	1	2	3	4	5	6	7	8	9	10	11
+C:CatTarget	0	0	0	0	0	0	1	1	1	1	1	1
+N:NumTarget	1	1.5	1	2	1	1	5	6	5	5.5	5	6
+C:Cats	a	a	b	b	c	c	d	d	e	e	f	f
+N:Ties	0	0	0	0	0	0	0	0	0	1	1	1`))
+	cases := []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}
+	cats := fm.Data[2].(*DenseCatFeature)
+
+	targets := []Target{fm.Data[0], &L1Target{fm.Data[1].(NumFeature)}}
+	for _, target := range targets {
+		allocs := NewBestSplitAllocs(len(cases), target)
+		parentImp := target.Impurity(&cases, allocs.Counter)
+		for i := 0; i < 20; i++ {
+			split, imp, constant := cats.BestSplit(target, &cases, parentImp, 2, true, allocs)
+			if split == nil || constant || imp == minImp {
+				t.Fatalf("Random categorical split was %v with imp %v and constant %v.", split, imp, constant)
+			}
+			l, r, _ := cats.Split(split, append([]int(nil), cases...))
+			if len(l) < 2 || len(r) < 2 {
+				t.Errorf("Random categorical split sent %v cases left and %v right with leafSize 2.", len(l), len(r))
+			}
+
+			//The only split of a mostly tied feature must be found even though most cut points are ties.
+			split, imp, _ = fm.Data[3].BestSplit(target, &cases, parentImp, 1, true, allocs)
+			if split != 0.5 || imp == minImp {
+				t.Errorf("Random numerical split of tied feature was %v with imp %v.", split, imp)
+			}
+		}
+	}
+
+	//Trees using only the categorical feature should split with extraRandom.
+	target := fm.Data[1]
+	tree := NewTree()
+	tree.Grow(fm, target, cases, []int{2}, nil, 1, 1, 0, false, false, false, false, true, 0, nil, nil, NewBestSplitAllocs(len(cases), target))
+	if tree.Root.Splitter == nil || tree.Root.Splitter.Numerical {
+		t.Errorf("Extra random tree didn't split on the categorical feature.")
+	}
+}
@@ -0,0 +1,173 @@
+package CloudForest
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+//Version is the version of CloudForest recorded in the metadata of saved forests.
+const Version = "1.0"
+
+/*
+FeatureMetadata describes a feature a forest was trained on. Type is "numerical" or
+"categorical" and, for categorical features, Levels is the Back slice of the feature's CatMap so
+category codes can be recovered.
+*/
+type FeatureMetadata struct {
+	Name   string   `json:"name"`
+	Type   string   `json:"type"`
+	Levels []string `json:"levels,omitempty"`
+}
+
+//DescribeFeature returns the FeatureMetadata of f.
+func DescribeFeature(f Feature) *FeatureMetadata {
+	cf, ok := f.(CatFeature)
+	if !ok {
+		return &FeatureMetadata{f.GetName(), "numerical", nil}
+	}
+	levels := make([]string, 0, cf.NCats())
+	for i := 0; i < cf.NCats(); i++ {
+		levels = append(levels, cf.NumToCat(i))
+	}
+	return &FeatureMetadata{f.GetName(), "categorical", levels}
+}
+
+//CatMap rebuilds the CatMap of a categorical feature from its Levels.
+func (m *FeatureMetadata) CatMap() *CatMap {
+	cm := &CatMap{make(map[string]int, len(m.Levels)), make([]string, 0, len(m.Levels))}
+	for _, level := range m.Levels {
+		cm.CatToNum(level)
+	}
+	return cm
+}
+
+/*
+ForestMetadata records how a forest was trained: the CloudForest version, an RFC 3339 timestamp,
+the training options (as option names and values like a -config file), the target and candidate
+features and out of bag metrics by name. Any field may be empty as metadata is optional in .sf
+files.
+
+It is stored in .sf files as METADATA lines following the FOREST line with the key of the field and
+its value as json:
+
+	METADATA=VERSION,VALUE="1.0"
+	METADATA=TIMESTAMP,VALUE="2015-06-01T12:00:00Z"
+	METADATA=OPTIONS,VALUE={"mTry":"2","nTrees":100}
+	METADATA=TARGET,VALUE={"name":"C:Class","type":"categorical","levels":["a","b"]}
+	METADATA=FEATURE,VALUE={"name":"N:x","type":"numerical"}
+	METADATA=OOB,VALUE={"error":0.05}
+
+FEATURE is repeated for each feature and OOB lines may follow the trees since out of bag metrics
+aren't known until they are grown.
+*/
+type ForestMetadata struct {
+	Version   string
+	Timestamp string
+	Options   map[string]interface{}
+	Target    *FeatureMetadata
+	Features  []*FeatureMetadata
+	OOB       map[string]float64
+}
+
+//NewForestMetadata returns ForestMetadata for a forest trained with options to predict the target
+//feature of fm (none if targeti < 0) from the candidate features stamped with the current version
+//and time.
+func NewForestMetadata(fm *FeatureMatrix, targeti int, candidates []int, options map[string]interface{}) *ForestMetadata {
+	m := &ForestMetadata{Version,
+		time.Now().UTC().Format(time.RFC3339),
+		options,
+		nil,
+		make([]*FeatureMetadata, 0, len(candidates)),
+		nil}
+	if targeti >= 0 {
+		m.Target = DescribeFeature(fm.Data[targeti])
+	}
+	for _, i := range candidates {
+		m.Features = append(m.Features, DescribeFeature(fm.Data[i]))
+	}
+	return m
+}
+
+//Lines returns the METADATA lines (without newlines) for the non empty fields of m.
+func (m *ForestMetadata) Lines() (lines []string, err error) {
+	add := func(key string, value interface{}) {
+		if err != nil {
+			return
+		}
+		var encoded []byte
+		if encoded, err = json.Marshal(value); err == nil {
+			lines = append(lines, fmt.Sprintf("METADATA=%v,VALUE=%s", key, encoded))
+		}
+	}
+	if m.Version != "" {
+		add("VERSION", m.Version)
+	}
+	if m.Timestamp != "" {
+		add("TIMESTAMP", m.Timestamp)
+	}
+	if m.Options != nil {
+		add("OPTIONS", m.Options)
+	}
+	if m.Target != nil {
+		add("TARGET", m.Target)
+	}
+	for _, f := range m.Features {
+		add("FEATURE", f)
+	}
+	if m.OOB != nil {
+		//json can't encode NaN or infinite metrics.
+		oob := make(map[string]float64, len(m.OOB))
+		for name, v := range m.OOB {
+			if !math.IsNaN(v) && !math.IsInf(v, 0) {
+				oob[name] = v
+			}
+		}
+		add("OOB", oob)
+	}
+	return
+}
+
+/*
+ParseLine parses a single METADATA line into m. OOB values are merged with those already
+parsed and FEATURE lines are appended. Unknown keys are ignored so newer files can be read.
+*/
+func (m *ForestMetadata) ParseLine(line string) error {
+	line = strings.TrimSpace(line)
+	i := strings.Index(line, ",VALUE=")
+	if !strings.HasPrefix(line, "METADATA=") || i < 0 {
+		return fmt.Errorf("Poorly formed metadata line: %v", line)
+	}
+	value := []byte(line[i+len(",VALUE="):])
+	var err error
+	switch line[len("METADATA="):i] {
+	case "VERSION":
+		err = json.Unmarshal(value, &m.Version)
+	case "TIMESTAMP":
+		err = json.Unmarshal(value, &m.Timestamp)
+	case "OPTIONS":
+		err = json.Unmarshal(value, &m.Options)
+	case "TARGET":
+		m.Target = new(FeatureMetadata)
+		err = json.Unmarshal(value, m.Target)
+	case "FEATURE":
+		f := new(FeatureMetadata)
+		if err = json.Unmarshal(value, f); err == nil {
+			m.Features = append(m.Features, f)
+		}
+	case "OOB":
+		oob := make(map[string]float64)
+		if err = json.Unmarshal(value, &oob); err == nil {
+			if m.OOB == nil {
+				m.OOB = oob
+			} else {
+				for name, v := range oob {
+					m.OOB[name] = v
+				}
+			}
+		}
+	}
+	return err
+}
@@ -17,19 +17,41 @@ The forest should be in .sf format see the package doc's in doc.go for full form
 It ignores fields that are not use by CloudForest.
 */
 type ForestReader struct {
-	br *bufio.Reader
+	br       *bufio.Reader
+	metadata *ForestMetadata
 }
 
 //NewForestReader wraps the supplied io.Reader as a ForestReader.
 func NewForestReader(r io.Reader) *ForestReader {
-	return &ForestReader{bufio.NewReader(r)}
+	return &ForestReader{bufio.NewReader(r), nil}
+}
+
+//Metadata returns the metadata read so far for the current forest or nil if there was none
+//(as in files written before metadata was added).
+func (fr *ForestReader) Metadata() *ForestMetadata {
+	return fr.metadata
 }
 
 /*
 ForestReader.ReadForest reads the next forest from the underlying reader.
-If io.EOF or another error is encountered it returns that.
+If io.EOF or another error is encountered it returns that. Any metadata is set as the forest's
+Metadata.
+
+Following forests with the same target and no intercept are read as part of the same forest so
+.sf files written with headers and metadata can still be combined by concatenation. The combined
+forest keeps the metadata of the first without its out of bag metrics.
 */
 func (fr *ForestReader) ReadForest() (forest *Forest, err error) {
+	var metadata *ForestMetadata
+	merged := false
+	defer func() {
+		if forest != nil {
+			forest.Metadata = fr.metadata
+			if merged {
+				forest.Metadata = metadata
+			}
+		}
+	}()
 	peek := []byte(" ")
 	peek, err = fr.br.Peek(1)
 	if err != nil {
@@ -41,13 +63,20 @@ func (fr *ForestReader) ReadForest() (forest *Forest, err error) {
 	}
 	for {
 		peek, err = fr.br.Peek(1)
-		if peek[0] == 'F' && forest != nil {
-			return
+		if err == nil && peek[0] == 'F' && forest != nil {
+			next := fr.ParseRfAcePredictorLine(fr.peekLine())
+			intercept, _ := strconv.ParseFloat(next["INTERCEPT"], 64)
+			if next["TARGET"] != forest.Target || forest.Intercept != 0.0 || intercept != 0.0 {
+				return forest, nil
+			}
+			if !merged {
+				merged, metadata = true, fr.metadata
+				if metadata != nil {
+					metadata.OOB = nil
+				}
+			}
 		}
 		t, f, e := fr.ReadTree()
-		if forest != nil && f != nil {
-			return
-		}
 		if forest == nil && f != nil {
 			forest = f
 		}
@@ -68,6 +97,19 @@ func (fr *ForestReader) ReadForest() (forest *Forest, err error) {
 	}
 }
 
+//peekLine returns the next line without reading it.
+func (fr *ForestReader) peekLine() string {
+	for n := 64; ; n *= 2 {
+		b, err := fr.br.Peek(n)
+		if i := strings.IndexByte(string(b), '\n'); i >= 0 {
+			return string(b[:i])
+		}
+		if err != nil {
+			return string(b)
+		}
+	}
+}
+
 /*ForestReader.ReadTree reads the next tree from the underlying reader. If the next tree
 is in a new forest it returns a forest object as well. If an io.EOF or other error is
 encountered it returns that as well as any partially parsed structs.*/
@@ -86,9 +128,19 @@ func (fr *ForestReader) ReadTree() (tree *Tree, forest *Forest, err error) {
 		if err != nil {
 			return
 		}
+		if strings.HasPrefix(line, "METADATA") {
+			if fr.metadata == nil {
+				fr.metadata = new(ForestMetadata)
+			}
+			if e := fr.metadata.ParseLine(line); e != nil {
+				log.Print("Error parsing forest metadata ", e)
+			}
+			continue
+		}
 		parsed := fr.ParseRfAcePredictorLine(line)
 		switch {
 		case strings.HasPrefix(line, "FOREST"):
+			fr.metadata = nil
 			forest = new(Forest)
 			forest.Target = parsed["TARGET"]
 			i, ok := parsed["INTERCEPT"]
@@ -128,32 +180,80 @@ func (fr *ForestReader) ReadTree() (tree *Tree, forest *Forest, err error) {
 			}
 
 			if stype, ok := parsed["SPLITTERTYPE"]; ok {
-				splitter = new(Splitter)
-				splitter.Feature = parsed["SPLITTER"]
-				switch stype {
-				case "CATEGORICAL":
-					splitter.Numerical = false
-
-					splitter.Left = make(map[string]bool)
-					for _, f := range strings.Split(parsed["LVALUES"], ":") {
-						splitter.Left[f] = true
+				splitter = fr.ParseSplitter(parsed["SPLITTER"], stype, parsed["LVALUES"])
+				if stype == "OBLIQUE" {
+					splitter.Weights = fr.ParseWeights(parsed["WEIGHTS"])
+					if len(splitter.Weights) != len(splitter.Features) {
+						err = fmt.Errorf("Oblique splitter %v has %v weights.", splitter.Feature, len(splitter.Weights))
+						return
 					}
+				}
+			}
+
+			n := tree.AddNode(parsed["NODE"], pred, splitter)
+
+			if cover, ok := parsed["COVER"]; ok {
+				n.Cover = ParseFloat(cover)
+			}
 
-				case "NUMERICAL":
-					splitter.Numerical = true
-					lvalue, err := strconv.ParseFloat(parsed["LVALUES"], 64)
-					if err != nil {
-						log.Print("Error parsing lvalues value ", err)
+			if dir, ok := parsed["MISSINGDIR"]; ok {
+				n.MissingLeft = dir == "L"
+				n.Surrogates = make([]*Surrogate, 0)
+				for i := 0; ; i++ {
+					key := fmt.Sprintf("SURROGATE%v", i)
+					feature, ok := parsed[key]
+					if !ok {
+						break
 					}
-					splitter.Value = float64(lvalue)
+					s := &Surrogate{fr.ParseSplitter(feature, parsed[key+"TYPE"], parsed[key+"LVALUES"]), parsed[key+"REVERSED"] == "true", 0.0}
+					n.Surrogates = append(n.Surrogates, s)
 				}
 			}
 
-			tree.AddNode(parsed["NODE"], pred, splitter)
+		}
+	}
+
+}
+
+//ParseSplitter builds a Splitter on the named feature from the SPLITTERTYPE and LVALUES
+//terms of a .sf file.
+func (fr *ForestReader) ParseSplitter(feature string, stype string, lvalues string) (splitter *Splitter) {
+	splitter = new(Splitter)
+	splitter.Feature = feature
+	switch stype {
+	case "CATEGORICAL":
+		splitter.Numerical = false
 
+		splitter.Left = make(map[string]bool)
+		for _, f := range strings.Split(lvalues, ":") {
+			splitter.Left[f] = true
+		}
+
+	case "NUMERICAL", "OBLIQUE":
+		splitter.Numerical = true
+		lvalue, err := strconv.ParseFloat(lvalues, 64)
+		if err != nil {
+			log.Print("Error parsing lvalues value ", err)
+		}
+		splitter.Value = float64(lvalue)
+		if stype == "OBLIQUE" {
+			splitter.Features = strings.Split(feature, ";")
 		}
 	}
+	return
+}
 
+//ParseWeights parses the ";" separated WEIGHTS term of an oblique splitter.
+func (fr *ForestReader) ParseWeights(weights string) []float64 {
+	parsed := make([]float64, 0)
+	for _, w := range strings.Split(weights, ";") {
+		weight, err := strconv.ParseFloat(w, 64)
+		if err != nil {
+			log.Print("Error parsing weight value ", err)
+		}
+		parsed = append(parsed, weight)
+	}
+	return parsed
 }
 
 /*
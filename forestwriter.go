@@ -3,6 +3,7 @@ package CloudForest
 import (
 	"fmt"
 	"io"
+	"log"
 	"strings"
 )
 
@@ -22,11 +23,14 @@ func NewForestWriter(w io.Writer) *ForestWriter {
 	return &ForestWriter{w}
 }
 
-//WriteForest writes an entire forest including all headers.
+//WriteForest writes an entire forest including all headers and any metadata.
 func (fw *ForestWriter) WriteForest(forest *Forest) {
-	if forest.Intercept != 0.0 {
+	if forest.Intercept != 0.0 || forest.Metadata != nil {
 		fw.WriteForestHeader(0, forest.Target, forest.Intercept)
 	}
+	if forest.Metadata != nil {
+		fw.WriteMetadata(forest.Metadata)
+	}
 	for i, tree := range forest.Trees {
 		fw.WriteTree(tree, i)
 	}
@@ -56,6 +60,18 @@ func (fw *ForestWriter) WriteForestHeader(nforest int, target string, intercept
 	fmt.Fprintf(fw.w, "FOREST=%v,TARGET=\"%v\"%v\n", nforest, target, interceptterm)
 }
 
+//WriteMetadata writes METADATA lines for the non empty fields of m. It should follow the forest
+//header but OOB metrics can be written after the trees with a ForestMetadata holding only them.
+func (fw *ForestWriter) WriteMetadata(m *ForestMetadata) {
+	lines, err := m.Lines()
+	if err != nil {
+		log.Print("Error writing forest metadata ", err)
+	}
+	for _, line := range lines {
+		fmt.Fprintln(fw.w, line)
+	}
+}
+
 //WriteNodeAndChildren recursively writes out the target node and all of its children.
 //WriteTree is preferred for most use cases.
 func (fw *ForestWriter) WriteNodeAndChildren(n *Node, path string) {
@@ -81,20 +97,61 @@ func (fw *ForestWriter) WriteNode(n *Node, path string) {
 	if n.Pred != "" {
 		node += fmt.Sprintf(",PRED=%v", n.Pred)
 	}
+	if n.Cover > 0 {
+		node += fmt.Sprintf(",COVER=%v", n.Cover)
+	}
 
 	if n.Splitter != nil {
 		node += fmt.Sprintf(",SPLITTER=%v", n.Splitter.Feature)
-		switch n.Splitter.Numerical {
-		case true:
+		switch {
+		case n.Splitter.IsOblique():
+			node += fmt.Sprintf(",SPLITTERTYPE=OBLIQUE,WEIGHTS=%v,LVALUES=%v,RVALUES=%v", fw.DescribeWeights(n.Splitter.Weights), n.Splitter.Value, n.Splitter.Value)
+		case n.Splitter.Numerical:
 			node += fmt.Sprintf(",SPLITTERTYPE=NUMERICAL,LVALUES=%v,RVALUES=%v", n.Splitter.Value, n.Splitter.Value)
-		case false:
+		default:
 			left := fw.DescribeMap(n.Splitter.Left)
 			node += fmt.Sprintf(",SPLITTERTYPE=CATEGORICAL,LVALUES=%v", left)
 		}
+		if n.Surrogates != nil {
+			node += fw.DescribeSurrogates(n)
+		}
 	}
 	fmt.Fprintln(fw.w, node)
 }
 
+//DescribeSurrogates serializes the missing value routing of a node as a MISSINGDIR term
+//giving the majority direction (L or R) followed by SURROGATE$i, SURROGATE$iTYPE,
+//SURROGATE$iLVALUES and, if needed, SURROGATE$iREVERSED terms for each surrogate in order.
+func (fw *ForestWriter) DescribeSurrogates(n *Node) (terms string) {
+	dir := "R"
+	if n.MissingLeft {
+		dir = "L"
+	}
+	terms = fmt.Sprintf(",MISSINGDIR=%v", dir)
+	for i, s := range n.Surrogates {
+		terms += fmt.Sprintf(",SURROGATE%v=%v", i, s.Splitter.Feature)
+		switch s.Splitter.Numerical {
+		case true:
+			terms += fmt.Sprintf(",SURROGATE%vTYPE=NUMERICAL,SURROGATE%vLVALUES=%v", i, i, s.Splitter.Value)
+		case false:
+			terms += fmt.Sprintf(",SURROGATE%vTYPE=CATEGORICAL,SURROGATE%vLVALUES=%v", i, i, fw.DescribeMap(s.Splitter.Left))
+		}
+		if s.Reversed {
+			terms += fmt.Sprintf(",SURROGATE%vREVERSED=true", i)
+		}
+	}
+	return
+}
+
+//DescribeWeights serializes the weights of an oblique splitter as a ";" separated list.
+func (fw *ForestWriter) DescribeWeights(weights []float64) string {
+	terms := make([]string, 0, len(weights))
+	for _, w := range weights {
+		terms = append(terms, fmt.Sprintf("%v", w))
+	}
+	return strings.Join(terms, ";")
+}
+
 //DescribeMap serializes the "left" map of a categorical splitter.
 func (fw *ForestWriter) DescribeMap(input map[string]bool) string {
 	keys := make([]string, 0)
@@ -1,7 +1,10 @@
 package CloudForest
 
 import (
+	"bytes"
 	"io"
+	"math"
+	"sort"
 	"strings"
 	"testing"
 )
@@ -75,3 +78,162 @@ func TestFileFormats(t *testing.T) {
 	}
 
 }
+
+func TestForestMetadata(t *testing.T) {
+	data := ParseAFM(strings.NewReader(fm))
+	opts := NewGrowOptions()
+	opts.NTrees = 5
+	targetf := data.Data[1]
+	forest, err := opts.GrowForestOOB(data, targetf.GetName(), opts.NewBallotBox(targetf, targetf.Length()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	fw := NewForestWriter(&buf)
+	fw.WriteForest(forest)
+	fw.WriteMetadata(&ForestMetadata{OOB: map[string]float64{"auc": 0.9, "bad": math.NaN()}})
+	//A second forest without metadata.
+	fw.WriteForestHeader(1, "N:x", 0.0)
+	fw.WriteTree(forest.Trees[0], 0)
+
+	fr := NewForestReader(&buf)
+	read, err := fr.ReadForest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := read.Metadata
+	if m == nil || m.Version != Version || m.Timestamp == "" || m.Options["nTrees"] != 5.0 || m.Options["mTry"] != "2" {
+		t.Fatalf("Read metadata %+v.", m)
+	}
+	if len(m.Features) != len(data.Data)-1 || m.Target.Name != targetf.GetName() || m.Target.Type != "categorical" {
+		t.Errorf("Read features %v and target %v.", m.Features, m.Target)
+	}
+	cm := m.Target.CatMap()
+	for i := 0; i < targetf.NCats(); i++ {
+		if cm.Back[i] != targetf.(CatFeature).NumToCat(i) {
+			t.Errorf("Target level %v read as %v.", i, cm.Back[i])
+		}
+	}
+	if _, ok := m.OOB["error"]; !ok || m.OOB["auc"] != 0.9 || len(m.OOB) != 2 {
+		t.Errorf("Read oob metrics %v.", m.OOB)
+	}
+	if len(read.Trees) != 5 {
+		t.Errorf("Read %v trees not 5.", len(read.Trees))
+	}
+
+	read, err = fr.ReadForest()
+	if err != nil || len(read.Trees) != 1 || read.Metadata != nil || fr.Metadata() != nil {
+		t.Errorf("Second forest read with error %v and metadata %v.", err, read.Metadata)
+	}
+}
+
+func TestConcatenatedForests(t *testing.T) {
+	data := ParseAFM(strings.NewReader(fm))
+	var buf bytes.Buffer
+	fw := NewForestWriter(&buf)
+	for _, ntrees := range []int{7, 5} {
+		opts := NewGrowOptions()
+		opts.NTrees = ntrees
+		forest, err := opts.GrowForest(data, "C:CatTarget")
+		if err != nil {
+			t.Fatal(err)
+		}
+		forest.Metadata = NewForestMetadata(data, 1, []int{2, 3, 4}, nil)
+		fw.WriteForest(forest)
+		fw.WriteMetadata(&ForestMetadata{OOB: map[string]float64{"error": 0.1}})
+	}
+	//Boosted forests with an intercept are kept separate.
+	fw.WriteForest(&Forest{"C:CatTarget", []*Tree{NewTree()}, 0.5, nil})
+
+	fr := NewForestReader(&buf)
+	read, err := fr.ReadForest()
+	if err != nil || len(read.Trees) != 12 {
+		t.Fatalf("Concatenated forests read as %v trees with error %v not 12.", len(read.Trees), err)
+	}
+	if read.Metadata == nil || read.Metadata.Target.Name != "C:CatTarget" || len(read.Metadata.Features) != 3 || read.Metadata.OOB != nil {
+		t.Errorf("Concatenated forests read with metadata %+v.", read.Metadata)
+	}
+	read, err = fr.ReadForest()
+	if err != nil || len(read.Trees) != 1 || read.Intercept != 0.5 {
+		t.Errorf("Boosted forest read as %v with error %v.", read, err)
+	}
+}
+
+func TestBinaryForest(t *testing.T) {
+	data := ParseAFM(strings.NewReader(fm))
+	opts := NewGrowOptions()
+	opts.NTrees = 5
+	opts.Surrogates = 1
+	forest, err := opts.GrowForest(data, "C:CatTarget")
+	if err != nil {
+		t.Fatal(err)
+	}
+	forest.Trees[0].Root.Pred = "0.30000000000000004"
+	forest.Trees[1].Root.Pred = "1e-07"
+	oblique := NewTree()
+	oblique.Root.Splitter = NewObliqueSplitter([]string{"N:FloatVar", "N:NumTarget"}, []float64{1.5, -2}, 0.3)
+	oblique.Root.Left = &Node{Pred: "a"}
+	oblique.Root.Right = &Node{Pred: "b"}
+	forest.Trees = append(forest.Trees, oblique)
+
+	var sf, bin bytes.Buffer
+	NewForestWriter(&sf).WriteForest(forest)
+	for i := 0; i < 2; i++ {
+		if err := NewBinaryForestWriter(&bin).WriteForest(forest); err != nil {
+			t.Fatal(err)
+		}
+	}
+	br := NewBinaryForestReader(&bin)
+	for i := 0; i < 2; i++ {
+		read, err := br.ReadForest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var resf bytes.Buffer
+		NewForestWriter(&resf).WriteForest(read)
+		if !sameLines(resf.String(), sf.String()) || read.Metadata.Options["nTrees"] != 5.0 {
+			t.Errorf("Forest %v read from binary differs:\n%v\nnot\n%v", i, resf.String(), sf.String())
+		}
+	}
+	if _, err := br.ReadForest(); err != io.EOF {
+		t.Errorf("Read past the last binary forest with error %v.", err)
+	}
+	if _, err := NewBinaryForestReader(&sf).ReadForest(); err == nil {
+		t.Error("Read an sf file as binary.")
+	}
+}
+
+//sameLines checks that two .sf files have the same lines ignoring the order of categories in
+//categorical splits.
+func sameLines(a string, b string) bool {
+	al, bl := strings.Split(a, "\n"), strings.Split(b, "\n")
+	if len(al) != len(bl) {
+		return false
+	}
+	fr := NewForestReader(nil)
+	for i := range al {
+		if al[i] == "" || bl[i] == "" {
+			if al[i] != bl[i] {
+				return false
+			}
+			continue
+		}
+		ap, bp := fr.ParseRfAcePredictorLine(al[i]), fr.ParseRfAcePredictorLine(bl[i])
+		if len(ap) != len(bp) {
+			return false
+		}
+		for k, v := range ap {
+			if strings.HasSuffix(k, "LVALUES") && strings.Contains(v, ":") {
+				as, bs := strings.Split(v, ":"), strings.Split(bp[k], ":")
+				sort.Strings(as)
+				sort.Strings(bs)
+				v, bp[k] = strings.Join(as, ":"), strings.Join(bs, ":")
+			}
+			if bp[k] != v {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -8,6 +8,7 @@ type Forest struct {
 	Target    string
 	Trees     []*Tree
 	Intercept float64
+	Metadata  *ForestMetadata
 }
 
 /*
@@ -43,7 +44,7 @@ func GrowRandomForest(fm *FeatureMatrix,
 	evaloob bool,
 	importance *[]*RunningMean) (f *Forest) {
 
-	f = &Forest{target.GetName(), make([]*Tree, 0, nTrees), 0.0}
+	f = &Forest{target.GetName(), make([]*Tree, 0, nTrees), 0.0, nil}
 
 	switch target.(type) {
 	case TargetWithIntercept:
@@ -58,7 +59,7 @@ func GrowRandomForest(fm *FeatureMatrix,
 		cases := SampleWithReplacment(nSamples, nCases)
 
 		f.Trees = append(f.Trees, NewTree())
-		f.Trees[i].Grow(fm, target, cases, candidates, nil, mTry, leafSize, maxDepth, splitmissing, force, vet, evaloob, false, importance, nil, allocs)
+		f.Trees[i].Grow(fm, target, cases, candidates, nil, mTry, leafSize, maxDepth, splitmissing, force, vet, evaloob, false, 0, importance, nil, allocs)
 		switch target.(type) {
 		case BoostingTarget:
 			ls, ps := f.Trees[i].Partition(fm)
@@ -6,6 +6,7 @@ import (
 	"flag"
 	"fmt"
 	"github.com/ryanbressler/CloudForest"
+	"github.com/ryanbressler/CloudForest/metrics"
 	"github.com/ryanbressler/CloudForest/stats"
 	"io"
 	"log"
@@ -28,6 +29,10 @@ func main() {
 		"", "The row header of the target in the feature matrix.")
 	imp := flag.String("importance",
 		"", "File name to output importance.")
+	inbagfn := flag.String("inbag",
+		"", "File name to output the in bag cases of each tree to (for leafcount -inbag).")
+	condimp := flag.String("condimportance",
+		"", "File name to output conditional permutation importance.")
 	costs := flag.String("cost",
 		"", "For categorical targets, a json string to float map of the cost of falsely identifying each category.")
 	dentropy := flag.String("dentropy",
@@ -38,6 +43,9 @@ func main() {
 	rfweights := flag.String("rfweights",
 		"", "For categorical targets, a json string to float map of the weights to use for each category in Weighted RF.")
 
+	monotonejson := flag.String("monotone",
+		"", "For numerical targets, a json string to int map of features to monotonicity constraints (1 increasing, -1 decreasing).")
+
 	blacklist := flag.String("blacklist",
 		"", "A list of feature id's to exclude from the set of predictors.")
 
@@ -94,12 +102,24 @@ func main() {
 	var impute bool
 	flag.BoolVar(&impute, "impute", false, "Impute missing values to feature mean/mode before growth.")
 
+	var proxImpute int
+	flag.IntVar(&proxImpute, "proximpute", 0, "Impute missing values using n iterations of forest proximity weighted imputation (rfImpute) before growth.")
+
 	var extra bool
-	flag.BoolVar(&extra, "extra", false, "Grow Extra Random Trees (supports learning from numerical variables only).")
+	flag.BoolVar(&extra, "extra", false, "Grow Extra Random Trees using a single random split of each numerical or categorical candidate.")
+
+	var oblique string
+	flag.StringVar(&oblique, "oblique", "", "Also consider oblique splits on a combination of numerical features with random or lda weights at each node.")
+
+	var nOblique int
+	flag.IntVar(&nOblique, "obliqueFeatures", 3, "Number of numerical features to combine in oblique splits.")
 
 	var splitmissing bool
 	flag.BoolVar(&splitmissing, "splitmissing", false, "Split missing values onto a third branch at each node (experimental).")
 
+	var nSurrogates int
+	flag.IntVar(&nSurrogates, "surrogates", 0, "Record up to n surrogate splitters per node to route cases with missing values at prediction time.")
+
 	var l1 bool
 	flag.BoolVar(&l1, "l1", false, "Use l1 norm regression (target must be numeric).")
 
@@ -133,6 +153,9 @@ func main() {
 	var entropy bool
 	flag.BoolVar(&entropy, "entropy", false, "Use entropy minimizing classification (target must be categorical).")
 
+	var condThreshold float64
+	flag.Float64Var(&condThreshold, "condthreshold", 0.5, "Minimum association with a feature for another feature to be conditioned on in conditional importance.")
+
 	var oob bool
 	flag.BoolVar(&oob, "oob", false, "Calculate and report oob error.")
 
@@ -178,16 +201,54 @@ func main() {
 	var testfm string
 	flag.StringVar(&testfm, "test", "", "Data to test the model on.")
 
+	var metricnames string
+	flag.StringVar(&metricnames, "metrics", "", "Comma separated metrics to report for -selftest, -test or -oob (auc,prauc,logloss,brier,mcc,kappa,accuracy,confusion or mae,rmse,mape,r2,quantile[:q]).")
+
 	var scikitforest string
-	flag.StringVar(&scikitforest, "scikitforest", "", "Write out a (partially complete) scikit style forest in json.")
+	flag.StringVar(&scikitforest, "scikitforest", "", "Write out a scikit-learn style forest in json with categorical features one hot encoded.")
+
+	var isolation bool
+	flag.BoolVar(&isolation, "isolation", false, "Grow an isolation forest for anomaly detection (no target needed; score with applyforest -anomaly).")
+
+	var unsupervised bool
+	flag.BoolVar(&unsupervised, "unsupervised", false, "Grow an unsupervised forest classifying the data versus synthetic data with independent features.")
 
 	var noseed bool
 	flag.BoolVar(&noseed, "noseed", false, "Don't seed the random number generator from time.")
 
+	var configfn string
+	flag.StringVar(&configfn, "config", "", "A json or yaml (.yaml or .yml) file of option names and values. Options given on the command line override it.")
+
+	var dumpconfig string
+	flag.StringVar(&dumpconfig, "dumpconfig", "", "Write the fully resolved configuration (including inferred mTry, leafSize and nSamples) as json to this file (- for stdout) and exit.")
+
 	flag.Parse()
 
+	if configfn != "" {
+		config, err := CloudForest.LoadConfig(configfn)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err = CloudForest.ApplyConfig(flag.CommandLine, config); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	//keep stdout for the json when dumping the config to it and write progress to stderr
+	stdout := os.Stdout
+	if dumpconfig == "-" {
+		os.Stdout = os.Stderr
+	}
+
 	nForest := 1
 
+	if oblique != "" && oblique != "random" && oblique != "lda" {
+		log.Fatal("-oblique must be random or lda.")
+	}
+	if oblique != "" && (splitmissing || nSurrogates > 0 || extra || evaloob || vet || force || jungle) {
+		log.Fatal("-oblique can't be combined with -splitmissing, -surrogates, -extra, -evaloob, -vet, -force or -jungle.")
+	}
+
 	if !noseed {
 		rand.Seed(time.Now().UTC().UnixNano())
 	}
@@ -227,6 +288,14 @@ func main() {
 		defer pprof.StopCPUProfile()
 	}
 
+	//In bag cases written for leafcount are limited to the original cases.
+	nRealCases := data.Data[0].Length()
+	if unsupervised {
+		fmt.Printf("Adding %v synthetic cases for unsupervised learning.\n", nRealCases)
+		data = data.UnsupervisedCopy()
+		*targetname = CloudForest.UnsupervisedTarget
+	}
+
 	if nContrasts > 0 {
 		fmt.Printf("Adding %v Random Contrasts\n", nContrasts)
 		data.AddContrasts(nContrasts)
@@ -268,6 +337,43 @@ func main() {
 
 	}
 
+	if isolation {
+		candidates := make([]int, 0, len(data.Data))
+		for i, f := range data.Data {
+			if !blacklistis[i] && f.GetName() != *targetname {
+				candidates = append(candidates, i)
+			}
+		}
+		nCases := data.Data[0].Length()
+		nSamples := CloudForest.ParseAsIntOrFractionOfTotal(StringnSamples, nCases)
+		if nSamples <= 0 {
+			nSamples = 256
+		}
+		if nSamples > nCases {
+			nSamples = nCases
+		}
+		if maxDepth <= 0 {
+			maxDepth = int(math.Ceil(math.Log2(float64(nSamples))))
+		}
+		fmt.Printf("Growing isolation forest with %v features, nSamples %v and maxDepth %v.\n", len(candidates), nSamples, maxDepth)
+		resolved := map[string]interface{}{"nSamples": fmt.Sprintf("%v", nSamples), "maxDepth": maxDepth}
+		if dumpconfig != "" {
+			writeConfig(stdout, dumpconfig, resolved)
+			return
+		}
+		forest := growIsolationForest(data, candidates, nTrees, nSamples, maxDepth, nCores)
+		forest.Metadata = CloudForest.NewForestMetadata(data, -1, candidates, CloudForest.ConfigValues(flag.CommandLine, resolved, "config", "dumpconfig"))
+		if *rf != "" {
+			forestfile, err := os.Create(*rf)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer forestfile.Close()
+			CloudForest.NewForestWriter(forestfile).WriteForest(forest)
+		}
+		return
+	}
+
 	//find the target feature
 	fmt.Printf("Target : %v\n", *targetname)
 	targeti, ok := data.Map[*targetname]
@@ -319,6 +425,14 @@ func main() {
 		data.ImputeMissing()
 	}
 
+	if proxImpute > 0 {
+		fmt.Printf("Imputing missing values using proximities from %v iterations of %v trees.\n", proxImpute, nTrees)
+		err = data.ImputeByProximityTrees(*targetname, nTrees, proxImpute)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	if permutate {
 		fmt.Println("Permuting target feature.")
 		data.Data[targeti].Shuffle()
@@ -384,6 +498,14 @@ func main() {
 	}
 	fmt.Printf("nSamples : %v\n", nSamples)
 
+	resolved := map[string]interface{}{"mTry": fmt.Sprintf("%v", mTry),
+		"leafSize": fmt.Sprintf("%v", leafSize),
+		"nSamples": fmt.Sprintf("%v", nSamples)}
+	if dumpconfig != "" {
+		writeConfig(stdout, dumpconfig, resolved)
+		return
+	}
+
 	if progress {
 		oob = true
 	}
@@ -513,6 +635,24 @@ func main() {
 		}
 	}
 
+	var monotone map[string]int
+	if *monotonejson != "" {
+		fmt.Println("Using monotonicity constraints: ", *monotonejson)
+		if targetf.NCats() != 0 || density || jungle || oblique != "" {
+			log.Fatal("Monotonicity constraints require a numerical target and standard trees.")
+		}
+		err := json.Unmarshal([]byte(*monotonejson), &monotone)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for name, constraint := range monotone {
+			i, ok := data.Map[name]
+			if !ok || data.Data[i].NCats() != 0 || (constraint != 1 && constraint != -1) {
+				log.Fatalf("Invalid monotonicity constraint %v on %v.", constraint, name)
+			}
+		}
+	}
+
 	var forestwriter *CloudForest.ForestWriter
 	if *rf != "" {
 		forestfile, err := os.Create(*rf)
@@ -521,10 +661,30 @@ func main() {
 		}
 		defer forestfile.Close()
 		forestwriter = CloudForest.NewForestWriter(forestfile)
+		intercept := 0.0
 		switch target.(type) {
 		case CloudForest.TargetWithIntercept:
-			forestwriter.WriteForestHeader(0, *targetname, target.(CloudForest.TargetWithIntercept).Intercept())
+			intercept = target.(CloudForest.TargetWithIntercept).Intercept()
+		}
+		forestwriter.WriteForestHeader(0, *targetname, intercept)
+		candidates := make([]int, 0, len(data.Data))
+		for i := range data.Data {
+			if i != targeti && !blacklistis[i] {
+				candidates = append(candidates, i)
+			}
+		}
+		forestwriter.WriteMetadata(CloudForest.NewForestMetadata(data, targeti, candidates, CloudForest.ConfigValues(flag.CommandLine, resolved, "config", "dumpconfig")))
+	}
+	var inbagfile *os.File
+	if *inbagfn != "" {
+		if *rf == "" {
+			log.Fatal("-inbag requires -rfpred.")
+		}
+		inbagfile, err = os.Create(*inbagfn)
+		if err != nil {
+			log.Fatal(err)
 		}
+		defer inbagfile.Close()
 	}
 	//****************** Setup For ACE ********************************//
 	var aceImps [][]float64
@@ -566,10 +726,43 @@ func main() {
 		imppnt = CloudForest.NewRunningMeans(len(data.Data))
 	}
 
-	var scikikittrees []CloudForest.ScikitTree
+	//Permutation importance is measured against the unboosted target so it isn't
+	//meaningful for boosted forests.
+	var permpnt *[]*CloudForest.RunningMean
+	var classpermpnt []*[]*CloudForest.RunningMean
+	if *imp != "" && ace == 0 && !boost {
+		fmt.Println("Recording OOB permutation importance.")
+		permpnt = CloudForest.NewRunningMeans(len(data.Data))
+		if unboostedTarget.NCats() > 0 {
+			classpermpnt = make([]*[]*CloudForest.RunningMean, 0, len(data.Data))
+			for i := 0; i < len(data.Data); i++ {
+				classpermpnt = append(classpermpnt, CloudForest.NewRunningMeans(unboostedTarget.NCats()))
+			}
+		}
+	}
+
+	//Conditional importance is calculated after growth so trees and their oob cases are kept.
+	var condoob [][]int
+	if *condimp != "" {
+		if boost || ace > 0 {
+			log.Fatal("Conditional importance can't be calculated for boosted or ace forests.")
+		}
+		fmt.Println("Recording trees for conditional permutation importance.")
+		condoob = make([][]int, 0, nTrees)
+	}
+
+	var scikit *CloudForest.ScikitForest
 
 	if scikitforest != "" {
-		scikikittrees = make([]CloudForest.ScikitTree, 0, nTrees)
+		//Gradient boosted trees predict residuals so their values come from their predictions.
+		var sktarget CloudForest.Feature = unboostedTarget
+		if gradboost != 0.0 {
+			sktarget = nil
+		}
+		scikit = CloudForest.NewScikitForest(data, *targetname, sktarget)
+		if target, ok := target.(CloudForest.TargetWithIntercept); ok {
+			scikit.Intercept = target.Intercept()
+		}
 	}
 
 	//****************** Good Stuff Stars Here ;) ******************//
@@ -617,6 +810,7 @@ func main() {
 				}
 
 				allocs := CloudForest.NewBestSplitAllocs(nSamples, targetf)
+				allocs.Monotone = monotone
 				for {
 					nCases := data.Data[0].Length()
 					//sample nCases case with replacement
@@ -648,7 +842,7 @@ func main() {
 
 					}
 
-					if oob || evaloob {
+					if oob || evaloob || permpnt != nil || condoob != nil {
 						ibcases := make([]bool, nCases)
 						for _, v := range cases {
 							ibcases[v] = true
@@ -661,11 +855,14 @@ func main() {
 						}
 					}
 
-					if jungle {
+					if oblique != "" {
+						tree.GrowOblique(data, target, cases, canidates, mTry, nOblique, oblique == "lda", leafSize, maxDepth, imppnt, allocs)
+
+					} else if jungle {
 						tree.GrowJungle(data, target, cases, canidates, oobcases, mTry, leafSize, maxDepth, splitmissing, force, vet, evaloob, extra, imppnt, depthUsed, allocs)
 
 					} else {
-						tree.Grow(data, target, cases, canidates, oobcases, mTry, leafSize, maxDepth, splitmissing, force, vet, evaloob, extra, imppnt, depthUsed, allocs)
+						tree.Grow(data, target, cases, canidates, oobcases, mTry, leafSize, maxDepth, splitmissing, force, vet, evaloob, extra, nSurrogates, imppnt, depthUsed, allocs)
 					}
 					if mmdpnt != nil {
 						for i, v := range *depthUsed {
@@ -695,6 +892,10 @@ func main() {
 						tree.VoteCases(data, oobVotes, oobcases)
 					}
 
+					if permpnt != nil && foresti == nForest-1 {
+						tree.PermutationImportance(data, unboostedTarget, oobcases, canidates, allocs, permpnt, classpermpnt)
+					}
+
 					////////////// Lock mutext to ouput tree ////////
 					if nCores > 1 {
 						recordingTree.Lock()
@@ -702,18 +903,24 @@ func main() {
 
 					if forestwriter != nil && foresti == nForest-1 {
 						forestwriter.WriteTree(tree, treesFinished)
+						if inbagfile != nil {
+							writeInbag(inbagfile, cases, nRealCases)
+						}
 					}
 
-					if scikitforest != "" {
-						skt := CloudForest.NewScikitTree(nFeatures)
-						CloudForest.BuildScikitTree(0, tree.Root, skt)
-						scikikittrees = append(scikikittrees, *skt)
+					if scikit != nil && foresti == nForest-1 {
+						if err := scikit.AddTree(tree, data, cases); err != nil {
+							log.Fatal(err)
+						}
 					}
 
-					if dotest && foresti == nForest-1 {
+					if (dotest || condoob != nil) && foresti == nForest-1 {
 						trees = append(trees, tree)
+						if condoob != nil {
+							condoob = append(condoob, append([]int(nil), oobcases...))
+						}
 
-						if treesStarted < nTrees-1 {
+						if treesStarted < nTrees {
 							//newtree := new(CloudForest.Tree)
 							tree = CloudForest.NewTree()
 							tree.Target = *targetname
@@ -839,14 +1046,29 @@ func main() {
 		}
 		defer skfile.Close()
 		skencoder := json.NewEncoder(skfile)
-		err = skencoder.Encode(scikikittrees)
+		err = skencoder.Encode(scikit)
 		if err != nil {
 			log.Fatal(err)
 		}
 	}
 
 	if oob {
-		fmt.Printf("Out of Bag Error : %v\n", oobVotes.TallyError(unboostedTarget))
+		ooberror := oobVotes.TallyError(unboostedTarget)
+		fmt.Printf("Out of Bag Error : %v\n", ooberror)
+		oobmetrics := map[string]float64{"error": ooberror}
+		if metricnames != "" {
+			results, err := metrics.EvaluateVotes(metricnames, oobVotes, unboostedTarget, 0.0, positive)
+			if err != nil {
+				log.Print(err)
+			}
+			metrics.WriteResults(os.Stdout, "OOBMETRIC", results)
+			for _, r := range results {
+				oobmetrics[r.Name] = r.Value
+			}
+		}
+		if forestwriter != nil {
+			forestwriter.WriteMetadata(&CloudForest.ForestMetadata{OOB: oobmetrics})
+		}
 	}
 	if caseoob != "" {
 		caseoobfile, err := os.Create(caseoob)
@@ -880,12 +1102,45 @@ func main() {
 			for i, v := range *imppnt {
 				mean, count := v.Read()
 				meanMinDepth, treeCount := (*mmdpnt)[i].Read()
-				fmt.Fprintf(impfile, "%v\t%v\t%v\t%v\t%v\t%v\t%v\n", data.Data[i].GetName(), mean, count, mean*float64(count)/float64(nTrees), mean*float64(count)/float64(treeCount), treeCount, meanMinDepth)
+				fmt.Fprintf(impfile, "%v\t%v\t%v\t%v\t%v\t%v\t%v", data.Data[i].GetName(), mean, count, mean*float64(count)/float64(nTrees), mean*float64(count)/float64(treeCount), treeCount, meanMinDepth)
+				if permpnt != nil {
+					permImp, _ := (*permpnt)[i].Read()
+					fmt.Fprintf(impfile, "\t%v", permImp)
+					if classpermpnt != nil {
+						for _, cv := range *classpermpnt[i] {
+							classImp, _ := cv.Read()
+							fmt.Fprintf(impfile, "\t%v", classImp)
+						}
+					}
+				}
+				fmt.Fprint(impfile, "\n")
 
 			}
 		}
 	}
 
+	if *condimp != "" {
+		fmt.Printf("Calculating conditional permutation importance conditioning on features with association >= %v.\n", condThreshold)
+		canidates := make([]int, 0, len(data.Data))
+		for i := 0; i < len(data.Data); i++ {
+			if i != targeti && !blacklistis[i] {
+				canidates = append(canidates, i)
+			}
+		}
+		forest := &CloudForest.Forest{Target: *targetname, Trees: trees}
+		condpnt := forest.ConditionalPermutationImportance(data, unboostedTarget, condoob, canidates, condThreshold)
+
+		condfile, err := os.Create(*condimp)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer condfile.Close()
+		for i, v := range *condpnt {
+			mean, count := v.Read()
+			fmt.Fprintf(condfile, "%v\t%v\t%v\n", data.Data[i].GetName(), mean, count)
+		}
+	}
+
 	if dotest {
 		var bb CloudForest.VoteTallyer
 
@@ -910,10 +1165,16 @@ func main() {
 			}
 		}
 
-		if unboostedTarget.NCats() == 0 {
+		intercept := 0.0
+		switch {
+		case gradboost != 0.0:
+			//boosted trees predict residuals so their votes are summed
+			bb = CloudForest.NewSumBallotBox(testdata.Data[0].Length())
+			intercept = target.(CloudForest.TargetWithIntercept).Intercept()
+		case unboostedTarget.NCats() == 0:
 			//regression
 			bb = CloudForest.NewNumBallotBox(testdata.Data[0].Length())
-		} else {
+		default:
 			//classification
 			bb = CloudForest.NewCatBallotBox(testdata.Data[0].Length())
 		}
@@ -922,9 +1183,19 @@ func main() {
 			tree.Vote(testdata, bb)
 		}
 
-		fmt.Printf("Error: %v\n", bb.TallyError(testtarget))
+		if gradboost == 0.0 {
+			fmt.Printf("Error: %v\n", bb.TallyError(testtarget))
+		}
 
-		if testtarget.NCats() != 0 {
+		if metricnames != "" {
+			results, err := metrics.EvaluateVotes(metricnames, bb, testtarget, intercept, positive)
+			if err != nil {
+				log.Fatal(err)
+			}
+			metrics.WriteResults(os.Stdout, "METRIC", results)
+		}
+
+		if _, ok := bb.(*CloudForest.CatBallotBox); ok && testtarget.NCats() != 0 {
 			falsesbypred := make([]int, testtarget.NCats())
 			predtotals := make([]int, testtarget.NCats())
 
@@ -968,3 +1239,59 @@ func main() {
 	}
 
 }
+
+//writeInbag writes the in bag cases of a tree below nCases as a tab separated line.
+func writeInbag(w io.Writer, cases []int, nCases int) {
+	sep := ""
+	for _, c := range cases {
+		if c < nCases {
+			fmt.Fprint(w, sep, c)
+			sep = "\t"
+		}
+	}
+	fmt.Fprint(w, "\n")
+}
+
+//writeConfig writes the options with the resolved values to fn (or stdout, the original os.Stdout,
+//if fn is "-") for -dumpconfig.
+func writeConfig(stdout *os.File, fn string, resolved map[string]interface{}) {
+	w := stdout
+	if fn != "-" {
+		f, err := os.Create(fn)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := CloudForest.WriteConfig(w, flag.CommandLine, resolved, "config", "dumpconfig"); err != nil {
+		log.Fatal(err)
+	}
+}
+
+//growIsolationForest grows nTrees isolation trees on nCores each on nSamples cases sampled
+//without replacement.
+func growIsolationForest(data *CloudForest.FeatureMatrix, candidates []int, nTrees int, nSamples int, maxDepth int, nCores int) *CloudForest.Forest {
+	nCases := data.Data[0].Length()
+	forest := &CloudForest.Forest{Trees: make([]*CloudForest.Tree, nTrees)}
+	treechan := make(chan int, 0)
+	var waitGroup sync.WaitGroup
+	waitGroup.Add(nCores)
+	for core := 0; core < nCores; core++ {
+		rnd := rand.New(rand.NewSource(rand.Int63()))
+		go func() {
+			for i := range treechan {
+				tree := CloudForest.NewTree()
+				tree.GrowIsolation(data, rnd.Perm(nCases)[:nSamples], candidates, maxDepth, rnd)
+				forest.Trees[i] = tree
+			}
+			waitGroup.Done()
+		}()
+	}
+	for i := 0; i < nTrees; i++ {
+		treechan <- i
+	}
+	close(treechan)
+	waitGroup.Wait()
+	return forest
+}
@@ -0,0 +1,415 @@
+package CloudForest
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"regexp"
+)
+
+/*
+GrowOptions holds the model options of the growforest utility needed to grow a forest in memory
+with GrowForest. Fields are named after the corresponding growforest flags which are also used
+as their json keys so options can be saved and reused. Counts given as strings (MTry, LeafSize and
+NSamples) may also be a fraction of the total and are inferred as in growforest if <= 0.
+Blacklist holds the feature ids read from a growforest -blacklist file (see LoadBlacklist).
+*/
+type GrowOptions struct {
+	NTrees          int                `json:"nTrees"`
+	MTry            string             `json:"mTry"`
+	LeafSize        string             `json:"leafSize"`
+	MaxDepth        int                `json:"maxDepth"`
+	NSamples        string             `json:"nSamples"`
+	NoBag           bool               `json:"nobag"`
+	Balance         bool               `json:"balance"`
+	BalanceBy       string             `json:"balanceby"`
+	Extra           bool               `json:"extra"`
+	SplitMissing    bool               `json:"splitmissing"`
+	Surrogates      int                `json:"surrogates"`
+	Force           bool               `json:"force"`
+	Vet             bool               `json:"vet"`
+	EvalOOB         bool               `json:"evaloob"`
+	Jungle          bool               `json:"jungle"`
+	Oblique         string             `json:"oblique"`
+	ObliqueFeatures int                `json:"obliqueFeatures"`
+	BlockRE         string             `json:"blockRE"`
+	IncludeRE       string             `json:"includeRE"`
+	Blacklist       []string           `json:"blacklist,omitempty"`
+	ShuffleRE       string             `json:"shuffleRE"`
+	Impute          bool               `json:"impute"`
+	L1              bool               `json:"l1"`
+	Ordinal         bool               `json:"ordinal"`
+	GradBoost       float64            `json:"gbt"`
+	AdaBoost        bool               `json:"adaboost"`
+	Entropy         bool               `json:"entropy"`
+	Hellinger       bool               `json:"hellinger"`
+	NP              bool               `json:"NP"`
+	NPPos           string             `json:"NP_pos"`
+	NPA             float64            `json:"NP_a"`
+	NPK             float64            `json:"NP_k"`
+	Positive        string             `json:"positive"`
+	Costs           map[string]float64 `json:"cost,omitempty"`
+	DEntropy        map[string]float64 `json:"dentropy,omitempty"`
+	AdaCosts        map[string]float64 `json:"adacost,omitempty"`
+	RFWeights       map[string]float64 `json:"rfweights,omitempty"`
+	Monotone        map[string]int     `json:"monotone,omitempty"`
+}
+
+//NewGrowOptions returns GrowOptions with the defaults of growforest.
+func NewGrowOptions() *GrowOptions {
+	return &GrowOptions{NTrees: 100,
+		MTry:            "0",
+		LeafSize:        "0",
+		NSamples:        "0",
+		ObliqueFeatures: 3,
+		NPPos:           "1",
+		NPA:             0.1,
+		NPK:             100,
+		Positive:        "True"}
+}
+
+//LoadBlacklist reads the feature ids in the first column of the tab separated file fn as
+//growforest -blacklist does.
+func LoadBlacklist(fn string) (ids []string, err error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	tsv := csv.NewReader(f)
+	tsv.Comma = '\t'
+	tsv.FieldsPerRecord = -1
+	for {
+		id, err := tsv.Read()
+		if err == io.EOF {
+			return ids, nil
+		} else if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id[0])
+	}
+}
+
+//Boosted returns true if the options grow a boosted forest.
+func (o *GrowOptions) Boosted() bool {
+	return o.AdaBoost || o.GradBoost != 0.0
+}
+
+//Candidates returns the indexes of the features of fm other than the target that aren't
+//blacklisted or filtered out by BlockRE or IncludeRE.
+func (o *GrowOptions) Candidates(fm *FeatureMatrix, targeti int) (candidates []int, err error) {
+	var block, include *regexp.Regexp
+	if o.BlockRE != "" {
+		if block, err = regexp.Compile(o.BlockRE); err != nil {
+			return
+		}
+	}
+	if o.IncludeRE != "" {
+		if include, err = regexp.Compile(o.IncludeRE); err != nil {
+			return
+		}
+	}
+	blacklisted := make(map[string]bool, len(o.Blacklist))
+	for _, id := range o.Blacklist {
+		blacklisted[id] = true
+	}
+	candidates = make([]int, 0, len(fm.Data))
+	for i, f := range fm.Data {
+		switch {
+		case i == targeti:
+		case blacklisted[f.GetName()]:
+		case block != nil && block.MatchString(f.GetName()):
+		case include != nil && !include.MatchString(f.GetName()):
+		default:
+			candidates = append(candidates, i)
+		}
+	}
+	return
+}
+
+//Resolve returns mTry, leafSize and nSamples for nFeatures candidate features and nCases cases
+//with a non missing target inferring any that are <= 0 as growforest does.
+func (o *GrowOptions) Resolve(nFeatures int, nCases int, regression bool) (mTry int, leafSize int, nSamples int) {
+	mTry = ParseAsIntOrFractionOfTotal(o.MTry, nFeatures)
+	if mTry <= 0 {
+		mTry = int(math.Ceil(math.Sqrt(float64(nFeatures))))
+	}
+	leafSize = ParseAsIntOrFractionOfTotal(o.LeafSize, nCases)
+	if leafSize <= 0 {
+		switch {
+		case o.Boosted():
+			leafSize = nCases / 3
+		case regression:
+			leafSize = 4
+		default:
+			leafSize = 1
+		}
+	}
+	nSamples = ParseAsIntOrFractionOfTotal(o.NSamples, nCases)
+	if nSamples <= 0 {
+		nSamples = nCases
+	}
+	return
+}
+
+//NewTarget wraps targetf in the target for the impurity and boosting options. targetf is
+//modified by boosting targets so it should be a copy if the original values are needed.
+func (o *GrowOptions) NewTarget(targetf Feature) (target Target, err error) {
+	switch t := targetf.(type) {
+	case NumFeature:
+		if o.L1 {
+			t = &L1Target{t}
+		}
+		if o.Ordinal {
+			t = NewOrdinalTarget(t)
+		}
+		switch {
+		case o.GradBoost != 0.0:
+			return NewGradBoostTarget(t, o.GradBoost), nil
+		case o.AdaBoost:
+			return NewNumAdaBoostTarget(t), nil
+		}
+		return t, nil
+
+	case CatFeature:
+		switch {
+		case o.NP:
+			return NewNPTarget(t, o.NPPos, o.NPA, o.NPK), nil
+		case o.Costs != nil:
+			regTarg := NewRegretTarget(t)
+			regTarg.SetCosts(o.Costs)
+			return regTarg, nil
+		case o.DEntropy != nil:
+			deTarg := NewDEntropyTarget(t)
+			deTarg.SetCosts(o.DEntropy)
+			return deTarg, nil
+		case o.AdaCosts != nil:
+			acTarg := NewAdaCostTarget(t)
+			acTarg.SetCosts(o.AdaCosts)
+			return acTarg, nil
+		case o.RFWeights != nil:
+			return NewWRFTarget(t, o.RFWeights), nil
+		case o.Entropy:
+			return &EntropyTarget{t}, nil
+		case o.AdaBoost:
+			return NewAdaBoostTarget(t), nil
+		case o.Hellinger:
+			return NewHDistanceTarget(t, o.Positive), nil
+		case o.GradBoost != 0.0:
+			return NewGradBoostClassTarget(t, o.GradBoost, o.Positive), nil
+		}
+		return t, nil
+	}
+	return nil, fmt.Errorf("Can't grow a forest to predict %v.", targetf.GetName())
+}
+
+/*
+GrowForest grows a forest predicting the named target on the cases of fm that aren't missing it
+using the options in o. Unlike GrowRandomForest it supports the target, bagging, split,
+constraint, imputation and shuffling options of growforest. Trees are grown on a single core (so
+growforest's -multiboost doesn't apply) and fm isn't modified.
+*/
+func (o *GrowOptions) GrowForest(fm *FeatureMatrix, targetname string) (f *Forest, err error) {
+	return o.GrowForestOOB(fm, targetname, nil)
+}
+
+/*
+GrowForestOOB is GrowForest but if oob isn't nil each tree also votes in it on the cases that
+weren't in its bag so the out of bag error can be found. oob should be the length of fm and
+suited to the target as from NewBallotBox. Out of bag votes aren't meaningful for boosting.
+*/
+func (o *GrowOptions) GrowForestOOB(fm *FeatureMatrix, targetname string, oob VoteTallyer) (f *Forest, err error) {
+	targeti, ok := fm.Map[targetname]
+	if !ok {
+		return nil, fmt.Errorf("Target %v not found in data.", targetname)
+	}
+	if o.Oblique != "" && o.Oblique != "random" && o.Oblique != "lda" {
+		return nil, errors.New("Oblique must be random or lda.")
+	}
+	if o.Oblique != "" && (o.SplitMissing || o.Surrogates > 0 || o.Extra || o.EvalOOB || o.Vet || o.Force || o.Jungle) {
+		return nil, errors.New("Oblique splits can't be combined with SplitMissing, Surrogates, Extra, EvalOOB, Vet, Force or Jungle.")
+	}
+	candidates, err := o.Candidates(fm, targeti)
+	if err != nil {
+		return
+	}
+	if len(candidates) == 0 {
+		return nil, errors.New("No candidate features.")
+	}
+	if fm, err = o.workingData(fm, targeti); err != nil {
+		return
+	}
+
+	targetf := fm.Data[targeti].Copy()
+	nCases := targetf.Length()
+	nonmissing := NonMissingCases(targetf)
+	if len(nonmissing) == 0 {
+		return nil, errors.New("No cases with a non missing target.")
+	}
+	mTry, leafSize, nSamples := o.Resolve(len(candidates), len(nonmissing), targetf.NCats() == 0)
+
+	target, err := o.NewTarget(targetf)
+	if err != nil {
+		return
+	}
+
+	for name, constraint := range o.Monotone {
+		i, ok := fm.Map[name]
+		if targetf.NCats() != 0 || o.Oblique != "" || !ok || fm.Data[i].NCats() != 0 || (constraint != 1 && constraint != -1) {
+			return nil, fmt.Errorf("Invalid monotonicity constraint %v on %v.", constraint, name)
+		}
+	}
+
+	var bSampler Bagger
+	switch {
+	case o.BalanceBy != "":
+		catf, ok := targetf.(*DenseCatFeature)
+		var by *DenseCatFeature
+		if byi, found := fm.Map[o.BalanceBy]; found {
+			by, _ = fm.Data[byi].(*DenseCatFeature)
+		}
+		if !ok || by == nil {
+			return nil, fmt.Errorf("Balancing by %v requires a categorical target and feature.", o.BalanceBy)
+		}
+		bSampler = NewSecondaryBalancedSampler(catf, by)
+	case o.Balance:
+		catf, ok := targetf.(*DenseCatFeature)
+		if !ok {
+			return nil, errors.New("Balanced bagging requires a categorical target.")
+		}
+		bSampler = NewBalancedSampler(catf)
+	}
+
+	f = &Forest{targetname, make([]*Tree, 0, o.NTrees), 0.0, nil}
+	f.Metadata = NewForestMetadata(fm, targeti, candidates, o.resolvedOptions(mTry, leafSize, nSamples))
+	allocs := NewBestSplitAllocs(nSamples, target)
+	allocs.Monotone = o.Monotone
+
+	cases := make([]int, 0, nSamples)
+	for i := 0; i < o.NTrees; i++ {
+		cases = cases[0:0]
+		switch {
+		case o.NoBag && nSamples >= len(nonmissing):
+			cases = append(cases, nonmissing...)
+		case o.NoBag:
+			for _, j := range rand.Perm(len(nonmissing))[:nSamples] {
+				cases = append(cases, nonmissing[j])
+			}
+		case bSampler != nil:
+			bSampler.Sample(&cases, nSamples)
+		default:
+			for len(cases) < nSamples {
+				cases = append(cases, nonmissing[rand.Intn(len(nonmissing))])
+			}
+		}
+
+		var oobcases []int
+		if o.EvalOOB || oob != nil {
+			inbag := make([]bool, nCases)
+			for _, c := range cases {
+				inbag[c] = true
+			}
+			for _, c := range nonmissing {
+				if !inbag[c] {
+					oobcases = append(oobcases, c)
+				}
+			}
+		}
+
+		tree := NewTree()
+		tree.Target = targetname
+		switch {
+		case o.Oblique != "":
+			tree.GrowOblique(fm, target, cases, candidates, mTry, o.ObliqueFeatures, o.Oblique == "lda", leafSize, o.MaxDepth, nil, allocs)
+		case o.Jungle:
+			tree.GrowJungle(fm, target, cases, candidates, oobcases, mTry, leafSize, o.MaxDepth, o.SplitMissing, o.Force, o.Vet, o.EvalOOB, o.Extra, nil, nil, allocs)
+		default:
+			tree.Grow(fm, target, cases, candidates, oobcases, mTry, leafSize, o.MaxDepth, o.SplitMissing, o.Force, o.Vet, o.EvalOOB, o.Extra, o.Surrogates, nil, nil, allocs)
+		}
+
+		if boosting, ok := target.(BoostingTarget); ok {
+			ls, ps := tree.Partition(fm)
+			tree.Weight = boosting.Boost(ls, ps)
+			if tree.Weight == math.Inf(1) {
+				break
+			}
+		}
+		if oob != nil {
+			tree.VoteCases(fm, oob, oobcases)
+		}
+		f.Trees = append(f.Trees, tree)
+	}
+
+	if t, ok := target.(TargetWithIntercept); ok {
+		f.Intercept = t.Intercept()
+	}
+	if oob != nil && !o.Boosted() {
+		f.Metadata.OOB = map[string]float64{"error": oob.TallyError(fm.Data[targeti])}
+	}
+	return
+}
+
+/*
+workingData returns fm or, if Impute or ShuffleRE are set, a matrix sharing its unchanged features
+with copies of the ones that are changed so fm isn't modified. As in growforest features (including
+the target) are imputed to their mean or mode and then features other than the target matching
+ShuffleRE are shuffled.
+*/
+func (o *GrowOptions) workingData(fm *FeatureMatrix, targeti int) (*FeatureMatrix, error) {
+	if !o.Impute && o.ShuffleRE == "" {
+		return fm, nil
+	}
+	var shuffle *regexp.Regexp
+	if o.ShuffleRE != "" {
+		var err error
+		if shuffle, err = regexp.Compile(o.ShuffleRE); err != nil {
+			return nil, err
+		}
+	}
+	work := &FeatureMatrix{make([]Feature, len(fm.Data)), fm.Map, fm.CaseLabels}
+	for i, f := range fm.Data {
+		shuffled := shuffle != nil && i != targeti && shuffle.MatchString(f.GetName())
+		if (o.Impute && f.MissingVals()) || shuffled {
+			f = f.Copy()
+			if o.Impute {
+				f.ImputeMissing()
+			}
+			if shuffled {
+				f.Shuffle()
+			}
+		}
+		work.Data[i] = f
+	}
+	return work, nil
+}
+
+//resolvedOptions returns the options by json name with the inferred mTry, leafSize and nSamples
+//for ForestMetadata.
+func (o *GrowOptions) resolvedOptions(mTry int, leafSize int, nSamples int) map[string]interface{} {
+	options := make(map[string]interface{})
+	if encoded, err := json.Marshal(o); err == nil {
+		json.Unmarshal(encoded, &options)
+	}
+	options["mTry"] = fmt.Sprintf("%v", mTry)
+	options["leafSize"] = fmt.Sprintf("%v", leafSize)
+	options["nSamples"] = fmt.Sprintf("%v", nSamples)
+	return options
+}
+
+//NewBallotBox returns a ballot box of size cases suited to voting a forest grown with the
+//options to predict targetf: a SumBallotBox for gradient boosting, a NumBallotBox for other
+//regression and a CatBallotBox for classification.
+func (o *GrowOptions) NewBallotBox(targetf Feature, size int) VoteTallyer {
+	switch {
+	case o.GradBoost != 0.0:
+		return NewSumBallotBox(size)
+	case targetf.NCats() == 0:
+		return NewNumBallotBox(size)
+	}
+	return NewCatBallotBox(size)
+}
@@ -1,6 +1,7 @@
 package CloudForest
 
 import (
+	"math/rand"
 	"strings"
 	"testing"
 )
@@ -109,3 +110,172 @@ func TestImportance(t *testing.T) {
 	}
 
 }
+
+//growOOBForest grows nTrees on bootstrap samples and adds each tree's permutation importance.
+func growOOBForest(fm *FeatureMatrix, targeti int, candidates []int, mTry int, nTrees int, imp *[]*RunningMean, classImp []*[]*RunningMean) {
+	target := fm.Data[targeti]
+	ncases := target.Length()
+	allocs := NewBestSplitAllocs(ncases, target)
+	cases := make([]int, 0, ncases)
+	oob := make([]int, 0, ncases)
+	inbag := make([]bool, ncases)
+	for i := 0; i < nTrees; i++ {
+		cases = cases[0:0]
+		for len(cases) < ncases {
+			c := allocs.Rnd.Intn(ncases)
+			cases = append(cases, c)
+			inbag[c] = true
+		}
+		oob = oob[0:0]
+		for c := 0; c < ncases; c++ {
+			if !inbag[c] {
+				oob = append(oob, c)
+			}
+			inbag[c] = false
+		}
+		tree := NewTree()
+		tree.Grow(fm, target.(Target), cases, candidates, oob, mTry, 1, 0, false, false, false, false, false, 0, nil, nil, allocs)
+		tree.PermutationImportance(fm, target, oob, candidates, allocs, imp, classImp)
+	}
+}
+
+func TestPermutationImportance(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping permutation importance test on boston and iris data sets.")
+	}
+	nTrees := 20
+
+	fm := ParseARFF(strings.NewReader(boston_housing))
+	fm.ContrastAll()
+	targeti := fm.Map["class"]
+	candidates := make([]int, 0, len(fm.Data))
+	for i := 0; i < len(fm.Data); i++ {
+		if i != targeti {
+			candidates = append(candidates, i)
+		}
+	}
+
+	imppnt := NewRunningMeans(len(fm.Data))
+	growOOBForest(fm, targeti, candidates, 6, nTrees, imppnt, nil)
+
+	roomimp, count := (*imppnt)[fm.Map["RM"]].Read()
+	lstatimp, _ := (*imppnt)[fm.Map["LSTAT"]].Read()
+	if count != float64(nTrees) {
+		t.Errorf("RM permutation importance recorded for %v trees not %v.", count, nTrees)
+	}
+	beatlstat := 0
+	beatroom := 0
+	for _, rm := range *imppnt {
+		fimp, _ := rm.Read()
+		if fimp > roomimp {
+			beatroom++
+		}
+		if fimp > lstatimp {
+			beatlstat++
+		}
+	}
+	if beatroom > 1 || beatlstat > 1 {
+		t.Error("RM and LSTAT features not most important by permutation in boston data set regression.")
+	}
+	if shuffledimp, _ := (*imppnt)[fm.Map["RM:SHUFFLED"]].Read(); shuffledimp >= roomimp {
+		t.Errorf("Shuffled RM had permutation importance %v not less then RM's %v.", shuffledimp, roomimp)
+	}
+
+	//per class importance
+	fm = ParseLibSVM(strings.NewReader(irislibsvm))
+	candidates = []int{1, 2, 3, 4}
+	imppnt = NewRunningMeans(len(fm.Data))
+	classImp := make([]*[]*RunningMean, 0, len(fm.Data))
+	for i := 0; i < len(fm.Data); i++ {
+		classImp = append(classImp, NewRunningMeans(fm.Data[0].NCats()))
+	}
+	growOOBForest(fm, 0, candidates, 2, nTrees, imppnt, classImp)
+
+	best := 1
+	bestimp := 0.0
+	for _, i := range candidates {
+		fimp, _ := (*imppnt)[i].Read()
+		if fimp > bestimp {
+			best = i
+			bestimp = fimp
+		}
+	}
+	if bestimp <= 0.0 {
+		t.Errorf("No iris feature had positive permutation importance.")
+	}
+	sum := 0.0
+	for k, rm := range *classImp[best] {
+		ci, count := rm.Read()
+		if count != float64(nTrees) {
+			t.Errorf("Class %v importance recorded for %v trees not %v.", k, count, nTrees)
+		}
+		sum += ci
+	}
+	if sum <= 0.0 {
+		t.Errorf("Most important iris feature had per class importances summing to %v.", sum)
+	}
+}
+
+func TestConditionalPermutationImportance(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping conditional permutation importance test.")
+	}
+
+	//y depends on x1 only. x2 is a noisy copy of x1 and x3 is noise.
+	ncases := 300
+	rnd := rand.New(rand.NewSource(1))
+	fm := syntheticAFM(rnd, ncases, []string{"N:y", "N:x1", "N:x2", "N:x3"}, func(i int, rnd *rand.Rand) []interface{} {
+		x1 := rnd.Float64()
+		x2 := x1 + 0.1*rnd.NormFloat64()
+		y := x1 + 0.1*rnd.NormFloat64()
+		return []interface{}{y, x1, x2, rnd.Float64()}
+	})
+
+	if a := fm.Association(1, 2); a < 0.8 {
+		t.Errorf("Association of x1 and x2 was %v.", a)
+	}
+	if a := fm.Association(1, 3); a > 0.3 {
+		t.Errorf("Association of x1 and x3 was %v.", a)
+	}
+
+	candidates := []int{1, 2, 3}
+	target := fm.Data[0]
+	allocs := NewBestSplitAllocs(ncases, target)
+	forest := &Forest{Target: "N:y"}
+	oob := make([][]int, 0)
+	marginal := NewRunningMeans(len(fm.Data))
+	for i := 0; i < 20; i++ {
+		cases := make([]int, 0, ncases)
+		inbag := make([]bool, ncases)
+		for len(cases) < ncases {
+			c := rnd.Intn(ncases)
+			cases = append(cases, c)
+			inbag[c] = true
+		}
+		treeoob := make([]int, 0)
+		for c, in := range inbag {
+			if !in {
+				treeoob = append(treeoob, c)
+			}
+		}
+		tree := NewTree()
+		tree.Grow(fm, target, cases, candidates, treeoob, 1, 4, 0, false, false, false, false, false, 0, nil, nil, allocs)
+		tree.PermutationImportance(fm, target, treeoob, candidates, allocs, marginal, nil)
+		forest.Trees = append(forest.Trees, tree)
+		oob = append(oob, treeoob)
+	}
+
+	conditional := forest.ConditionalPermutationImportance(fm, target, oob, candidates, 0.5)
+	x1, _ := (*conditional)[1].Read()
+	x2, count := (*conditional)[2].Read()
+	mx2, _ := (*marginal)[2].Read()
+	if count != 20.0 {
+		t.Errorf("Conditional importance recorded for %v trees not 20.", count)
+	}
+	if x2 >= x1 {
+		t.Errorf("Conditional importance of correlated x2 %v not less then x1 %v.", x2, x1)
+	}
+	if x2 >= mx2 {
+		t.Errorf("Conditional importance of correlated x2 %v not less then its marginal importance %v.", x2, mx2)
+	}
+}
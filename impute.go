@@ -0,0 +1,394 @@
+package CloudForest
+
+import (
+	"errors"
+	"github.com/ryanbressler/CloudForest/sortby"
+	"math"
+	"math/rand"
+)
+
+//ProximityImputationTrees is the number of trees ImputeByProximity grows in each iteration.
+const ProximityImputationTrees = 100
+
+/*
+ImputeByProximity imputes missing values using Breiman's proximity weighted method (as in R's
+rfImpute). Missing values are first imputed to the feature mean or mode. Then, for each of the
+specified number of iterations, a forest of ProximityImputationTrees trees is grown to predict the
+named target and each missing value is replaced by the proximity weighted mean (numerical
+features) or the category with the largest total proximity (categorical features) over the cases
+where the value was originally present.
+
+The proximity between two cases is the number of trees in which they share a leaf as found by
+Tree.GetLeaves. Cases missing the target are not used to grow trees and the target itself is not
+imputed.
+*/
+func (fm *FeatureMatrix) ImputeByProximity(targetn string, iterations int) (err error) {
+	return fm.ImputeByProximityTrees(targetn, ProximityImputationTrees, iterations)
+}
+
+//ImputeByProximityTrees is ImputeByProximity growing forests of nTrees trees (as set by the -nTrees
+//option of growforest and nfold).
+func (fm *FeatureMatrix) ImputeByProximityTrees(targetn string, nTrees int, iterations int) (err error) {
+	targeti, ok := fm.Map[targetn]
+	if !ok {
+		err = errors.New("Target not found in feature matrix.")
+		return
+	}
+	targetf := fm.Data[targeti]
+	ncases := targetf.Length()
+
+	//Record which values were missing and set up a proximity row for each case
+	//that has any missing value.
+	missing := make([][]int, len(fm.Data))
+	present := make([][]bool, len(fm.Data))
+	prox := make(map[int][]float64)
+	for i, f := range fm.Data {
+		if i == targeti || !f.MissingVals() {
+			continue
+		}
+		present[i] = make([]bool, ncases)
+		for c := 0; c < ncases; c++ {
+			if f.IsMissing(c) {
+				missing[i] = append(missing[i], c)
+				prox[c] = nil
+			} else {
+				present[i][c] = true
+			}
+		}
+	}
+	if len(prox) == 0 {
+		return
+	}
+	for c := range prox {
+		prox[c] = make([]float64, ncases)
+	}
+
+	for i, f := range fm.Data {
+		if missing[i] != nil {
+			f.ImputeMissing()
+		}
+	}
+
+	candidates := make([]int, 0, len(fm.Data))
+	for i := range fm.Data {
+		if i != targeti {
+			candidates = append(candidates, i)
+		}
+	}
+	trainable := make([]int, 0, ncases)
+	for c := 0; c < ncases; c++ {
+		if !targetf.IsMissing(c) {
+			trainable = append(trainable, c)
+		}
+	}
+
+	mTry := int(math.Ceil(math.Sqrt(float64(len(candidates)))))
+	leafSize := 1
+	if targetf.NCats() == 0 {
+		leafSize = 4
+	}
+	target := targetf.(Target)
+	allocs := NewBestSplitAllocs(len(trainable), target)
+	cases := make([]int, 0, len(trainable))
+
+	for iter := 0; iter < iterations; iter++ {
+		for _, row := range prox {
+			for j := range row {
+				row[j] = 0.0
+			}
+		}
+
+		for t := 0; t < nTrees; t++ {
+			cases = cases[0:0]
+			for len(cases) < len(trainable) {
+				cases = append(cases, trainable[rand.Intn(len(trainable))])
+			}
+			tree := NewTree()
+			tree.Grow(fm, target, cases, candidates, nil, mTry, leafSize, 0, false, false, false, false, false, 0, nil, nil, allocs)
+
+			for _, leaf := range tree.GetLeaves(fm, nil) {
+				for _, i := range leaf.Cases {
+					if row, ok := prox[i]; ok {
+						for _, j := range leaf.Cases {
+							row[j]++
+						}
+					}
+				}
+			}
+		}
+
+		for i, cs := range missing {
+			switch fm.Data[i].(type) {
+			case NumFeature:
+				f := fm.Data[i].(NumFeature)
+				for _, c := range cs {
+					row := prox[c]
+					sum := 0.0
+					weight := 0.0
+					for j, p := range row {
+						if p > 0 && j != c && present[i][j] {
+							sum += p * f.Get(j)
+							weight += p
+						}
+					}
+					if weight > 0 {
+						f.Put(c, sum/weight)
+					}
+				}
+			case CatFeature:
+				f := fm.Data[i].(CatFeature)
+				votes := make([]float64, f.NCats())
+				for _, c := range cs {
+					row := prox[c]
+					for k := range votes {
+						votes[k] = 0.0
+					}
+					for j, p := range row {
+						if p > 0 && j != c && present[i][j] {
+							votes[f.Geti(j)] += p
+						}
+					}
+					best := -1
+					bestvotes := 0.0
+					for k, v := range votes {
+						if v > bestvotes {
+							best = k
+							bestvotes = v
+						}
+					}
+					if best >= 0 {
+						f.Puti(c, best)
+					}
+				}
+			}
+		}
+	}
+	return
+}
+
+//ImputationError records the out of bag error of the forest last used to impute a feature
+//by ImputeByForest. Error is the mean squared error divided by the variance of the observed
+//values (1-R^2) for numerical features and the proportion of cases falsely classified for
+//categorical features.
+type ImputationError struct {
+	Feature  string
+	NMissing int
+	Error    float64
+}
+
+/*
+ImputeByForest imputes the missing values in all features using the iterative, unsupervised
+MissForest method of Stekhoven and Buhlmann. Missing values are first imputed to the feature
+mean or mode. Then, in order of increasing number of missing values, a forest of nTrees is
+grown to predict each feature with missing values from all of the others using the cases for
+which it was observed and the missing values are replaced by the forest's predictions.
+Features whose index is true in exclude (which may be nil) are neither used as predictors nor
+imputed.
+
+This is repeated until the total change in the imputed values increases or maxIterations is
+reached. The imputations from the last iteration before the change increased are kept and
+the out of bag error of the forest used to make them is returned for each imputed feature.
+*/
+func (fm *FeatureMatrix) ImputeByForest(nTrees int, maxIterations int, exclude []bool) (errs []*ImputationError) {
+	ncases := fm.Data[0].Length()
+
+	order := make([]int, 0, len(fm.Data))
+	nmissing := make([]float64, 0, len(fm.Data))
+	missing := make([][]int, len(fm.Data))
+	observed := make([][]int, len(fm.Data))
+	nNum, nCat := 0, 0
+	for i, f := range fm.Data {
+		if !f.MissingVals() || (exclude != nil && exclude[i]) {
+			continue
+		}
+		for c := 0; c < ncases; c++ {
+			if f.IsMissing(c) {
+				missing[i] = append(missing[i], c)
+			} else {
+				observed[i] = append(observed[i], c)
+			}
+		}
+		if len(missing[i]) == 0 || len(observed[i]) == 0 {
+			continue
+		}
+		order = append(order, i)
+		nmissing = append(nmissing, float64(len(missing[i])))
+		if f.NCats() == 0 {
+			nNum++
+		} else {
+			nCat++
+		}
+	}
+	sortby.SortBy(&order, &nmissing)
+
+	errs = make([]*ImputationError, 0, len(order))
+	for _, i := range order {
+		errs = append(errs, &ImputationError{fm.Data[i].GetName(), len(missing[i]), 0.0})
+	}
+	if len(order) == 0 {
+		return
+	}
+
+	for _, i := range order {
+		fm.Data[i].ImputeMissing()
+	}
+
+	last := make([][]string, len(fm.Data))
+	lastErrs := make([]float64, len(order))
+	prevDiffN := math.Inf(1)
+	prevDiffC := math.Inf(1)
+
+	for iter := 0; iter < maxIterations; iter++ {
+		for k, i := range order {
+			f := fm.Data[i]
+			last[i] = last[i][0:0]
+			for _, c := range missing[i] {
+				last[i] = append(last[i], f.GetStr(c))
+			}
+			lastErrs[k] = errs[k].Error
+			errs[k].Error = fm.imputeFeatureByForest(i, observed[i], missing[i], nTrees, exclude)
+		}
+
+		//Measure the change in the imputed values as in MissForest.
+		var numDiff, numSize, catDiff, catSize float64
+		for _, i := range order {
+			f := fm.Data[i]
+			for j, c := range missing[i] {
+				switch f.NCats() {
+				case 0:
+					v := f.(NumFeature).Get(c)
+					d := v - ParseFloat(last[i][j])
+					numDiff += d * d
+					numSize += v * v
+				default:
+					if f.GetStr(c) != last[i][j] {
+						catDiff++
+					}
+					catSize++
+				}
+			}
+		}
+		diffN := 0.0
+		if numSize > 0 {
+			diffN = numDiff / numSize
+		}
+		diffC := 0.0
+		if catSize > 0 {
+			diffC = catDiff / catSize
+		}
+
+		if iter > 0 && (nNum == 0 || diffN >= prevDiffN) && (nCat == 0 || diffC >= prevDiffC) {
+			//The imputation stopped improving so restore the previous one.
+			for k, i := range order {
+				f := fm.Data[i]
+				for j, c := range missing[i] {
+					f.PutStr(c, last[i][j])
+				}
+				errs[k].Error = lastErrs[k]
+			}
+			break
+		}
+		prevDiffN = diffN
+		prevDiffC = diffC
+	}
+	return
+}
+
+//imputeFeatureByForest grows a forest to predict the feature at index fi from the observed
+//cases using the features not in exclude, replaces the values of the missing cases with its
+//predictions and returns its out of bag error.
+func (fm *FeatureMatrix) imputeFeatureByForest(fi int, observed []int, missing []int, nTrees int, exclude []bool) (e float64) {
+	f := fm.Data[fi]
+	ncases := f.Length()
+	target := f.(Target)
+
+	candidates := make([]int, 0, len(fm.Data))
+	for i := range fm.Data {
+		if i != fi && (exclude == nil || !exclude[i]) {
+			candidates = append(candidates, i)
+		}
+	}
+	if len(candidates) == 0 {
+		return
+	}
+	mTry := int(math.Ceil(math.Sqrt(float64(len(candidates)))))
+	leafSize := 1
+
+	var votes, oobVotes VoteTallyer
+	if f.NCats() == 0 {
+		leafSize = 4
+		votes = NewNumBallotBox(ncases)
+		oobVotes = NewNumBallotBox(ncases)
+	} else {
+		votes = NewCatBallotBox(ncases)
+		oobVotes = NewCatBallotBox(ncases)
+	}
+
+	allocs := NewBestSplitAllocs(len(observed), target)
+	cases := make([]int, 0, len(observed))
+	oob := make([]int, 0, len(observed))
+	tovote := make([]int, len(missing))
+	inbag := make([]bool, ncases)
+	for t := 0; t < nTrees; t++ {
+		cases = cases[0:0]
+		for len(cases) < len(observed) {
+			c := observed[rand.Intn(len(observed))]
+			cases = append(cases, c)
+			inbag[c] = true
+		}
+		oob = oob[0:0]
+		for _, c := range observed {
+			if !inbag[c] {
+				oob = append(oob, c)
+			}
+			inbag[c] = false
+		}
+
+		tree := NewTree()
+		tree.Grow(fm, target, cases, candidates, nil, mTry, leafSize, 0, false, false, false, false, false, 0, nil, nil, allocs)
+
+		tree.VoteCases(fm, oobVotes, oob)
+		copy(tovote, missing)
+		tree.VoteCases(fm, votes, tovote)
+	}
+
+	//out of bag error
+	n := 0.0
+	switch f.NCats() {
+	case 0:
+		nf := f.(NumFeature)
+		mean := nf.Mean(&observed)
+		variance := 0.0
+		for _, c := range observed {
+			d := nf.Get(c) - mean
+			variance += d * d
+			if pred := oobVotes.Tally(c); pred != "NA" {
+				d = nf.Get(c) - ParseFloat(pred)
+				e += d * d
+				n++
+			}
+		}
+		if n > 0 && variance > 0 {
+			e = (e / n) / (variance / float64(len(observed)))
+		}
+	default:
+		for _, c := range observed {
+			if pred := oobVotes.Tally(c); pred != "NA" {
+				if pred != f.GetStr(c) {
+					e++
+				}
+				n++
+			}
+		}
+		if n > 0 {
+			e /= n
+		}
+	}
+
+	for _, c := range missing {
+		if pred := votes.Tally(c); pred != "NA" {
+			f.PutStr(c, pred)
+		}
+	}
+	return
+}
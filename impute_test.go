@@ -0,0 +1,110 @@
+package CloudForest
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestImputeByProximity(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping proximity imputation test on boston data set.")
+	}
+
+	fm := ParseARFF(strings.NewReader(boston_housing))
+	meanfm := ParseARFF(strings.NewReader(boston_housing))
+	rm := fm.Data[fm.Map["RM"]].(*DenseNumFeature)
+	truth := rm.Copy().(*DenseNumFeature)
+
+	//Remove one fifth of the values of an important feature.
+	removed := make([]int, 0)
+	for i := 0; i < rm.Length(); i++ {
+		if rand.Intn(5) == 0 {
+			removed = append(removed, i)
+			rm.PutMissing(i)
+			meanfm.Data[meanfm.Map["RM"]].PutMissing(i)
+		}
+	}
+
+	err := fm.ImputeByProximityTrees("class", 50, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meanfm.ImputeMissing()
+
+	if rm.MissingVals() {
+		t.Error("Feature still has missing values after proximity imputation.")
+	}
+
+	mse := func(f *DenseNumFeature) (e float64) {
+		for _, i := range removed {
+			d := f.Get(i) - truth.Get(i)
+			e += d * d
+		}
+		return e / float64(len(removed))
+	}
+	proxerr := mse(rm)
+	meanerr := mse(meanfm.Data[meanfm.Map["RM"]].(*DenseNumFeature))
+	if proxerr >= meanerr {
+		t.Errorf("Proximity imputation error %v not lower then mean imputation error %v.", proxerr, meanerr)
+	}
+
+	if err = fm.ImputeByProximity("N:NotAFeature", 1); err == nil {
+		t.Error("Proximity imputation with missing target didn't return an error.")
+	}
+
+}
+
+func TestImputeByForest(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping forest imputation test on boston data set.")
+	}
+
+	fm := ParseARFF(strings.NewReader(boston_housing))
+	meanfm := ParseARFF(strings.NewReader(boston_housing))
+	rm := fm.Data[fm.Map["RM"]].(*DenseNumFeature)
+	truth := rm.Copy().(*DenseNumFeature)
+
+	removed := make([]int, 0)
+	for i := 0; i < rm.Length(); i++ {
+		if rand.Intn(5) == 0 {
+			removed = append(removed, i)
+			rm.PutMissing(i)
+			meanfm.Data[meanfm.Map["RM"]].PutMissing(i)
+		}
+	}
+
+	//An excluded feature is left missing.
+	crim := fm.Map["CRIM"]
+	fm.Data[crim].PutMissing(0)
+	exclude := make([]bool, len(fm.Data))
+	exclude[crim] = true
+
+	errs := fm.ImputeByForest(20, 5, exclude)
+	meanfm.ImputeMissing()
+
+	if len(errs) != 1 || errs[0].Feature != "RM" || errs[0].NMissing != len(removed) {
+		t.Fatalf("Forest imputation reported unexpected features: %v", errs)
+	}
+	if errs[0].Error <= 0.0 || errs[0].Error >= 1.0 {
+		t.Errorf("Forest imputation oob error %v not between 0 and 1.", errs[0].Error)
+	}
+	if rm.MissingVals() {
+		t.Error("Feature still has missing values after forest imputation.")
+	}
+	if !fm.Data[crim].IsMissing(0) {
+		t.Error("Excluded feature imputed.")
+	}
+
+	var foresterr, meanerr float64
+	meanrm := meanfm.Data[meanfm.Map["RM"]].(*DenseNumFeature)
+	for _, i := range removed {
+		d := rm.Get(i) - truth.Get(i)
+		foresterr += d * d
+		d = meanrm.Get(i) - truth.Get(i)
+		meanerr += d * d
+	}
+	if foresterr >= meanerr {
+		t.Errorf("Forest imputation error %v not lower then mean imputation error %v.", foresterr, meanerr)
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/ryanbressler/CloudForest"
+	"io"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strings"
+)
+
+//featureSplits tabulates the splits made on a single feature.
+type featureSplits struct {
+	Count       int
+	Numerical   int
+	Categorical int
+	Trees       int
+	Thresholds  []float64
+}
+
+//treeStats summarizes the structure of a single tree.
+type treeStats struct {
+	Depth       int
+	Nodes       int
+	Leaves      int
+	Numerical   int
+	Categorical int
+	Weight      float64
+}
+
+func inspect(tree *CloudForest.Tree, features map[string]*featureSplits) (ts *treeStats) {
+	ts = &treeStats{Weight: tree.Weight}
+	used := make(map[string]bool)
+	tree.Root.Climb(func(n *CloudForest.Node) {
+		ts.Nodes++
+		if n.Splitter == nil {
+			ts.Leaves++
+			return
+		}
+		fs, ok := features[n.Splitter.Feature]
+		if !ok {
+			fs = new(featureSplits)
+			features[n.Splitter.Feature] = fs
+		}
+		fs.Count++
+		if !used[n.Splitter.Feature] {
+			fs.Trees++
+			used[n.Splitter.Feature] = true
+		}
+		if n.Splitter.Numerical {
+			ts.Numerical++
+			fs.Numerical++
+			fs.Thresholds = append(fs.Thresholds, n.Splitter.Value)
+		} else {
+			ts.Categorical++
+			fs.Categorical++
+		}
+	})
+
+	var depth func(n *CloudForest.Node, d int)
+	depth = func(n *CloudForest.Node, d int) {
+		if d > ts.Depth {
+			ts.Depth = d
+		}
+		for _, child := range []*CloudForest.Node{n.Left, n.Right, n.Missing} {
+			if n.Splitter != nil && child != nil {
+				depth(child, d+1)
+			}
+		}
+	}
+	depth(tree.Root, 0)
+	return
+}
+
+//quantile returns the q quantile of sorted values.
+func quantile(sorted []float64, q float64) float64 {
+	if len(sorted) == 0 {
+		return math.NaN()
+	}
+	return sorted[int(math.Floor(q*float64(len(sorted)-1)))]
+}
+
+//summary returns the min, mean and max of values.
+func summary(values []float64) (min, mean, max float64) {
+	min = math.Inf(1)
+	max = math.Inf(-1)
+	for _, v := range values {
+		mean += v
+		min = math.Min(min, v)
+		max = math.Max(max, v)
+	}
+	mean /= float64(len(values))
+	return
+}
+
+func main() {
+	rf := flag.String("rfpred",
+		"rface.sf", "A predictor forest.")
+	treesfn := flag.String("trees",
+		"", "File to write a tsv of depth, node, leaf and split counts and weight of each tree to.")
+	featuresfn := flag.String("features",
+		"", "File to write a tsv of split counts and threshold distribution for each feature to.")
+	var treei int
+	flag.IntVar(&treei, "tree", -1, "Index of a single tree to render.")
+	format := flag.String("format",
+		"text", "Format to render the tree specified by -tree in: text or dot.")
+	renderfn := flag.String("render",
+		"", "File to render the tree specified by -tree to. Defaults to stdout.")
+
+	flag.Parse()
+
+	forestfile, err := os.Open(*rf) // For read access.
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer forestfile.Close()
+	forestreader := CloudForest.NewForestReader(forestfile)
+
+	features := make(map[string]*featureSplits)
+	trees := make([]*treeStats, 0)
+	target := ""
+	for {
+		tree, forest, err := forestreader.ReadTree()
+		if forest != nil {
+			target = forest.Target
+		}
+		if tree != nil {
+			if target == "" {
+				target = tree.Target
+			}
+			if len(trees) == treei {
+				render(tree, treei, *format, *renderfn)
+			}
+			trees = append(trees, inspect(tree, features))
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if treei >= len(trees) {
+		log.Fatalf("Tree %v not found in forest with %v trees.", treei, len(trees))
+	}
+
+	//Forest summary
+	depths := make([]float64, 0, len(trees))
+	nodes := make([]float64, 0, len(trees))
+	leaves := make([]float64, 0, len(trees))
+	weights := make([]float64, 0, len(trees))
+	numerical, categorical := 0, 0
+	for _, ts := range trees {
+		depths = append(depths, float64(ts.Depth))
+		nodes = append(nodes, float64(ts.Nodes))
+		leaves = append(leaves, float64(ts.Leaves))
+		if ts.Weight >= 0.0 {
+			weights = append(weights, ts.Weight)
+		}
+		numerical += ts.Numerical
+		categorical += ts.Categorical
+	}
+	fmt.Printf("Target : %v\n", target)
+	if m := forestreader.Metadata(); m != nil {
+		fmt.Printf("CloudForest version : %v\n", m.Version)
+		fmt.Printf("Trained : %v\n", m.Timestamp)
+		fmt.Printf("Training features : %v\n", len(m.Features))
+		if m.Target != nil && m.Target.Type == "categorical" {
+			fmt.Printf("Target levels : %v\n", strings.Join(m.Target.Levels, ", "))
+		}
+		names := make([]string, 0, len(m.OOB))
+		for name := range m.OOB {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("OOB %v : %v\n", name, m.OOB[name])
+		}
+	}
+	fmt.Printf("Trees : %v\n", len(trees))
+	if len(trees) > 0 {
+		min, mean, max := summary(depths)
+		fmt.Printf("Depth (min/mean/max) : %v / %v / %v\n", min, mean, max)
+		min, mean, max = summary(nodes)
+		fmt.Printf("Nodes (min/mean/max) : %v / %v / %v\n", min, mean, max)
+		min, mean, max = summary(leaves)
+		fmt.Printf("Leaves (min/mean/max) : %v / %v / %v\n", min, mean, max)
+	}
+	fmt.Printf("Splits : %v numerical, %v categorical\n", numerical, categorical)
+	fmt.Printf("Features used : %v\n", len(features))
+	if len(weights) > 0 {
+		min, mean, max := summary(weights)
+		sort.Float64s(weights)
+		fmt.Printf("Weights (min/q1/median/q3/max) : %v / %v / %v / %v / %v, mean %v\n", min, quantile(weights, .25), quantile(weights, .5), quantile(weights, .75), max, mean)
+	} else {
+		fmt.Println("Weights : unweighted")
+	}
+
+	if *treesfn != "" {
+		treesfile, err := os.Create(*treesfn)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer treesfile.Close()
+		fmt.Fprintln(treesfile, "Tree\tDepth\tNodes\tLeaves\tNumerical Splits\tCategorical Splits\tWeight")
+		for i, ts := range trees {
+			fmt.Fprintf(treesfile, "%v\t%v\t%v\t%v\t%v\t%v\t%v\n", i, ts.Depth, ts.Nodes, ts.Leaves, ts.Numerical, ts.Categorical, ts.Weight)
+		}
+	}
+
+	if *featuresfn != "" {
+		featuresfile, err := os.Create(*featuresfn)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer featuresfile.Close()
+		names := make([]string, 0, len(features))
+		for name := range features {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Fprintln(featuresfile, "Feature\tSplits\tNumerical Splits\tCategorical Splits\tTrees Used\tMin Threshold\tQ1 Threshold\tMedian Threshold\tQ3 Threshold\tMax Threshold")
+		for _, name := range names {
+			fs := features[name]
+			sort.Float64s(fs.Thresholds)
+			fmt.Fprintf(featuresfile, "%v\t%v\t%v\t%v\t%v", name, fs.Count, fs.Numerical, fs.Categorical, fs.Trees)
+			for _, q := range []float64{0, .25, .5, .75, 1} {
+				if len(fs.Thresholds) == 0 {
+					fmt.Fprint(featuresfile, "\tNA")
+				} else {
+					fmt.Fprintf(featuresfile, "\t%v", quantile(fs.Thresholds, q))
+				}
+			}
+			fmt.Fprint(featuresfile, "\n")
+		}
+	}
+}
+
+//render writes a single tree as text or dot.
+func render(tree *CloudForest.Tree, treei int, format string, renderfn string) {
+	var w io.Writer = os.Stdout
+	if renderfn != "" {
+		renderfile, err := os.Create(renderfn)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer renderfile.Close()
+		w = renderfile
+	}
+	switch format {
+	case "dot":
+		tree.WriteDOT(w, fmt.Sprintf("tree%v", treei))
+	case "text":
+		tree.WriteText(w)
+	default:
+		log.Fatalf("Unknown tree format %v.", format)
+	}
+}
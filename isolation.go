@@ -0,0 +1,173 @@
+package CloudForest
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+/*
+GrowIsolation grows an isolation tree (Liu, Ting and Zhou "Isolation Forest") on the specified
+cases, normally a small subsample of the data taken without replacement. No target is used: each
+node splits on a feature chosen at random from the candidates that aren't constant on its cases
+using a threshold drawn uniformly between the minimum and maximum of a numerical feature or a
+random subset of the categories present for a categorical feature. Cases missing the feature are
+sent left or right at random in proportion to the number of cases going each way so that missing
+values don't isolate cases.
+
+Nodes are split until they hold a single case or reach maxDepth (ignored if <= 0). The Cover of
+each node is set to its number of cases and leaves predict it (as a string) so path lengths can
+be adjusted for the cases left unisolated. rnd is the source of randomness so trees can be grown
+in parallel.
+*/
+func (t *Tree) GrowIsolation(fm *FeatureMatrix, cases []int, candidates []int, maxDepth int, rnd *rand.Rand) {
+	var grow func(n *Node, cases []int, depth int)
+	grow = func(n *Node, cases []int, depth int) {
+		n.Cover = float64(len(cases))
+		n.Pred = fmt.Sprintf("%v", len(cases))
+		if len(cases) < 2 || (maxDepth > 0 && depth >= maxDepth) {
+			return
+		}
+		for _, k := range rnd.Perm(len(candidates)) {
+			fi := candidates[k]
+			s := isolationSplitter(fm.Data[fi], cases, rnd)
+			if s == nil {
+				continue
+			}
+			n.Splitter = s
+			n.Featurei = fi
+			n.Pred = ""
+			l, r, m := s.Split(fm, cases)
+			if len(m) > 0 {
+				l = append([]int(nil), l...)
+				r = append([]int(nil), r...)
+				nl := len(l)
+				for _, c := range m {
+					if rnd.Intn(nl+len(r)) < nl {
+						l = append(l, c)
+					} else {
+						r = append(r, c)
+					}
+				}
+			}
+			n.Left = new(Node)
+			n.Right = new(Node)
+			grow(n.Left, l, depth+1)
+			grow(n.Right, r, depth+1)
+			return
+		}
+	}
+	if t.Root == nil {
+		t.Root = new(Node)
+	}
+	grow(t.Root, append([]int(nil), cases...), 0)
+}
+
+//isolationSplitter returns a random split of the non missing values of f over cases or nil if
+//they are constant.
+func isolationSplitter(f Feature, cases []int, rnd *rand.Rand) *Splitter {
+	if f.NCats() == 0 {
+		nf := f.(NumFeature)
+		min, max := math.Inf(1), math.Inf(-1)
+		for _, c := range cases {
+			if !f.IsMissing(c) {
+				min = math.Min(min, nf.Get(c))
+				max = math.Max(max, nf.Get(c))
+			}
+		}
+		if !(max > min) {
+			return nil
+		}
+		return &Splitter{f.GetName(), true, min + rnd.Float64()*(max-min), nil, nil, nil}
+	}
+
+	present := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, c := range cases {
+		if !f.IsMissing(c) && !seen[f.GetStr(c)] {
+			seen[f.GetStr(c)] = true
+			present = append(present, f.GetStr(c))
+		}
+	}
+	if len(present) < 2 {
+		return nil
+	}
+	left := make(map[string]bool)
+	order := rnd.Perm(len(present))
+	for _, k := range order[:1+rnd.Intn(len(present)-1)] {
+		left[present[k]] = true
+	}
+	return &Splitter{f.GetName(), false, 0.0, left, nil, nil}
+}
+
+/*
+AveragePathLength returns the average path length of an unsuccessful search in a binary search
+tree of n cases, c(n) = 2H(n-1) - 2(n-1)/n, which is used to normalize isolation depths and to
+adjust for the cases left at a leaf.
+*/
+func AveragePathLength(n float64) float64 {
+	switch {
+	case n <= 1:
+		return 0.0
+	case n <= 2:
+		return 1.0
+	}
+	return 2.0*(math.Log(n-1.0)+0.5772156649015329) - 2.0*(n-1.0)/n
+}
+
+/*
+IsolationDepth returns the path length of case c in fm in an isolation tree: the number of edges
+followed to a leaf plus AveragePathLength of the leaf's Cover. A case missing a splitting feature
+follows both branches and its path length is the mean of theirs weighted by their Cover.
+*/
+func (t *Tree) IsolationDepth(fm *FeatureMatrix, c int) float64 {
+	return t.Root.isolationDepth(fm, c)
+}
+
+func (n *Node) isolationDepth(fm *FeatureMatrix, c int) float64 {
+	if n.Splitter == nil || n.Left == nil || n.Right == nil {
+		return AveragePathLength(n.Cover)
+	}
+	f := fm.Data[fm.Map[n.Splitter.Feature]]
+	switch {
+	case !f.IsMissing(c) && f.GoesLeft(c, n.Splitter):
+		return 1.0 + n.Left.isolationDepth(fm, c)
+	case !f.IsMissing(c):
+		return 1.0 + n.Right.isolationDepth(fm, c)
+	}
+	cover := n.Left.Cover + n.Right.Cover
+	if cover == 0 {
+		return AveragePathLength(n.Cover)
+	}
+	return 1.0 + (n.Left.Cover*n.Left.isolationDepth(fm, c)+n.Right.Cover*n.Right.isolationDepth(fm, c))/cover
+}
+
+/*
+AnomalyScores returns the isolation forest anomaly score and mean path length of every case in
+fm. The score is 2^(-E(h)/c(psi)) where E(h) is the mean IsolationDepth over the trees and psi the
+mean number of cases the trees were grown on (the Cover of their roots). Scores near 1 indicate
+anomalies while scores well below 0.5 indicate normal cases.
+*/
+func (f *Forest) AnomalyScores(fm *FeatureMatrix) (scores []float64, depths []float64) {
+	nCases := fm.Data[0].Length()
+	scores = make([]float64, nCases)
+	depths = make([]float64, nCases)
+	if len(f.Trees) == 0 {
+		return
+	}
+	psi := 0.0
+	for _, t := range f.Trees {
+		psi += t.Root.Cover
+	}
+	psi /= float64(len(f.Trees))
+	norm := AveragePathLength(psi)
+
+	for c := 0; c < nCases; c++ {
+		for _, t := range f.Trees {
+			depths[c] += t.IsolationDepth(fm, c)
+		}
+		depths[c] /= float64(len(f.Trees))
+		scores[c] = math.Pow(2.0, -depths[c]/norm)
+	}
+	return
+}
@@ -0,0 +1,66 @@
+package CloudForest
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestAveragePathLength(t *testing.T) {
+	if AveragePathLength(1) != 0.0 || AveragePathLength(2) != 1.0 {
+		t.Errorf("c(1) and c(2) were %v and %v not 0 and 1.", AveragePathLength(1), AveragePathLength(2))
+	}
+	if c := AveragePathLength(256); math.Abs(c-10.2448) > 1e-3 {
+		t.Errorf("c(256) was %v not 10.2448.", c)
+	}
+}
+
+func TestIsolationForest(t *testing.T) {
+	//A tight cluster with missing values and a categorical feature plus one far away case.
+	ncases := 300
+	rnd := rand.New(rand.NewSource(1))
+	fm := syntheticAFM(rnd, ncases, []string{"N:x", "N:y", "C:z"}, func(i int, rnd *rand.Rand) []interface{} {
+		var x, y interface{} = rnd.NormFloat64(), rnd.NormFloat64()
+		z := []string{"a", "b"}[rnd.Intn(2)]
+		if i%10 == 0 {
+			y = "NA"
+		}
+		if i == 0 {
+			x, y, z = 10, -10, "c"
+		}
+		return []interface{}{x, y, z}
+	})
+
+	forest := &Forest{"", make([]*Tree, 0), 0.0, nil}
+	for i := 0; i < 100; i++ {
+		tree := NewTree()
+		tree.GrowIsolation(fm, rnd.Perm(ncases)[:64], []int{0, 1, 2}, 6, rnd)
+		forest.Trees = append(forest.Trees, tree)
+	}
+
+	//Round trip through the sf format which has to preserve covers.
+	buf := new(bytes.Buffer)
+	NewForestWriter(buf).WriteForest(forest)
+	read, err := NewForestReader(buf).ReadForest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range []*Forest{forest, read} {
+		scores, depths := f.AnomalyScores(fm)
+		mean := 0.0
+		for _, s := range scores[1:] {
+			mean += s
+		}
+		mean /= float64(ncases - 1)
+		if scores[0] <= 0.6 || mean >= 0.55 {
+			t.Errorf("Anomaly score %v (depth %v) for the outlier and mean %v for the others.", scores[0], depths[0], mean)
+		}
+		for i := 1; i < ncases; i++ {
+			if scores[i] >= scores[0] {
+				t.Errorf("Case %v scored %v which is above the outlier's %v.", i, scores[i], scores[0])
+			}
+		}
+	}
+}
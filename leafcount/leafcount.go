@@ -1,28 +1,48 @@
 package main
 
 import (
+	"encoding/csv"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"github.com/ryanbressler/CloudForest"
+	"io"
 	"log"
 	"os"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync"
 )
 
+//treeCases is a tree and the cases to count proximity on in it.
+type treeCases struct {
+	Tree  *CloudForest.Tree
+	Cases []int
+}
+
 func main() {
 	fm := flag.String("fm", "featurematrix.afm", "AFM formated feature matrix to use.")
-	rf := flag.String("rfpred", "rface.sf", "A predictor forest.")
+	rf := flag.String("rfpred", "rface.sf", "A predictor forest in .sf or binary format.")
 	outf := flag.String("leaves", "leaves.tsv", "a case by case sparse matrix of leaf co-occurrence in tsv format")
 	boutf := flag.String("branches", "", "a case by feature sparse matrix of leaf co-occurrence in tsv format")
 	soutf := flag.String("splits", "", "a file to write a json record of splite per feature")
+	proxf := flag.String("proximity", "", "a case by case sparse matrix of normalized proximities in tsv format")
+	outlierf := flag.String("outliers", "", "a file to write a tsv of the outlier score of each case to")
+	mdsf := flag.String("mds", "", "a file to write a tsv of multidimensional scaling coordinates of each case to")
+	inbagf := flag.String("inbag", "", "in bag cases written by growforest -inbag; only out of bag pairs are counted")
+	targetname := flag.String("target", "", "categorical target whose classes outlier scores are calculated within")
 	var threads int
-	flag.IntVar(&threads, "threads", 1, "Parse seperate forests in n seperate threads.")
+	flag.IntVar(&threads, "threads", 1, "Process trees in n seperate threads.")
+	var shards int
+	flag.IntVar(&shards, "shards", 64, "Number of separately locked shards to count co-occurrence in.")
+	var mdsdims int
+	flag.IntVar(&mdsdims, "mdsdims", 2, "Number of multidimensional scaling dimensions.")
 
 	flag.Parse()
 
 	splits := make(map[string][]string)
+	var splitsMutex sync.Mutex
 
 	//Parse Data
 	data, err := CloudForest.LoadAFM(*fm)
@@ -30,92 +50,97 @@ func main() {
 		log.Fatal(err)
 	}
 
-	log.Print("Data file ", len(data.Data), " by ", data.Data[0].Length())
+	nCases := data.Data[0].Length()
+	log.Print("Data file ", len(data.Data), " by ", nCases)
 
-	counts := new(CloudForest.SparseCounter)
+	counts := CloudForest.NewShardedCounter(shards)
 	var caseFeatureCounts *CloudForest.SparseCounter
 	if *boutf != "" {
 		caseFeatureCounts = new(CloudForest.SparseCounter)
 	}
 
-	files := strings.Split(*rf, ",")
+	var inbag [][]int
+	if *inbagf != "" {
+		inbag = readInbag(*inbagf, nCases)
+	}
+	var oob CloudForest.CaseTrees
+	if inbag != nil {
+		oob = CloudForest.NewCaseTrees(nCases)
+	}
 
 	runtime.GOMAXPROCS(threads)
 
-	fileChan := make(chan string, 0)
-	doneChan := make(chan int, 0)
-
-	go func() {
-		for _, fn := range files {
-			fileChan <- fn
-		}
-	}()
-
+	treeChan := make(chan *treeCases, 0)
+	var waitGroup sync.WaitGroup
+	waitGroup.Add(threads)
 	for i := 0; i < threads; i++ {
-
 		go func() {
-			for {
-				fn := <-fileChan
-
-				forestfile, err := os.Open(fn) // For read access.
-				if err != nil {
-					log.Fatal(err)
+			for tc := range treeChan {
+				tree := tc.Tree
+				tree.CountProximity(data, tc.Cases, counts)
+				if caseFeatureCounts != nil {
+					tree.GetLeaves(data, caseFeatureCounts)
 				}
-				defer forestfile.Close()
-				forestreader := CloudForest.NewForestReader(forestfile)
-				forest, err := forestreader.ReadForest()
-				if err != nil {
-					log.Fatal(err)
-				}
-				log.Print("Forest has ", len(forest.Trees), " trees ")
-
-				for i := 0; i < len(forest.Trees); i++ {
-					fmt.Print(".")
-					leaves := forest.Trees[i].GetLeaves(data, caseFeatureCounts)
-					for _, leaf := range leaves {
-						for j := 0; j < len(leaf.Cases); j++ {
-							for k := 0; k < len(leaf.Cases); k++ {
-
-								counts.Add(leaf.Cases[j], leaf.Cases[k], 1)
 
+				if *soutf != "" {
+					splitsMutex.Lock()
+					tree.Root.Climb(func(n *CloudForest.Node) {
+						if n.Splitter != nil {
+							name := n.Splitter.Feature
+							_, ok := splits[name]
+							if !ok {
+								splits[name] = make([]string, 0, 10)
 							}
-						}
-					}
-
-					if *soutf != "" {
-						forest.Trees[i].Root.Climb(func(n *CloudForest.Node) {
-							if n.Splitter != nil {
-								name := n.Splitter.Feature
-								_, ok := splits[name]
-								if !ok {
-									splits[name] = make([]string, 0, 10)
+							split := ""
+							switch n.Splitter.Numerical {
+							case true:
+								split = fmt.Sprintf("%v", n.Splitter.Value)
+							case false:
+								keys := make([]string, 0, len(n.Splitter.Left))
+								for k := range n.Splitter.Left {
+									keys = append(keys, k)
 								}
-								split := ""
-								switch n.Splitter.Numerical {
-								case true:
-									split = fmt.Sprintf("%v", n.Splitter.Value)
-								case false:
-									keys := make([]string, 0, len(n.Splitter.Left))
-									for k := range n.Splitter.Left {
-										keys = append(keys, k)
-									}
-									split = strings.Join(keys, ",")
-								}
-								splits[name] = append(splits[name], split)
+								split = strings.Join(keys, ",")
 							}
-						})
-					}
-
+							splits[name] = append(splits[name], split)
+						}
+					})
+					splitsMutex.Unlock()
 				}
-				doneChan <- 1
+				fmt.Print(".")
 			}
+			waitGroup.Done()
 		}()
+	}
 
+	allcases := make([]int, 0, nCases)
+	for i := 0; i < nCases; i++ {
+		allcases = append(allcases, i)
 	}
+	nTrees := 0
+	for _, fn := range strings.Split(*rf, ",") {
+		forest, err := CloudForest.LoadForest(fn)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Print("Forest has ", len(forest.Trees), " trees ")
 
-	for i := 0; i < len(files); i++ {
-		<-doneChan
+		for _, tree := range forest.Trees {
+			cases := allcases
+			if inbag != nil {
+				if nTrees >= len(inbag) {
+					log.Fatalf("In bag cases not found for tree %v.", nTrees)
+				}
+				cases = outOfBag(inbag[nTrees], nCases)
+				oob.AddTree(nTrees, cases)
+			}
+			treeChan <- &treeCases{tree, cases}
+			nTrees++
+		}
 	}
+	close(treeChan)
+	waitGroup.Wait()
+	fmt.Print("\n")
 
 	log.Print("Outputting Case Case  Co-Occurrence Counts")
 	outfile, err := os.Create(*outf)
@@ -144,4 +169,123 @@ func main() {
 		encoder := json.NewEncoder(soutfile)
 		encoder.Encode(splits)
 	}
+
+	if *proxf == "" && *outlierf == "" && *mdsf == "" {
+		return
+	}
+	prox := CloudForest.NormalizeProximity(counts, nCases, nTrees, oob)
+
+	if *proxf != "" {
+		log.Print("Outputting Normalized Proximities")
+		proxfile, err := os.Create(*proxf)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer proxfile.Close()
+		for i, row := range prox {
+			for j, p := range row {
+				fmt.Fprintf(proxfile, "%v\t%v\t%v\n", i, j, p)
+			}
+		}
+	}
+
+	if *outlierf != "" {
+		log.Print("Outputting Outlier Scores")
+		var labels []string
+		if *targetname != "" {
+			targeti, ok := data.Map[*targetname]
+			if !ok {
+				log.Fatal("Target not found in data.")
+			}
+			target := data.Data[targeti]
+			if target.NCats() > 0 {
+				labels = make([]string, 0, nCases)
+				for i := 0; i < nCases; i++ {
+					labels = append(labels, target.GetStr(i))
+				}
+			}
+		}
+		scores := CloudForest.OutlierScores(prox, labels)
+		outlierfile, err := os.Create(*outlierf)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer outlierfile.Close()
+		fmt.Fprintln(outlierfile, "Case\tClass\tOutlier")
+		for i, score := range scores {
+			label := ""
+			if labels != nil {
+				label = labels[i]
+			}
+			fmt.Fprintf(outlierfile, "%v\t%v\t%v\n", data.CaseLabels[i], label, score)
+		}
+	}
+
+	if *mdsf != "" {
+		log.Print("Outputting Multidimensional Scaling Coordinates")
+		coords, eigenvalues := CloudForest.ClassicalMDS(prox, mdsdims)
+		log.Print("MDS eigenvalues ", eigenvalues)
+		mdsfile, err := os.Create(*mdsf)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer mdsfile.Close()
+		fmt.Fprint(mdsfile, "Case")
+		for d := 0; d < mdsdims; d++ {
+			fmt.Fprintf(mdsfile, "\tDim%v", d+1)
+		}
+		fmt.Fprint(mdsfile, "\n")
+		for i, coord := range coords {
+			fmt.Fprint(mdsfile, data.CaseLabels[i])
+			for _, x := range coord {
+				fmt.Fprintf(mdsfile, "\t%v", x)
+			}
+			fmt.Fprint(mdsfile, "\n")
+		}
+	}
+}
+
+//readInbag reads the tab separated in bag cases of each tree, one line per tree.
+func readInbag(fn string, nCases int) (inbag [][]int) {
+	inbagfile, err := os.Open(fn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer inbagfile.Close()
+	tsv := csv.NewReader(inbagfile)
+	tsv.Comma = '\t'
+	tsv.FieldsPerRecord = -1
+	for {
+		record, err := tsv.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			log.Fatal(err)
+		}
+		cases := make([]int, 0, len(record))
+		for _, field := range record {
+			c, err := strconv.Atoi(field)
+			if err != nil || c < 0 || c >= nCases {
+				log.Fatalf("Invalid in bag case %v.", field)
+			}
+			cases = append(cases, c)
+		}
+		inbag = append(inbag, cases)
+	}
+	return
+}
+
+//outOfBag returns the cases not in the in bag cases.
+func outOfBag(inbag []int, nCases int) (oob []int) {
+	isinbag := make([]bool, nCases)
+	for _, c := range inbag {
+		isinbag[c] = true
+	}
+	oob = make([]int, 0, nCases)
+	for c, in := range isinbag {
+		if !in {
+			oob = append(oob, c)
+		}
+	}
+	return
 }
@@ -0,0 +1,596 @@
+/*
+Package metrics evaluates the predictions of CloudForest forests tallied in ballot boxes against
+the true values of the target.
+
+Classification metrics are calculated from a Classification built from a CatBallotBox: ROC AUC,
+PR AUC (average precision), log loss, Brier score, Matthews correlation coefficient, Cohen's kappa,
+accuracy and the confusion matrix. Class probabilities are the fraction of the votes for each
+class.
+
+Regression metrics are calculated from a Regression built from a NumBallotBox or SumBallotBox:
+mean absolute error, root mean squared error, mean absolute percentage error, R² and quantile
+(pinball) loss.
+
+Evaluate calculates metrics selected by name and WriteResults prints them in a stable tab
+separated format.
+*/
+package metrics
+
+import (
+	"fmt"
+	"github.com/ryanbressler/CloudForest"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//Classification holds the actual class and the predicted class probabilities of classified
+//cases. Actual and the columns of Probs index Classes.
+type Classification struct {
+	Classes []string
+	Actual  []int
+	Probs   [][]float64
+}
+
+/*
+NewClassification builds a Classification from the votes in bb and the actual classes of target.
+The classes are those of target followed by any others that received votes. Cases missing the
+target or without any votes are skipped.
+*/
+func NewClassification(bb *CloudForest.CatBallotBox, target CloudForest.Feature) *Classification {
+	c := &Classification{make([]string, 0), make([]int, 0), make([][]float64, 0)}
+	classi := make(map[string]int)
+	addClass := func(class string) int {
+		i, ok := classi[class]
+		if !ok {
+			i = len(c.Classes)
+			classi[class] = i
+			c.Classes = append(c.Classes, class)
+		}
+		return i
+	}
+	for i := 0; i < target.NCats(); i++ {
+		addClass(target.(CloudForest.CatFeature).NumToCat(i))
+	}
+	for _, class := range bb.Back {
+		addClass(class)
+	}
+
+	for i := 0; i < target.Length() && i < len(bb.Box); i++ {
+		if target.IsMissing(i) {
+			continue
+		}
+		probs := make([]float64, len(c.Classes))
+		total := 0.0
+		bb.Box[i].Mutex.Lock()
+		for k, votes := range bb.Box[i].Map {
+			probs[classi[bb.Back[k]]] += votes
+			total += votes
+		}
+		bb.Box[i].Mutex.Unlock()
+		if total <= 0 {
+			continue
+		}
+		for k := range probs {
+			probs[k] /= total
+		}
+		c.Actual = append(c.Actual, addClass(target.GetStr(i)))
+		c.Probs = append(c.Probs, probs)
+	}
+	for i := range c.Probs {
+		for len(c.Probs[i]) < len(c.Classes) {
+			c.Probs[i] = append(c.Probs[i], 0.0)
+		}
+	}
+	return c
+}
+
+/*
+NewBoostedClassification builds a Classification from the votes of a gradient boosting
+classification forest in bb. The probability of the positive class is the expit of the sum of the
+votes plus intercept and the other classes of target share the rest equally. Cases missing the
+target are skipped.
+*/
+func NewBoostedClassification(bb *CloudForest.SumBallotBox, target CloudForest.Feature, intercept float64, positive string) (*Classification, error) {
+	c := &Classification{make([]string, 0), make([]int, 0), make([][]float64, 0)}
+	pos := -1
+	for i := 0; i < target.NCats(); i++ {
+		class := target.(CloudForest.CatFeature).NumToCat(i)
+		if class == positive {
+			pos = i
+		}
+		c.Classes = append(c.Classes, class)
+	}
+	if pos < 0 || len(c.Classes) < 2 {
+		return nil, fmt.Errorf("Gradient boosting classification metrics need a positive class %v and another class in the target.", positive)
+	}
+	for i := 0; i < target.Length() && i < len(bb.Box); i++ {
+		if target.IsMissing(i) {
+			continue
+		}
+		p := CloudForest.Expit(bb.TallyNum(i) + intercept)
+		probs := make([]float64, len(c.Classes))
+		for k := range probs {
+			probs[k] = (1.0 - p) / float64(len(c.Classes)-1)
+		}
+		probs[pos] = p
+		c.Actual = append(c.Actual, target.(CloudForest.CatFeature).Geti(i))
+		c.Probs = append(c.Probs, probs)
+	}
+	return c, nil
+}
+
+//Predicted returns the most probable class of the i'th case.
+func (c *Classification) Predicted(i int) (pred int) {
+	for k, p := range c.Probs[i] {
+		if p > c.Probs[i][pred] {
+			pred = k
+		}
+	}
+	return
+}
+
+//ConfusionMatrix returns the number of cases of each actual class (row) predicted to be each
+//class (column).
+func (c *Classification) ConfusionMatrix() [][]int {
+	cm := make([][]int, len(c.Classes))
+	for i := range cm {
+		cm[i] = make([]int, len(c.Classes))
+	}
+	for i, actual := range c.Actual {
+		cm[actual][c.Predicted(i)]++
+	}
+	return cm
+}
+
+//Accuracy returns the fraction of cases whose most probable class is their actual class.
+func (c *Classification) Accuracy() float64 {
+	correct := 0
+	for i, actual := range c.Actual {
+		if c.Predicted(i) == actual {
+			correct++
+		}
+	}
+	return float64(correct) / float64(len(c.Actual))
+}
+
+//agreement returns the number of correct predictions, the total and the sum over classes of
+//the product of the number of cases actually in and predicted to be the class and the sums of
+//their squares.
+func (c *Classification) agreement() (correct, total, cross, actualsqr, predsqr float64) {
+	cm := c.ConfusionMatrix()
+	for k := range cm {
+		actual, pred := 0.0, 0.0
+		for j := range cm {
+			actual += float64(cm[k][j])
+			pred += float64(cm[j][k])
+		}
+		correct += float64(cm[k][k])
+		total += actual
+		cross += actual * pred
+		actualsqr += actual * actual
+		predsqr += pred * pred
+	}
+	return
+}
+
+//MCC returns the (multiclass) Matthews correlation coefficient of the predicted and actual
+//classes.
+func (c *Classification) MCC() float64 {
+	correct, total, cross, actualsqr, predsqr := c.agreement()
+	denom := math.Sqrt((total*total - predsqr) * (total*total - actualsqr))
+	if denom == 0 {
+		return 0.0
+	}
+	return (correct*total - cross) / denom
+}
+
+//Kappa returns Cohen's kappa for the agreement of the predicted and actual classes.
+func (c *Classification) Kappa() float64 {
+	correct, total, cross, _, _ := c.agreement()
+	observed := correct / total
+	expected := cross / (total * total)
+	if expected == 1 {
+		return 0.0
+	}
+	return (observed - expected) / (1.0 - expected)
+}
+
+//LogLoss returns the mean negative log probability of the actual class with probabilities
+//clipped to [1e-15, 1-1e-15].
+func (c *Classification) LogLoss() (loss float64) {
+	for i, actual := range c.Actual {
+		p := math.Max(1e-15, math.Min(1.0-1e-15, c.Probs[i][actual]))
+		loss -= math.Log(p)
+	}
+	return loss / float64(len(c.Actual))
+}
+
+//Brier returns the mean squared difference between the predicted probabilities and the
+//indicators of the actual class. If positive is a class it is the score of that class alone
+//and otherwise it is summed over the classes.
+func (c *Classification) Brier(positive int) (score float64) {
+	for i, actual := range c.Actual {
+		for k, p := range c.Probs[i] {
+			if positive >= 0 && k != positive {
+				continue
+			}
+			y := 0.0
+			if k == actual {
+				y = 1.0
+			}
+			score += (p - y) * (p - y)
+		}
+	}
+	return score / float64(len(c.Actual))
+}
+
+//scoredCase is the probability of a class and whether the class is the actual one.
+type scoredCase struct {
+	Score    float64
+	Positive bool
+}
+
+//byScore sorts scored cases by decreasing score.
+type byScore []scoredCase
+
+func (s byScore) Len() int           { return len(s) }
+func (s byScore) Less(i, j int) bool { return s[i].Score > s[j].Score }
+func (s byScore) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+//oneVsRest returns the cases scored by the probability of class sorted by decreasing score and
+//the number of them in the class.
+func (c *Classification) oneVsRest(class int) (scored []scoredCase, npos int) {
+	scored = make([]scoredCase, 0, len(c.Actual))
+	for i, actual := range c.Actual {
+		scored = append(scored, scoredCase{c.Probs[i][class], actual == class})
+		if actual == class {
+			npos++
+		}
+	}
+	sort.Sort(byScore(scored))
+	return
+}
+
+//AUC returns the area under the ROC curve of the probability of class for separating it from
+//the others. Ties count as half. It is NaN if all or none of the cases are in the class.
+func (c *Classification) AUC(class int) float64 {
+	scored, npos := c.oneVsRest(class)
+	nneg := len(scored) - npos
+	if npos == 0 || nneg == 0 {
+		return math.NaN()
+	}
+	//Count the negatives ranked below each positive one tied group at a time.
+	area := 0.0
+	negbelow := float64(nneg)
+	for i := 0; i < len(scored); {
+		j := i
+		pos, neg := 0.0, 0.0
+		for ; j < len(scored) && scored[j].Score == scored[i].Score; j++ {
+			if scored[j].Positive {
+				pos++
+			} else {
+				neg++
+			}
+		}
+		negbelow -= neg
+		area += pos * (negbelow + neg/2.0)
+		i = j
+	}
+	return area / (float64(npos) * float64(nneg))
+}
+
+//PRAUC returns the area under the precision recall curve (average precision) of the probability
+//of class. It is NaN if none of the cases are in the class.
+func (c *Classification) PRAUC(class int) float64 {
+	scored, npos := c.oneVsRest(class)
+	if npos == 0 {
+		return math.NaN()
+	}
+	ap := 0.0
+	tp, fp := 0.0, 0.0
+	for i := 0; i < len(scored); {
+		j := i
+		pos := 0.0
+		for ; j < len(scored) && scored[j].Score == scored[i].Score; j++ {
+			if scored[j].Positive {
+				pos++
+			} else {
+				fp++
+			}
+		}
+		tp += pos
+		ap += pos / float64(npos) * tp / (tp + fp)
+		i = j
+	}
+	return ap
+}
+
+//classMean returns f of positive if it is a class or the mean over the classes of f ignoring
+//NaNs.
+func (c *Classification) classMean(f func(int) float64, positive int) float64 {
+	if positive >= 0 {
+		return f(positive)
+	}
+	sum, n := 0.0, 0.0
+	for k := range c.Classes {
+		if v := f(k); !math.IsNaN(v) {
+			sum += v
+			n++
+		}
+	}
+	return sum / n
+}
+
+//Regression holds the actual and predicted values of cases.
+type Regression struct {
+	Actual    []float64
+	Predicted []float64
+}
+
+//numTallyer is implemented by NumBallotBox and SumBallotBox.
+type numTallyer interface {
+	CloudForest.VoteTallyer
+	TallyNum(i int) float64
+}
+
+/*
+NewRegression builds a Regression from the votes in bb, which must be a NumBallotBox or
+SumBallotBox, plus intercept and the actual values of target. Cases missing the target or
+without any votes are skipped.
+*/
+func NewRegression(bb CloudForest.VoteTallyer, target CloudForest.Feature, intercept float64) (*Regression, error) {
+	nbb, ok := bb.(numTallyer)
+	if !ok {
+		return nil, fmt.Errorf("Regression metrics need numerical votes.")
+	}
+	r := &Regression{make([]float64, 0), make([]float64, 0)}
+	for i := 0; i < target.Length(); i++ {
+		if target.IsMissing(i) || nbb.Tally(i) == "NA" {
+			continue
+		}
+		actual, err := strconv.ParseFloat(target.GetStr(i), 64)
+		if err != nil {
+			return nil, fmt.Errorf("Regression metrics need a numerical target: %v", err)
+		}
+		r.Actual = append(r.Actual, actual)
+		r.Predicted = append(r.Predicted, nbb.TallyNum(i)+intercept)
+	}
+	return r, nil
+}
+
+//MAE returns the mean absolute error.
+func (r *Regression) MAE() (e float64) {
+	for i, a := range r.Actual {
+		e += math.Abs(a - r.Predicted[i])
+	}
+	return e / float64(len(r.Actual))
+}
+
+//RMSE returns the root mean squared error.
+func (r *Regression) RMSE() (e float64) {
+	for i, a := range r.Actual {
+		e += (a - r.Predicted[i]) * (a - r.Predicted[i])
+	}
+	return math.Sqrt(e / float64(len(r.Actual)))
+}
+
+//MAPE returns the mean absolute percentage error over cases whose actual value isn't 0.
+func (r *Regression) MAPE() (e float64) {
+	n := 0
+	for i, a := range r.Actual {
+		if a != 0 {
+			e += math.Abs((a - r.Predicted[i]) / a)
+			n++
+		}
+	}
+	return 100.0 * e / float64(n)
+}
+
+//R2 returns the coefficient of determination.
+func (r *Regression) R2() float64 {
+	mean := 0.0
+	for _, a := range r.Actual {
+		mean += a
+	}
+	mean /= float64(len(r.Actual))
+	sse, sst := 0.0, 0.0
+	for i, a := range r.Actual {
+		sse += (a - r.Predicted[i]) * (a - r.Predicted[i])
+		sst += (a - mean) * (a - mean)
+	}
+	return 1.0 - sse/sst
+}
+
+//QuantileLoss returns the mean pinball loss of the predictions as estimates of quantile q.
+func (r *Regression) QuantileLoss(q float64) (loss float64) {
+	for i, a := range r.Actual {
+		diff := a - r.Predicted[i]
+		loss += math.Max(q*diff, (q-1.0)*diff)
+	}
+	return loss / float64(len(r.Actual))
+}
+
+//Result is the value of a named metric.
+type Result struct {
+	Name  string
+	Value float64
+}
+
+//ClassificationMetrics and RegressionMetrics list the names understood by Evaluate.
+var (
+	ClassificationMetrics = []string{"auc", "prauc", "logloss", "brier", "mcc", "kappa", "accuracy", "confusion"}
+	RegressionMetrics     = []string{"mae", "rmse", "mape", "r2", "quantile"}
+)
+
+//HigherIsBetter returns true for metrics (auc, prauc, mcc, kappa, accuracy and r2) where larger
+//values are better and false for errors and losses.
+func HigherIsBetter(name string) bool {
+	switch strings.SplitN(name, ":", 2)[0] {
+	case "auc", "prauc", "mcc", "kappa", "accuracy", "r2":
+		return true
+	}
+	return false
+}
+
+/*
+Evaluate calculates the metrics listed (comma separated) in names for a Classification c or a
+Regression r (the other should be nil). It returns an error for unknown metrics or ones that don't
+apply.
+
+For classification, auc, prauc and brier are for the class positive if it is one of the classes
+and otherwise auc and prauc are averaged over the classes (one versus rest) and brier is summed.
+confusion gives a result named confusion:actual:predicted for each pair of classes.
+
+For regression, quantile loss is for the median unless a quantile is given as in quantile:0.9.
+*/
+func Evaluate(names string, c *Classification, r *Regression, positive string) (results []Result, err error) {
+	pos := -1
+	if c != nil {
+		for k, class := range c.Classes {
+			if class == positive {
+				pos = k
+			}
+		}
+	}
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		metric, param := name, ""
+		if i := strings.Index(name, ":"); i >= 0 {
+			metric, param = name[:i], name[i+1:]
+		}
+		if c != nil && len(c.Actual) == 0 || r != nil && len(r.Actual) == 0 {
+			return nil, fmt.Errorf("No cases with predictions to evaluate.")
+		}
+		v := 0.0
+		switch {
+		case c != nil && metric == "auc":
+			v = c.classMean(c.AUC, pos)
+		case c != nil && metric == "prauc":
+			v = c.classMean(c.PRAUC, pos)
+		case c != nil && metric == "logloss":
+			v = c.LogLoss()
+		case c != nil && metric == "brier":
+			v = c.Brier(pos)
+		case c != nil && metric == "mcc":
+			v = c.MCC()
+		case c != nil && metric == "kappa":
+			v = c.Kappa()
+		case c != nil && metric == "accuracy":
+			v = c.Accuracy()
+		case c != nil && metric == "confusion":
+			for a, row := range c.ConfusionMatrix() {
+				for p, count := range row {
+					results = append(results, Result{fmt.Sprintf("confusion:%v:%v", c.Classes[a], c.Classes[p]), float64(count)})
+				}
+			}
+			continue
+		case r != nil && metric == "mae":
+			v = r.MAE()
+		case r != nil && metric == "rmse":
+			v = r.RMSE()
+		case r != nil && metric == "mape":
+			v = r.MAPE()
+		case r != nil && metric == "r2":
+			v = r.R2()
+		case r != nil && metric == "quantile":
+			q := 0.5
+			if param != "" {
+				q, err = strconv.ParseFloat(param, 64)
+				if err != nil || q <= 0 || q >= 1 {
+					return nil, fmt.Errorf("Invalid quantile %v.", param)
+				}
+			}
+			v = r.QuantileLoss(q)
+		default:
+			return nil, fmt.Errorf("Unknown or inapplicable metric %v.", name)
+		}
+		results = append(results, Result{name, v})
+	}
+	return
+}
+
+/*
+EvaluateVotes calculates the metrics listed in names (see Evaluate) for the votes in bb against
+target. Classification metrics are used if bb is a CatBallotBox or if it is a SumBallotBox (from
+gradient boosting) and target is categorical, in which case the probability of the class positive
+is the expit of the sum of the votes plus intercept. Otherwise regression metrics are used with
+intercept added to each prediction.
+*/
+func EvaluateVotes(names string, bb CloudForest.VoteTallyer, target CloudForest.Feature, intercept float64, positive string) ([]Result, error) {
+	if cbb, ok := bb.(*CloudForest.CatBallotBox); ok {
+		if target.NCats() == 0 {
+			return nil, fmt.Errorf("Classification metrics need a categorical target.")
+		}
+		return Evaluate(names, NewClassification(cbb, target), nil, positive)
+	}
+	if sbb, ok := bb.(*CloudForest.SumBallotBox); ok && target.NCats() != 0 {
+		c, err := NewBoostedClassification(sbb, target, intercept, positive)
+		if err != nil {
+			return nil, err
+		}
+		return Evaluate(names, c, nil, positive)
+	}
+	r, err := NewRegression(bb, target, intercept)
+	if err != nil {
+		return nil, err
+	}
+	return Evaluate(names, nil, r, positive)
+}
+
+//Summarize returns the mean and sample standard deviation of each metric over several sets of
+//results such as those of the folds of a cross validation. Metrics are in the order they first
+//appear and NaN values are skipped.
+func Summarize(sets [][]Result) (means []Result, sds []Result) {
+	values := make(map[string][]float64)
+	names := make([]string, 0)
+	for _, results := range sets {
+		for _, r := range results {
+			if _, ok := values[r.Name]; !ok {
+				names = append(names, r.Name)
+				values[r.Name] = make([]float64, 0, len(sets))
+			}
+			if !math.IsNaN(r.Value) {
+				values[r.Name] = append(values[r.Name], r.Value)
+			}
+		}
+	}
+	for _, name := range names {
+		vs := values[name]
+		mean, sd := math.NaN(), math.NaN()
+		if len(vs) > 0 {
+			mean = 0.0
+			for _, v := range vs {
+				mean += v
+			}
+			mean /= float64(len(vs))
+		}
+		if len(vs) > 1 {
+			sd = 0.0
+			for _, v := range vs {
+				sd += (v - mean) * (v - mean)
+			}
+			sd = math.Sqrt(sd / float64(len(vs)-1))
+		}
+		means = append(means, Result{name, mean})
+		sds = append(sds, Result{name, sd})
+	}
+	return
+}
+
+//WriteResults writes each result as a tab separated line starting with prefix (if not "")
+//followed by the name and value. growforest and applyforest use the prefix METRIC so results
+//can be found in their output.
+func WriteResults(w io.Writer, prefix string, results []Result) {
+	for _, r := range results {
+		if prefix != "" {
+			fmt.Fprintf(w, "%v\t", prefix)
+		}
+		fmt.Fprintf(w, "%v\t%v\n", r.Name, r.Value)
+	}
+}
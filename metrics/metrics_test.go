@@ -0,0 +1,149 @@
+package metrics
+
+import (
+	"bytes"
+	"github.com/ryanbressler/CloudForest"
+	"math"
+	"strings"
+	"testing"
+)
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-4
+}
+
+func TestClassificationMetrics(t *testing.T) {
+	c := &Classification{[]string{"a", "b"},
+		[]int{0, 0, 1, 1},
+		[][]float64{{0.9, 0.1}, {0.6, 0.4}, {0.65, 0.35}, {0.2, 0.8}}}
+
+	expected := map[string]float64{"auc": 0.75,
+		"prauc":         0.8333333,
+		"brier":         0.158125,
+		"accuracy":      0.75,
+		"mcc":           0.5773503,
+		"kappa":         0.5,
+		"logloss":       (-math.Log(0.9) - math.Log(0.6) - math.Log(0.35) - math.Log(0.8)) / 4.0,
+		"confusion:b:a": 1,
+		"confusion:a:a": 2,
+		"confusion:a:b": 0,
+		"confusion:b:b": 1}
+	results, err := Evaluate("auc,prauc,brier,accuracy,mcc,kappa,logloss,confusion", c, nil, "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(expected) {
+		t.Errorf("Evaluate returned %v results not %v.", len(results), len(expected))
+	}
+	for _, r := range results {
+		if !near(r.Value, expected[r.Name]) {
+			t.Errorf("%v was %v not %v.", r.Name, r.Value, expected[r.Name])
+		}
+	}
+
+	//With two classes one versus rest auc is the same for both classes.
+	if auc := c.classMean(c.AUC, -1); !near(auc, 0.75) {
+		t.Errorf("Mean auc was %v not 0.75.", auc)
+	}
+
+	if _, err := Evaluate("rmse", c, nil, "b"); err == nil {
+		t.Error("Regression metric evaluated for classification.")
+	}
+
+	buf := new(bytes.Buffer)
+	WriteResults(buf, "METRIC", results[:1])
+	if buf.String() != "METRIC\tauc\t0.75\n" {
+		t.Errorf("Results written as %q.", buf.String())
+	}
+}
+
+func TestRegressionMetrics(t *testing.T) {
+	r := &Regression{[]float64{3, -0.5, 2, 7}, []float64{2.5, 0.0, 2, 8}}
+	expected := map[string]float64{"mae": 0.5,
+		"rmse":         math.Sqrt(0.375),
+		"r2":           0.9486081,
+		"mape":         32.7380952,
+		"quantile":     0.25,
+		"quantile:0.9": 0.15}
+	results, err := Evaluate("mae,rmse,r2,mape,quantile,quantile:0.9", nil, r, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, res := range results {
+		if !near(res.Value, expected[res.Name]) {
+			t.Errorf("%v was %v not %v.", res.Name, res.Value, expected[res.Name])
+		}
+	}
+	if _, err := Evaluate("auc", nil, r, ""); err == nil {
+		t.Error("Classification metric evaluated for regression.")
+	}
+}
+
+func TestFromBallotBoxes(t *testing.T) {
+	fm := CloudForest.ParseAFM(strings.NewReader(".\t1\t2\t3\nC:y\ta\tb\tNA\nN:z\t1\t2\t3\n"))
+
+	cbb := CloudForest.NewCatBallotBox(3)
+	cbb.Vote(0, "a", 3.0)
+	cbb.Vote(0, "b", 1.0)
+	cbb.Vote(1, "c", 1.0)
+	cbb.Vote(2, "a", 1.0)
+	c := NewClassification(cbb, fm.Data[0])
+	if len(c.Actual) != 2 || strings.Join(c.Classes, ",") != "a,b,c" {
+		t.Fatalf("Classification had classes %v and %v cases.", c.Classes, len(c.Actual))
+	}
+	if !near(c.Probs[0][0], 0.75) || c.Probs[1][2] != 1.0 || c.Predicted(1) != 2 {
+		t.Errorf("Wrong probabilities %v.", c.Probs)
+	}
+
+	nbb := CloudForest.NewNumBallotBox(3)
+	nbb.Vote(0, "2", 1.0)
+	nbb.Vote(2, "4", 1.0)
+	r, err := NewRegression(nbb, fm.Data[1], 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Actual) != 2 || r.Predicted[0] != 2.5 || r.Actual[1] != 3 {
+		t.Errorf("Wrong regression %v.", r)
+	}
+	if _, err := NewRegression(cbb, fm.Data[1], 0.0); err == nil {
+		t.Error("Regression built from categorical votes.")
+	}
+
+	sbb := CloudForest.NewSumBallotBox(3)
+	sbb.Vote(0, "1.5", 1.0)
+	sbb.Vote(1, "-2.5", 1.0)
+	c, err = NewBoostedClassification(sbb, fm.Data[0], 0.5, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Actual) != 2 || c.Actual[1] != 1 || !near(c.Probs[0][0], CloudForest.Expit(2.0)) || !near(c.Probs[1][1], 1.0-CloudForest.Expit(-2.0)) {
+		t.Errorf("Wrong boosted classification %v %v.", c.Actual, c.Probs)
+	}
+	results, err := EvaluateVotes("auc,accuracy", sbb, fm.Data[0], 0.5, "a")
+	if err != nil || results[0].Value != 1.0 || results[1].Value != 1.0 {
+		t.Errorf("Boosted votes evaluated as %v with error %v.", results, err)
+	}
+	if _, err := NewBoostedClassification(sbb, fm.Data[0], 0.5, "x"); err == nil {
+		t.Error("Boosted classification built without the positive class.")
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	means, sds := Summarize([][]Result{{{"auc", 0.5}, {"mcc", 0.2}},
+		{{"auc", 0.7}, {"mcc", math.NaN()}},
+		{{"auc", 0.9}}})
+	if len(means) != 2 || means[0].Name != "auc" || !near(means[0].Value, 0.7) || !near(sds[0].Value, 0.2) {
+		t.Errorf("Wrong auc summary %v %v.", means, sds)
+	}
+	if !near(means[1].Value, 0.2) || !math.IsNaN(sds[1].Value) {
+		t.Errorf("Wrong mcc summary %v %v.", means, sds)
+	}
+}
+
+func TestHigherIsBetter(t *testing.T) {
+	for name, higher := range map[string]bool{"auc": true, "r2": true, "logloss": false, "quantile:0.9": false} {
+		if HigherIsBetter(name) != higher {
+			t.Errorf("HigherIsBetter(%v) wasn't %v.", name, higher)
+		}
+	}
+}
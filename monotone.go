@@ -0,0 +1,97 @@
+package CloudForest
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+//monotoneViolation returns a function that checks if splitting sorted cases before the i'th
+//puts the mean of target on the left and right out of the order required by constraint.
+func monotoneViolation(target Target, sorted []int, constraint int) func(i int) bool {
+	nf := numericalTarget(target)
+	if nf == nil {
+		return func(i int) bool { return false }
+	}
+	sums := make([]float64, len(sorted)+1)
+	for i, c := range sorted {
+		sums[i+1] = sums[i] + nf.Get(c)
+	}
+	total := sums[len(sorted)]
+	return func(i int) bool {
+		left := sums[i] / float64(i)
+		right := (total - sums[i]) / float64(len(sorted)-i)
+		return float64(constraint)*(right-left) < 0
+	}
+}
+
+//numericalTarget returns the numerical feature underlying a regression target or nil if there
+//isn't one. GradBoostTarget's Mean field hides the Mean method so it isn't itself a NumFeature.
+func numericalTarget(target Target) NumFeature {
+	switch t := target.(type) {
+	case *GradBoostTarget:
+		return t.NumFeature
+	case NumFeature:
+		return t
+	}
+	return nil
+}
+
+//monotoneBounds are the lower and upper bounds on the leaf values of a node.
+type monotoneBounds struct {
+	Lower float64
+	Upper float64
+}
+
+//unbounded returns bounds that don't restrict leaf values.
+func unbounded() monotoneBounds {
+	return monotoneBounds{math.Inf(-1), math.Inf(1)}
+}
+
+//Clamp returns v restricted to the bounds.
+func (b monotoneBounds) Clamp(v float64) float64 {
+	return math.Max(b.Lower, math.Min(b.Upper, v))
+}
+
+//ClampPred restricts a numerical prediction to the bounds leaving it unchanged if it doesn't
+//need to be.
+func (b monotoneBounds) ClampPred(pred string) string {
+	v, err := strconv.ParseFloat(pred, 64)
+	if err != nil || b.Clamp(v) == v {
+		return pred
+	}
+	return fmt.Sprintf("%v", b.Clamp(v))
+}
+
+//children returns the bounds of the left and right children of a node with bounds b split by s
+//on cases. They are only tightened if the splitting feature is constrained.
+func (b monotoneBounds) children(fm *FeatureMatrix, target Target, s *Splitter, cases []int, monotone map[string]int) (left monotoneBounds, right monotoneBounds) {
+	left, right = b, b
+	constraint := monotone[s.Feature]
+	nf := numericalTarget(target)
+	if constraint == 0 || nf == nil || s.IsOblique() {
+		return
+	}
+	var lsum, rsum, nl, nr float64
+	for _, c := range cases {
+		if goesleft, ok := s.GoesLeft(fm, c); ok && goesleft {
+			lsum += nf.Get(c)
+			nl++
+		} else if ok {
+			rsum += nf.Get(c)
+			nr++
+		}
+	}
+	if nl == 0 || nr == 0 {
+		return
+	}
+	mid := (b.Clamp(lsum/nl) + b.Clamp(rsum/nr)) / 2.0
+	if constraint > 0 {
+		left.Upper = mid
+		right.Lower = mid
+	} else {
+		left.Lower = mid
+		right.Upper = mid
+	}
+	return
+}
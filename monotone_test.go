@@ -0,0 +1,61 @@
+package CloudForest
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestMonotoneConstraints(t *testing.T) {
+	//A noisy target increasing in x1 and decreasing in x2.
+	ncases := 300
+	rnd := rand.New(rand.NewSource(1))
+	fm := syntheticAFM(rnd, ncases, []string{"N:y", "N:x1", "N:x2"}, func(i int, rnd *rand.Rand) []interface{} {
+		x1 := rnd.Float64() * 10.0
+		x2 := rnd.Float64() * 10.0
+		return []interface{}{x1 - x2 + 3.0*rnd.NormFloat64(), x1, x2}
+	})
+
+	//A grid varying each feature with the other held fixed.
+	grid := []string{".", "N:y", "N:x1", "N:x2"}
+	ngrid := 0
+	for fixed := 0.5; fixed < 10; fixed += 3.0 {
+		for v := 0.0; v <= 10.0; v += 0.1 {
+			for j, val := range []float64{float64(ngrid), 0.0, v, fixed} {
+				grid[j] += fmt.Sprintf("\t%v", val)
+			}
+			ngrid++
+			for j, val := range []float64{float64(ngrid), 0.0, fixed, v} {
+				grid[j] += fmt.Sprintf("\t%v", val)
+			}
+			ngrid++
+		}
+	}
+	gridfm := ParseAFM(strings.NewReader(strings.Join(grid, "\n")))
+
+	cases := make([]int, ncases)
+	for i := range cases {
+		cases[i] = i
+	}
+	for _, target := range []Target{fm.Data[0].(Target), NewGradBoostTarget(fm.Data[0].Copy().(NumFeature), 0.1)} {
+		allocs := NewBestSplitAllocs(ncases, target)
+		allocs.Monotone = map[string]int{"N:x1": 1, "N:x2": -1}
+		tree := NewTree()
+		tree.Grow(fm, target, cases, []int{1, 2}, nil, 2, 1, 0, false, false, false, false, false, 0, nil, nil, allocs)
+
+		bb := NewNumBallotBox(ngrid)
+		tree.Vote(gridfm, bb)
+		x1, x2 := gridfm.Data[1].(NumFeature), gridfm.Data[2].(NumFeature)
+		for i := 2; i < ngrid; i++ {
+			last := ParseFloat(bb.Tally(i - 2))
+			pred := ParseFloat(bb.Tally(i))
+			switch {
+			case x1.Get(i) > x1.Get(i-2) && x2.Get(i) == x2.Get(i-2) && pred < last:
+				t.Errorf("Prediction decreased from %v to %v as x1 increased to %v.", last, pred, x1.Get(i))
+			case x2.Get(i) > x2.Get(i-2) && x1.Get(i) == x1.Get(i-2) && pred > last:
+				t.Errorf("Prediction increased from %v to %v as x2 increased to %v.", last, pred, x2.Get(i))
+			}
+		}
+	}
+}
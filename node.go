@@ -21,6 +21,13 @@ type Node struct {
 	Missing    *Node
 	Pred       string
 	Splitter   *Splitter
+	//Surrogates route cases missing the Splitter's feature if it is not nil and there is
+	//no Missing branch. MissingLeft is the fallback direction if no surrogate applies.
+	Surrogates  []*Surrogate
+	MissingLeft bool
+	//Cover is the number of training cases (counting repeats from bagging) that reached the node.
+	//It is recorded by Tree.Grow or Tree.SetCovers and used by Tree.SHAP.
+	Cover float64
 }
 
 //vist each child node with the supplied function
@@ -40,7 +47,8 @@ func (n *Node) Climb(c func(*Node)) {
 //Recurse is used to apply a Recursable function at every downstream node as the cases
 //specified by case []int are split using the data in fm *Featurematrix. Recursion
 //down a branch stops when a a node with n.Splitter == nil is reached. Recursion down
-//the Missing branch is only used if n.Missing!=nil.
+//the Missing branch is only used if n.Missing!=nil. Otherwise cases missing the splitting
+//feature are sent left or right by n.RouteMissing if n.Surrogates!=nil.
 //For example votes can be tabulated using code like:
 //	t.Root.Recurse(func(n *Node, cases []int) {
 //		if n.Left == nil && n.Right == nil {
@@ -52,16 +60,11 @@ func (n *Node) Climb(c func(*Node)) {
 //	}, fm, cases)
 func (n *Node) Recurse(r Recursable, fm *FeatureMatrix, cases []int, depth int) {
 	r(n, cases, depth)
-	depth++
-	var ls, rs, ms []int
-	switch {
-	case n.CodedSplit != nil:
-		ls, rs, ms = fm.Data[n.Featurei].Split(n.CodedSplit, cases)
-	case n.Splitter != nil:
-		ls, rs, ms = n.Splitter.Split(fm, cases)
-	default:
+	if n.CodedSplit == nil && n.Splitter == nil {
 		return
 	}
+	depth++
+	ls, rs, ms := n.SplitCases(fm, cases)
 	n.Left.Recurse(r, fm, ls, depth)
 	n.Right.Recurse(r, fm, rs, depth)
 	if len(ms) > 0 && n.Missing != nil {
@@ -69,6 +72,26 @@ func (n *Node) Recurse(r Recursable, fm *FeatureMatrix, cases []int, depth int)
 	}
 }
 
+//SplitCases splits cases (which may be reordered) between the branches of a node with a
+//splitter as Recurse does. Cases missing the splitting feature are returned in ms unless the
+//node has surrogates and no Missing branch in which case they are routed left or right.
+func (n *Node) SplitCases(fm *FeatureMatrix, cases []int) (ls []int, rs []int, ms []int) {
+	if n.CodedSplit != nil {
+		ls, rs, ms = fm.Data[n.Featurei].Split(n.CodedSplit, cases)
+	} else {
+		ls, rs, ms = n.Splitter.Split(fm, cases)
+	}
+	if len(ms) > 0 && n.Missing == nil && n.Surrogates != nil {
+		//ls, ms and rs are contiguous so the routed missing cases can be
+		//absorbed into their neighbors.
+		nleft := n.RouteMissing(fm, ms)
+		ls = ls[:len(ls)+nleft]
+		rs = ms[nleft : len(ms)+len(rs)]
+		ms = ms[0:0]
+	}
+	return
+}
+
 func (n *Node) CodedRecurse(r CodedRecursable, fm *FeatureMatrix, cases *[]int, depth int, nconstantsbefore int) {
 	fi, codedSplit, nconstants := r(n, cases, depth, nconstantsbefore)
 	depth++
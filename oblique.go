@@ -0,0 +1,360 @@
+package CloudForest
+
+import (
+	"math"
+)
+
+/*
+GrowOblique grows the receiver tree through recursion like Grow but considers an oblique split
+on a linear combination of numerical features at each node as well as the best axis aligned
+split found by BestSplitter. The split with the larger impurity decrease is used.
+
+nFeatures specifies the number of numerical candidates combined in each oblique split. If lda is
+true their weights are the linear discriminant direction separating the most common class from
+the others (or the least squares direction for a numerical target) and otherwise they are random
+as in Breiman's Forest-RC.
+
+Missing values aren't split onto a third branch and surrogates aren't recorded. Cases missing a
+feature of an oblique splitter are missing it at prediction time. Importance from an oblique split
+is divided between its features in proportion to the magnitude of their standardized weights.
+*/
+func (t *Tree) GrowOblique(fm *FeatureMatrix,
+	target Target,
+	cases []int,
+	candidates []int,
+	mTry int,
+	nFeatures int,
+	lda bool,
+	leafSize int,
+	maxDepth int,
+	importance *[]*RunningMean,
+	allocs *BestSplitAllocs) {
+
+	nCases := fm.Data[0].Length()
+	projection := &DenseNumFeature{make([]float64, nCases), make([]bool, nCases), "OBLIQUE", true}
+	var oob []int
+
+	var grow func(n *Node, cases []int, depth int)
+	grow = func(n *Node, cases []int, depth int) {
+		n.Cover = float64(len(cases))
+		n.CodedSplit = nil
+		n.Splitter = nil
+
+		if (depth < maxDepth || maxDepth <= 0) && (2*leafSize) <= len(cases) {
+			fi, split, impDec, _ := fm.BestSplitter(target, &cases, &candidates, mTry, &oob, leafSize, false, false, false, false, allocs, 0)
+			oblique, featureis, shares, obliqueImpDec := fm.BestObliqueSplitter(target, cases, candidates, nFeatures, lda, leafSize, projection, allocs)
+			switch {
+			case oblique != nil && obliqueImpDec > impDec:
+				n.Splitter = oblique
+				if importance != nil {
+					for i, fi := range featureis {
+						(*importance)[fi].Add(shares[i] * obliqueImpDec)
+					}
+				}
+			case split != nil:
+				n.CodedSplit = split
+				n.Featurei = fi
+				n.Splitter = fm.Data[fi].DecodeSplit(split)
+				if importance != nil {
+					(*importance)[fi].Add(impDec)
+				}
+			}
+		}
+
+		if n.Splitter == nil {
+			n.Pred = target.FindPredicted(cases)
+			return
+		}
+		n.Pred = ""
+		l, r, _ := n.Splitter.Split(fm, cases)
+		n.Left = new(Node)
+		n.Right = new(Node)
+		grow(n.Left, l, depth+1)
+		grow(n.Right, r, depth+1)
+	}
+
+	if t.Root == nil {
+		t.Root = new(Node)
+	}
+	grow(t.Root, cases, 0)
+}
+
+/*
+BestObliqueSplitter finds the best split of cases on a projection of up to nFeatures numerical
+candidates chosen at random. The features are standardized over the cases that aren't missing
+any of them and projected onto the linear discriminant (if lda is true) or a random direction.
+The threshold is found by BestSplit on projection which should be a DenseNumFeature the length of
+fm that is overwritten for cases.
+
+It returns the splitter (in terms of the unstandardized features with the feature with the
+largest standardized weight first) or nil if no split decreasing impurity was found, the indexes
+of the features used, the share of the split attributable to each (the normalized magnitude of
+its standardized weight) and the impurity decrease.
+*/
+func (fm *FeatureMatrix) BestObliqueSplitter(target Target,
+	cases []int,
+	candidates []int,
+	nFeatures int,
+	lda bool,
+	leafSize int,
+	projection *DenseNumFeature,
+	allocs *BestSplitAllocs) (s *Splitter, featureis []int, shares []float64, impurityDecrease float64) {
+
+	impurityDecrease = minImp
+
+	numerical := make([]int, 0, len(candidates))
+	for _, i := range candidates {
+		if fm.Data[i].NCats() == 0 {
+			numerical = append(numerical, i)
+		}
+	}
+	if len(numerical) < 2 {
+		return
+	}
+	drawn := make([]int, 0, nFeatures)
+	for _, k := range allocs.Rnd.Perm(len(numerical)) {
+		if len(drawn) == nFeatures {
+			break
+		}
+		drawn = append(drawn, numerical[k])
+	}
+
+	complete := make([]int, 0, len(cases))
+	for _, c := range cases {
+		ok := true
+		for _, i := range drawn {
+			if fm.Data[i].IsMissing(c) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			complete = append(complete, c)
+		}
+	}
+	if len(complete) < 2*leafSize || len(complete) < 2 {
+		return
+	}
+
+	//Standardize dropping features that are constant on the complete cases.
+	means := make([]float64, 0, len(drawn))
+	sds := make([]float64, 0, len(drawn))
+	for _, i := range drawn {
+		f := fm.Data[i].(NumFeature)
+		mean, sumsqr := 0.0, 0.0
+		for _, c := range complete {
+			mean += f.Get(c)
+		}
+		mean /= float64(len(complete))
+		for _, c := range complete {
+			sumsqr += (f.Get(c) - mean) * (f.Get(c) - mean)
+		}
+		sd := math.Sqrt(sumsqr / float64(len(complete)))
+		if sd > 0 {
+			featureis = append(featureis, i)
+			means = append(means, mean)
+			sds = append(sds, sd)
+		}
+	}
+	if len(featureis) < 2 {
+		return
+	}
+	k := len(featureis)
+	z := make([][]float64, len(complete))
+	for j, c := range complete {
+		z[j] = make([]float64, k)
+		for i, fi := range featureis {
+			z[j][i] = (fm.Data[fi].(NumFeature).Get(c) - means[i]) / sds[i]
+		}
+	}
+
+	var w []float64
+	if lda {
+		w = discriminantDirection(target, complete, z)
+	}
+	if w == nil {
+		w = make([]float64, k)
+		for i := range w {
+			w[i] = allocs.Rnd.NormFloat64()
+		}
+	}
+	total := 0.0
+	for _, wi := range w {
+		total += math.Abs(wi)
+	}
+	if !(total > 0) {
+		return
+	}
+
+	//Put the feature with the largest weight first so it is used when a single feature is needed.
+	top := 0
+	for i := range w {
+		if math.Abs(w[i]) > math.Abs(w[top]) {
+			top = i
+		}
+	}
+	for _, a := range [][]float64{w, means, sds} {
+		a[0], a[top] = a[top], a[0]
+	}
+	featureis[0], featureis[top] = featureis[top], featureis[0]
+	for _, zj := range z {
+		zj[0], zj[top] = zj[top], zj[0]
+	}
+
+	//Express the projection in terms of the unstandardized features.
+	names := make([]string, k)
+	weights := make([]float64, k)
+	shares = make([]float64, k)
+	for i, fi := range featureis {
+		names[i] = fm.Data[fi].GetName()
+		weights[i] = w[i] / total / sds[i]
+		shares[i] = math.Abs(w[i]) / total
+	}
+	for _, c := range cases {
+		projection.Missing[c] = true
+	}
+	for j, c := range complete {
+		v := 0.0
+		for i := range featureis {
+			v += z[j][i] * w[i] / total
+		}
+		projection.NumData[c] = v
+		projection.Missing[c] = false
+	}
+
+	parentImp := target.Impurity(&cases, allocs.Counter)
+	split, imp, _ := projection.BestSplit(target, &cases, parentImp, leafSize, false, allocs)
+	if split == nil || !(imp > minImp) {
+		return nil, nil, nil, minImp
+	}
+
+	//Undo the centering of the standardized projection.
+	threshold := split.(float64)
+	for i := range featureis {
+		threshold += weights[i] * means[i]
+	}
+	return NewObliqueSplitter(names, weights, threshold), featureis, shares, imp
+}
+
+/*
+discriminantDirection returns Fisher's linear discriminant separating the most common class of a
+categorical target from the others in the standardized features z of cases or, for a numerical
+target, the least squares regression coefficients. A small ridge penalty is added to keep the
+system well conditioned. It returns nil if the direction can't be found.
+*/
+func discriminantDirection(target Target, cases []int, z [][]float64) []float64 {
+	k := len(z[0])
+	n := float64(len(cases))
+	a := make([][]float64, k)
+	for i := range a {
+		a[i] = make([]float64, k)
+		a[i][i] = 0.01
+	}
+	b := make([]float64, k)
+
+	if target.NCats() > 0 {
+		cf, ok := target.(CatFeature)
+		if !ok {
+			return nil
+		}
+		counts := make([]int, cf.NCats())
+		for _, c := range cases {
+			counts[cf.Geti(c)]++
+		}
+		common := 0
+		for i, count := range counts {
+			if count > counts[common] {
+				common = i
+			}
+		}
+		if counts[common] == len(cases) {
+			return nil
+		}
+
+		//Class means and pooled within class covariance.
+		mu := [2][]float64{make([]float64, k), make([]float64, k)}
+		ns := [2]float64{}
+		group := make([]int, len(cases))
+		for j, c := range cases {
+			if cf.Geti(c) == common {
+				group[j] = 1
+			}
+			ns[group[j]]++
+			for i := range z[j] {
+				mu[group[j]][i] += z[j][i]
+			}
+		}
+		for g := range mu {
+			for i := range mu[g] {
+				mu[g][i] /= ns[g]
+			}
+		}
+		for j := range cases {
+			m := mu[group[j]]
+			for r := 0; r < k; r++ {
+				for c := 0; c < k; c++ {
+					a[r][c] += (z[j][r] - m[r]) * (z[j][c] - m[c]) / n
+				}
+			}
+		}
+		for i := range b {
+			b[i] = mu[1][i] - mu[0][i]
+		}
+		return solveLinear(a, b)
+	}
+
+	nf, ok := target.(NumFeature)
+	if !ok {
+		return nil
+	}
+	mean := 0.0
+	for _, c := range cases {
+		mean += nf.Get(c)
+	}
+	mean /= n
+	for j, c := range cases {
+		y := nf.Get(c) - mean
+		for r := 0; r < k; r++ {
+			b[r] += z[j][r] * y / n
+			for c := 0; c < k; c++ {
+				a[r][c] += z[j][r] * z[j][c] / n
+			}
+		}
+	}
+	return solveLinear(a, b)
+}
+
+//solveLinear solves a x = b by gaussian elimination with partial pivoting, overwriting a and b.
+//It returns nil if a is singular.
+func solveLinear(a [][]float64, b []float64) []float64 {
+	k := len(b)
+	for col := 0; col < k; col++ {
+		pivot := col
+		for r := col + 1; r < k; r++ {
+			if math.Abs(a[r][col]) > math.Abs(a[pivot][col]) {
+				pivot = r
+			}
+		}
+		if a[pivot][col] == 0 {
+			return nil
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		b[col], b[pivot] = b[pivot], b[col]
+		for r := col + 1; r < k; r++ {
+			factor := a[r][col] / a[col][col]
+			for c := col; c < k; c++ {
+				a[r][c] -= factor * a[col][c]
+			}
+			b[r] -= factor * b[col]
+		}
+	}
+	x := make([]float64, k)
+	for r := k - 1; r >= 0; r-- {
+		x[r] = b[r]
+		for c := r + 1; c < k; c++ {
+			x[r] -= a[r][c] * x[c]
+		}
+		x[r] /= a[r][r]
+	}
+	return x
+}
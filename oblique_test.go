@@ -0,0 +1,71 @@
+package CloudForest
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestObliqueSplits(t *testing.T) {
+	//Two strongly correlated features with a class boundary along their difference.
+	ncases := 200
+	rnd := rand.New(rand.NewSource(1))
+	fm := syntheticAFM(rnd, ncases, []string{"C:class", "N:x1", "N:x2", "N:y"}, func(i int, rnd *rand.Rand) []interface{} {
+		shared := rnd.NormFloat64() * 5.0
+		x1 := shared + rnd.NormFloat64()
+		x2 := shared + rnd.NormFloat64()
+		class := "a"
+		if x1-x2 > 0 {
+			class = "b"
+		}
+		return []interface{}{class, x1, x2, x1 - x2}
+	})
+
+	cases := make([]int, ncases)
+	for i := range cases {
+		cases[i] = i
+	}
+
+	for _, targeti := range []int{0, 3} {
+		target := fm.Data[targeti].(Target)
+		tree := NewTree()
+		tree.GrowOblique(fm, target, cases, []int{1, 2}, 2, 2, true, 1, 1, nil, NewBestSplitAllocs(ncases, target))
+		s := tree.Root.Splitter
+		if s == nil || !s.IsOblique() || len(s.Features) != 2 {
+			t.Fatalf("Root of lda tree for %v wasn't oblique: %v", fm.Data[targeti].GetName(), s)
+		}
+		if s.Weights[0]*s.Weights[1] >= 0 {
+			t.Errorf("Lda weights for %v %v don't contrast the features.", fm.Data[targeti].GetName(), s.Weights)
+		}
+	}
+
+	//A deeper tree should classify the training cases well and survive a round trip through sf.
+	target := fm.Data[0].(Target)
+	tree := NewTree()
+	tree.GrowOblique(fm, target, cases, []int{1, 2}, 2, 2, true, 1, 4, nil, NewBestSplitAllocs(ncases, target))
+	forest := &Forest{"C:class", []*Tree{tree}, 0.0, nil}
+	buf := new(bytes.Buffer)
+	NewForestWriter(buf).WriteForest(forest)
+	if !strings.Contains(buf.String(), "SPLITTERTYPE=OBLIQUE") {
+		t.Errorf("Oblique splitter not written: %v", buf.String())
+	}
+	read, err := NewForestReader(buf).ReadForest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range []*Forest{forest, read} {
+		bb := NewCatBallotBox(ncases)
+		f.Trees[0].Vote(fm, bb)
+		wrong := 0
+		for i := 0; i < ncases; i++ {
+			if bb.Tally(i) != fm.Data[0].GetStr(i) {
+				wrong++
+			}
+		}
+		if wrong > ncases/10 {
+			t.Errorf("Oblique tree misclassified %v of %v cases.", wrong, ncases)
+		}
+	}
+}
@@ -0,0 +1,336 @@
+package CloudForest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+WriteONNX writes forest to w as an ONNX model with a single ai.onnx.ml TreeEnsembleClassifier or
+TreeEnsembleRegressor.
+
+The model's input "X" is a float tensor of shape [N, features] with a column per feature in the
+order they are described by meta, or forest.Metadata if meta is nil, followed by any features used
+in splits but not described. Categorical features are given as the index of the case's category
+in the feature's levels (NaN if missing) and their splits are encoded as chains of BRANCH_EQ nodes
+testing the categories on the smaller side of the split (always the left side if the feature isn't
+described as its levels may be incomplete), which copies the subtree on that side for each category
+after the first, so missing and unknown categories follow the other side. Cases
+missing a numerical feature follow MissingLeft. The column layout is also recorded as json
+FeatureMetadata in the model's "features" metadata property.
+
+method is "vote", "average", "sum" or "expit" and is inferred if empty: "sum" or, for a
+categorical target, "expit" for gradient boosted forests (with an intercept or the gbt option in
+their metadata), "vote" for other categorical targets and "average" otherwise. "vote" writes a
+classifier with outputs "label" and "probabilities", the fraction of (weighted) votes for each
+class. The others write a regressor with output "variable" that is the (weighted) mean or sum of
+the trees' predictions plus the intercept, passed through a LOGISTIC post transform (expit) for
+"expit" as done for gradient boosting classification.
+
+Trees with oblique splits or a missing branch can't be written.
+*/
+func WriteONNX(w io.Writer, forest *Forest, meta *ForestMetadata, method string) error {
+	if meta == nil {
+		meta = forest.Metadata
+	}
+	if meta == nil {
+		meta = new(ForestMetadata)
+	}
+	target := meta.Target
+	if target == nil {
+		target = &FeatureMetadata{forest.Target, "categorical", nil}
+		if strings.HasPrefix(forest.Target, "N:") {
+			target.Type = "numerical"
+		}
+	}
+	if method == "" {
+		gbt, _ := meta.Options["gbt"].(float64)
+		boosted := forest.Intercept != 0.0 || gbt != 0.0
+		switch {
+		case boosted && target.Type == "categorical":
+			method = "expit"
+		case boosted:
+			method = "sum"
+		case target.Type == "categorical":
+			method = "vote"
+		default:
+			method = "average"
+		}
+	}
+	if method != "vote" && method != "average" && method != "sum" && method != "expit" {
+		return fmt.Errorf("Unknown ONNX method %v.", method)
+	}
+
+	features, err := forestFeatures(forest, meta.Features)
+	if err != nil {
+		return err
+	}
+	e := &onnxEnsemble{columns: make(map[string]int), levels: make(map[string][]string)}
+	for i, f := range features {
+		e.columns[f.Name] = i
+		if f.Type == "categorical" {
+			e.levels[f.Name] = f.Levels
+		}
+	}
+	//Only described features are known to have all of their levels.
+	e.complete = make(map[string]bool, len(meta.Features))
+	for _, f := range meta.Features {
+		e.complete[f.Name] = true
+	}
+	if method == "vote" {
+		e.classes = make(map[string]int)
+		e.classlabels = append(e.classlabels, target.Levels...)
+		for i, label := range e.classlabels {
+			e.classes[label] = i
+		}
+		preds := make([]string, 0)
+		for _, tree := range forest.Trees {
+			tree.Root.Climb(func(n *Node) {
+				if n.Splitter == nil && !e.isClass(n.Pred) {
+					e.classes[n.Pred] = -1
+					preds = append(preds, n.Pred)
+				}
+			})
+		}
+		sort.Strings(preds)
+		for _, pred := range preds {
+			e.classes[pred] = len(e.classlabels)
+			e.classlabels = append(e.classlabels, pred)
+		}
+	}
+
+	//vote and average normalize the tree weights so trees contribute their share of the total.
+	total := 0.0
+	for _, tree := range forest.Trees {
+		total += onnxTreeWeight(tree)
+	}
+	for i, tree := range forest.Trees {
+		e.weight = onnxTreeWeight(tree)
+		if method == "vote" || method == "average" {
+			e.weight /= total
+		}
+		e.tree = int64(i)
+		e.nextid = 0
+		if _, err := e.build(tree.Root); err != nil {
+			return fmt.Errorf("Tree %v: %v", i, err)
+		}
+	}
+
+	node := &onnxNode{Inputs: []string{"X"}, Domain: "ai.onnx.ml", Attributes: e.nodeAttributes()}
+	var outputs []*onnxValueInfo
+	if method == "vote" {
+		node.Name, node.OpType = "TreeEnsembleClassifier", "TreeEnsembleClassifier"
+		node.Outputs = []string{"label", "probabilities"}
+		node.Attributes = append(node.Attributes,
+			&onnxAttribute{Name: "class_treeids", Type: onnxAttrInts, Ints: e.leaftrees},
+			&onnxAttribute{Name: "class_nodeids", Type: onnxAttrInts, Ints: e.leafnodes},
+			&onnxAttribute{Name: "class_ids", Type: onnxAttrInts, Ints: e.leafids},
+			&onnxAttribute{Name: "class_weights", Type: onnxAttrFloats, Floats: e.leafweights},
+			&onnxAttribute{Name: "classlabels_strings", Type: onnxAttrStrings, Strings: e.classlabels},
+			&onnxAttribute{Name: "post_transform", Type: onnxAttrString, S: "NONE"})
+		outputs = []*onnxValueInfo{
+			{"label", onnxString, []int64{-1}, "The predicted class."},
+			{"probabilities", onnxFloat, []int64{-1, int64(len(e.classlabels))}, "The fraction of votes for each class."}}
+	} else {
+		transform := "NONE"
+		if method == "expit" {
+			transform = "LOGISTIC"
+		}
+		node.Name, node.OpType = "TreeEnsembleRegressor", "TreeEnsembleRegressor"
+		node.Outputs = []string{"variable"}
+		node.Attributes = append(node.Attributes,
+			&onnxAttribute{Name: "target_treeids", Type: onnxAttrInts, Ints: e.leaftrees},
+			&onnxAttribute{Name: "target_nodeids", Type: onnxAttrInts, Ints: e.leafnodes},
+			&onnxAttribute{Name: "target_ids", Type: onnxAttrInts, Ints: e.leafids},
+			&onnxAttribute{Name: "target_weights", Type: onnxAttrFloats, Floats: e.leafweights},
+			&onnxAttribute{Name: "n_targets", Type: onnxAttrInt, I: 1},
+			&onnxAttribute{Name: "aggregate_function", Type: onnxAttrString, S: "SUM"},
+			&onnxAttribute{Name: "base_values", Type: onnxAttrFloats, Floats: []float32{float32(forest.Intercept)}},
+			&onnxAttribute{Name: "post_transform", Type: onnxAttrString, S: transform})
+		outputs = []*onnxValueInfo{{"variable", onnxFloat, []int64{-1, 1}, "The predicted value of " + forest.Target + "."}}
+	}
+
+	encoded, err := json.Marshal(features)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(features))
+	for _, f := range features {
+		names = append(names, f.Name)
+	}
+	model := &onnxModel{IRVersion: 8,
+		OpsetImports:    []*onnxOpset{{"", 17}, {"ai.onnx.ml", 3}},
+		ProducerName:    "CloudForest",
+		ProducerVersion: Version,
+		DocString:       "CloudForest forest predicting " + forest.Target,
+		Graph: &onnxGraph{[]*onnxNode{node},
+			"CloudForest",
+			[]*onnxValueInfo{{"X", onnxFloat, []int64{-1, int64(len(features))}, "Columns: " + strings.Join(names, ", ")}},
+			outputs},
+		MetadataProps: []*onnxStringPair{{"features", string(encoded)}, {"target", forest.Target}}}
+	var b protoBuffer
+	model.marshal(&b)
+	_, err = w.Write(b)
+	return err
+}
+
+//onnxTreeWeight returns the weight of a tree's votes.
+func onnxTreeWeight(tree *Tree) float64 {
+	if tree.Weight >= 0.0 {
+		return tree.Weight
+	}
+	return 1.0
+}
+
+//onnxEnsemble accumulates the node and leaf arrays of a tree ensemble operator.
+type onnxEnsemble struct {
+	columns     map[string]int
+	levels      map[string][]string
+	complete    map[string]bool
+	classes     map[string]int
+	classlabels []string
+
+	tree   int64
+	nextid int64
+	weight float64
+
+	treeids     []int64
+	nodeids     []int64
+	features    []int64
+	modes       []string
+	values      []float32
+	trueids     []int64
+	falseids    []int64
+	missingtrue []int64
+
+	leaftrees   []int64
+	leafnodes   []int64
+	leafids     []int64
+	leafweights []float32
+}
+
+func (e *onnxEnsemble) isClass(pred string) bool {
+	_, ok := e.classes[pred]
+	return ok
+}
+
+//addNode appends a node of the current tree and returns its index in the node arrays.
+func (e *onnxEnsemble) addNode(mode string, column int, value float32) int {
+	e.treeids = append(e.treeids, e.tree)
+	e.nodeids = append(e.nodeids, e.nextid)
+	e.features = append(e.features, int64(column))
+	e.modes = append(e.modes, mode)
+	e.values = append(e.values, value)
+	e.trueids = append(e.trueids, 0)
+	e.falseids = append(e.falseids, 0)
+	e.missingtrue = append(e.missingtrue, 0)
+	e.nextid++
+	return len(e.nodeids) - 1
+}
+
+//build converts n and its children and returns the id of the converted node.
+func (e *onnxEnsemble) build(n *Node) (id int64, err error) {
+	if n.Splitter == nil {
+		i := e.addNode("LEAF", 0, 0.0)
+		e.leaftrees = append(e.leaftrees, e.tree)
+		e.leafnodes = append(e.leafnodes, e.nodeids[i])
+		if e.classes != nil {
+			e.leafids = append(e.leafids, int64(e.classes[n.Pred]))
+			e.leafweights = append(e.leafweights, float32(e.weight))
+			return e.nodeids[i], nil
+		}
+		pred, perr := strconv.ParseFloat(n.Pred, 64)
+		if perr != nil {
+			return 0, fmt.Errorf("Leaf prediction %v isn't a number.", n.Pred)
+		}
+		e.leafids = append(e.leafids, 0)
+		e.leafweights = append(e.leafweights, float32(e.weight*pred))
+		return e.nodeids[i], nil
+	}
+	if n.Missing != nil {
+		return 0, fmt.Errorf("Splits with a missing branch on %v can't be converted.", n.Splitter.Feature)
+	}
+	if !n.Splitter.Numerical {
+		return e.categorical(n)
+	}
+	i := e.addNode("BRANCH_LEQ", e.columns[n.Splitter.Feature], float32(n.Splitter.Value))
+	if n.MissingLeft {
+		e.missingtrue[i] = 1
+	}
+	left, err := e.build(n.Left)
+	if err != nil {
+		return
+	}
+	right, err := e.build(n.Right)
+	e.trueids[i], e.falseids[i] = left, right
+	return e.nodeids[i], err
+}
+
+//categorical converts a categorical split into a chain of BRANCH_EQ nodes.
+func (e *onnxEnsemble) categorical(n *Node) (id int64, err error) {
+	var left, right []string
+	for cat := range n.Splitter.Left {
+		left = append(left, cat)
+	}
+	//The right side can only be tested if all of the feature's levels are known.
+	if e.complete[n.Splitter.Feature] {
+		for _, cat := range e.levels[n.Splitter.Feature] {
+			if !n.Splitter.Left[cat] {
+				right = append(right, cat)
+			}
+		}
+	}
+	if len(left) == 0 {
+		return e.build(n.Right)
+	}
+	sort.Strings(left)
+	chain, branch, other := left, n.Left, n.Right
+	if len(right) > 0 && len(right) < len(left) {
+		chain, branch, other = right, n.Right, n.Left
+	}
+	return e.chain(n.Splitter.Feature, chain, branch, other)
+}
+
+//chain adds a BRANCH_EQ node testing for the first of cats which leads to a copy of branch if true
+//and otherwise to a test of the next category or, after the last one, to a copy of other.
+func (e *onnxEnsemble) chain(feature string, cats []string, branch *Node, other *Node) (id int64, err error) {
+	code := -1
+	for i, level := range e.levels[feature] {
+		if level == cats[0] {
+			code = i
+		}
+	}
+	if code < 0 {
+		return 0, fmt.Errorf("Category %v of %v not found.", cats[0], feature)
+	}
+	i := e.addNode("BRANCH_EQ", e.columns[feature], float32(code))
+	in, err := e.build(branch)
+	if err != nil {
+		return
+	}
+	var out int64
+	if len(cats) > 1 {
+		out, err = e.chain(feature, cats[1:], branch, other)
+	} else {
+		out, err = e.build(other)
+	}
+	e.trueids[i], e.falseids[i] = in, out
+	return e.nodeids[i], err
+}
+
+//nodeAttributes returns the nodes_ attributes shared by the classifier and regressor.
+func (e *onnxEnsemble) nodeAttributes() []*onnxAttribute {
+	return []*onnxAttribute{
+		{Name: "nodes_treeids", Type: onnxAttrInts, Ints: e.treeids},
+		{Name: "nodes_nodeids", Type: onnxAttrInts, Ints: e.nodeids},
+		{Name: "nodes_featureids", Type: onnxAttrInts, Ints: e.features},
+		{Name: "nodes_modes", Type: onnxAttrStrings, Strings: e.modes},
+		{Name: "nodes_values", Type: onnxAttrFloats, Floats: e.values},
+		{Name: "nodes_truenodeids", Type: onnxAttrInts, Ints: e.trueids},
+		{Name: "nodes_falsenodeids", Type: onnxAttrInts, Ints: e.falseids},
+		{Name: "nodes_missing_value_tracks_true", Type: onnxAttrInts, Ints: e.missingtrue}}
+}
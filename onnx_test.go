@@ -0,0 +1,241 @@
+package CloudForest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+)
+
+//protoFields decodes a protobuf message into the varint or length delimited values of each field.
+func protoFields(t *testing.T, b []byte) map[int][][]byte {
+	fields := make(map[int][][]byte)
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		b = b[n:]
+		switch key & 7 {
+		case 0:
+			_, n = binary.Uvarint(b)
+			fields[int(key>>3)] = append(fields[int(key>>3)], b[:n])
+			b = b[n:]
+		case 2:
+			l, n := binary.Uvarint(b)
+			fields[int(key>>3)] = append(fields[int(key>>3)], b[n:n+int(l)])
+			b = b[n+int(l):]
+		default:
+			t.Fatalf("Unexpected wire type in %v.", key)
+		}
+	}
+	return fields
+}
+
+//onnxAttributes decodes the attributes of the tree ensemble node in an ONNX model.
+func onnxAttributes(t *testing.T, model []byte) (op string, ints map[string][]int64, floats map[string][]float32, strs map[string][]string, meta map[string]string) {
+	ints, floats, strs, meta = make(map[string][]int64), make(map[string][]float32), make(map[string][]string), make(map[string]string)
+	m := protoFields(t, model)
+	for _, prop := range m[14] {
+		p := protoFields(t, prop)
+		meta[string(p[1][0])] = string(p[2][0])
+	}
+	node := protoFields(t, protoFields(t, m[7][0])[1][0])
+	op = string(node[4][0])
+	for _, attr := range node[5] {
+		a := protoFields(t, attr)
+		name := string(a[1][0])
+		for _, s := range a[4] {
+			strs[name] = append(strs[name], string(s))
+		}
+		for _, s := range a[9] {
+			strs[name] = append(strs[name], string(s))
+		}
+		for _, packed := range a[7] {
+			for i := 0; i < len(packed); i += 4 {
+				floats[name] = append(floats[name], math.Float32frombits(binary.LittleEndian.Uint32(packed[i:])))
+			}
+		}
+		for _, v := range a[3] {
+			i, _ := binary.Uvarint(v)
+			ints[name] = append(ints[name], int64(i))
+		}
+		for _, packed := range a[8] {
+			for len(packed) > 0 {
+				v, n := binary.Uvarint(packed)
+				ints[name] = append(ints[name], int64(v))
+				packed = packed[n:]
+			}
+		}
+	}
+	return
+}
+
+//onnxScores evaluates a decoded tree ensemble on row as onnxruntime would before any post
+//transform.
+func onnxScores(op string, ints map[string][]int64, floats map[string][]float32, strs map[string][]string, row []float32, nscores int) []float64 {
+	prefix := "target_"
+	if op == "TreeEnsembleClassifier" {
+		prefix = "class_"
+	}
+	scores := make([]float64, nscores)
+	for i, v := range floats["base_values"] {
+		scores[i] = float64(v)
+	}
+	index := make(map[[2]int64]int)
+	for i := range ints["nodes_nodeids"] {
+		index[[2]int64{ints["nodes_treeids"][i], ints["nodes_nodeids"][i]}] = i
+	}
+	reached := make(map[[2]int64]bool)
+	for tree := range ints["nodes_treeids"] {
+		if ints["nodes_nodeids"][tree] != 0 {
+			continue
+		}
+		i := tree
+		for strs["nodes_modes"][i] != "LEAF" {
+			x := row[ints["nodes_featureids"][i]]
+			var goTrue bool
+			switch {
+			case x != x:
+				goTrue = ints["nodes_missing_value_tracks_true"][i] == 1
+			case strs["nodes_modes"][i] == "BRANCH_LEQ":
+				goTrue = x <= floats["nodes_values"][i]
+			default:
+				goTrue = x == floats["nodes_values"][i]
+			}
+			next := ints["nodes_falsenodeids"][i]
+			if goTrue {
+				next = ints["nodes_truenodeids"][i]
+			}
+			i = index[[2]int64{ints["nodes_treeids"][i], next}]
+		}
+		reached[[2]int64{ints["nodes_treeids"][i], ints["nodes_nodeids"][i]}] = true
+	}
+	for j, node := range ints[prefix+"nodeids"] {
+		if reached[[2]int64{ints[prefix+"treeids"][j], node}] {
+			scores[ints[prefix+"ids"][j]] += float64(floats[prefix+"weights"][j])
+		}
+	}
+	return scores
+}
+
+//onnxRow encodes case c of fm in the column layout described by features.
+func onnxRow(fm *FeatureMatrix, features []*FeatureMetadata, c int) []float32 {
+	row := make([]float32, len(features))
+	for i, desc := range features {
+		f := fm.Data[fm.Map[desc.Name]]
+		row[i] = float32(math.NaN())
+		switch {
+		case f.IsMissing(c):
+		case desc.Type == "categorical":
+			for code, level := range desc.Levels {
+				if level == f.GetStr(c) {
+					row[i] = float32(code)
+				}
+			}
+		default:
+			row[i] = float32(f.(NumFeature).Get(c))
+		}
+	}
+	return row
+}
+
+func TestWriteONNX(t *testing.T) {
+	data := ParseAFM(strings.NewReader(fm))
+	candidates := []int{2, 3, 4}
+
+	for _, targeti := range []int{0, 1} {
+		target := data.Data[targeti]
+		forest := GrowRandomForest(data, target, candidates, 8, 3, 10, 1, 0, false, false, false, false, nil)
+		forest.Trees[0].Weight = 2.0
+		for _, tree := range forest.Trees[1:] {
+			tree.Weight = 1.0
+		}
+		meta := NewForestMetadata(data, targeti, candidates, nil)
+
+		model := new(bytes.Buffer)
+		if err := WriteONNX(model, forest, meta, ""); err != nil {
+			t.Fatal(err)
+		}
+		op, ints, floats, strs, props := onnxAttributes(t, model.Bytes())
+		var features []*FeatureMetadata
+		if err := json.Unmarshal([]byte(props["features"]), &features); err != nil || len(features) != 3 {
+			t.Fatalf("Features metadata %v couldn't be parsed: %v", props["features"], err)
+		}
+
+		var bb VoteTallyer = NewNumBallotBox(8)
+		if targeti == 1 {
+			if op != "TreeEnsembleClassifier" || strings.Join(strs["classlabels_strings"], ",") != "0,1" {
+				t.Errorf("Classifier written as %v with classes %v.", op, strs["classlabels_strings"])
+			}
+			bb = NewCatBallotBox(8)
+		} else if op != "TreeEnsembleRegressor" || strs["post_transform"][0] != "NONE" {
+			t.Errorf("Regressor written as %v with post transform %v.", op, strs["post_transform"])
+		}
+		for _, tree := range forest.Trees {
+			tree.Vote(data, bb)
+		}
+		for c := 0; c < 8; c++ {
+			row := onnxRow(data, features, c)
+			if targeti == 0 {
+				scores := onnxScores(op, ints, floats, strs, row, 1)
+				if pred := bb.(*NumBallotBox).TallyNum(c); math.Abs(scores[0]-pred) > 1e-5 {
+					t.Errorf("ONNX prediction %v for case %v not %v.", scores[0], c, pred)
+				}
+				continue
+			}
+			scores := onnxScores(op, ints, floats, strs, row, 2)
+			if math.Abs(scores[0]+scores[1]-1.0) > 1e-5 {
+				t.Errorf("ONNX class probabilities %v for case %v don't sum to 1.", scores, c)
+			}
+			best := 0
+			if scores[1] > scores[0] {
+				best = 1
+			}
+			pred := bb.Tally(c)
+			if strs["classlabels_strings"][best] != pred && math.Abs(scores[0]-scores[1]) > 1e-5 {
+				t.Errorf("ONNX predicted class %v for case %v not %v.", strs["classlabels_strings"][best], c, pred)
+			}
+		}
+
+		if targeti == 0 {
+			//Gradient boosting classification.
+			forest.Intercept = 0.25
+			forest.Target = "C:CatTarget"
+			model.Reset()
+			if err := WriteONNX(model, forest, nil, ""); err != nil {
+				t.Fatal(err)
+			}
+			op, ints, floats, strs, props = onnxAttributes(t, model.Bytes())
+			//Without metadata the columns are the features used in splits.
+			features = nil
+			if err := json.Unmarshal([]byte(props["features"]), &features); err != nil {
+				t.Fatal(err)
+			}
+			if op != "TreeEnsembleRegressor" || strs["post_transform"][0] != "LOGISTIC" || floats["base_values"][0] != 0.25 {
+				t.Errorf("Boosted classifier written as %v with post transform %v and base values %v.", op, strs["post_transform"], floats["base_values"])
+			}
+			sbb := NewSumBallotBox(8)
+			for _, tree := range forest.Trees {
+				tree.Vote(data, sbb)
+			}
+			for c := 0; c < 8; c++ {
+				scores := onnxScores(op, ints, floats, strs, onnxRow(data, features, c), 1)
+				if math.Abs(scores[0]-(sbb.TallyNum(c)+forest.Intercept)) > 1e-4 {
+					t.Errorf("ONNX boosted score %v for case %v not %v.", scores[0], c, sbb.TallyNum(c)+forest.Intercept)
+				}
+			}
+		}
+	}
+
+	forest := &Forest{"N:NumTarget", []*Tree{NewTree()}, 0.0, nil}
+	forest.Trees[0].Root.Splitter = &Splitter{"N:FloatVar", true, 0.5, nil, nil, nil}
+	forest.Trees[0].AddNode("*L", "1", nil)
+	forest.Trees[0].AddNode("*R", "2", nil)
+	if err := WriteONNX(new(bytes.Buffer), forest, nil, "mode"); err == nil {
+		t.Error("Unknown method accepted.")
+	}
+	forest.Trees[0].AddNode("*M", "3", nil)
+	if err := WriteONNX(new(bytes.Buffer), forest, nil, ""); err == nil {
+		t.Error("Tree with a missing branch written.")
+	}
+}
@@ -0,0 +1,261 @@
+package CloudForest
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+/*
+The types in this file encode the subset of the ONNX protobuf messages (onnx.proto3) needed to
+write tree ensemble models. Field numbers and enum values follow onnx.proto3 and fields are
+written in the proto3 wire format (zero scalars are omitted and repeated numbers are packed) so
+no protobuf library is needed.
+*/
+
+//ONNX TensorProto.DataType values.
+const (
+	onnxFloat  = 1
+	onnxString = 8
+)
+
+//ONNX AttributeProto.AttributeType values.
+const (
+	onnxAttrInt     = 2
+	onnxAttrString  = 3
+	onnxAttrFloats  = 6
+	onnxAttrInts    = 7
+	onnxAttrStrings = 8
+)
+
+//protoBuffer accumulates a message in the protobuf wire format.
+type protoBuffer []byte
+
+func (b *protoBuffer) uvarint(v uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	*b = append(*b, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+func (b *protoBuffer) key(field int, wiretype int) {
+	b.uvarint(uint64(field<<3 | wiretype))
+}
+
+func (b *protoBuffer) putInt(field int, v int64) {
+	if v != 0 {
+		b.key(field, 0)
+		b.uvarint(uint64(v))
+	}
+}
+
+func (b *protoBuffer) putBytes(field int, v []byte) {
+	b.key(field, 2)
+	b.uvarint(uint64(len(v)))
+	*b = append(*b, v...)
+}
+
+func (b *protoBuffer) putString(field int, v string) {
+	if v != "" {
+		b.putBytes(field, []byte(v))
+	}
+}
+
+func (b *protoBuffer) putMessage(field int, m interface {
+	marshal(*protoBuffer)
+}) {
+	var inner protoBuffer
+	m.marshal(&inner)
+	b.putBytes(field, inner)
+}
+
+func (b *protoBuffer) putInts(field int, v []int64) {
+	if len(v) == 0 {
+		return
+	}
+	var packed protoBuffer
+	for _, i := range v {
+		packed.uvarint(uint64(i))
+	}
+	b.putBytes(field, packed)
+}
+
+func (b *protoBuffer) putFloats(field int, v []float32) {
+	if len(v) == 0 {
+		return
+	}
+	packed := make([]byte, 4*len(v))
+	for i, f := range v {
+		binary.LittleEndian.PutUint32(packed[4*i:], math.Float32bits(f))
+	}
+	b.putBytes(field, packed)
+}
+
+//onnxModel is a ModelProto.
+type onnxModel struct {
+	IRVersion       int64
+	OpsetImports    []*onnxOpset
+	ProducerName    string
+	ProducerVersion string
+	DocString       string
+	Graph           *onnxGraph
+	MetadataProps   []*onnxStringPair
+}
+
+func (m *onnxModel) marshal(b *protoBuffer) {
+	b.putInt(1, m.IRVersion)
+	b.putString(2, m.ProducerName)
+	b.putString(3, m.ProducerVersion)
+	b.putString(6, m.DocString)
+	b.putMessage(7, m.Graph)
+	for _, o := range m.OpsetImports {
+		b.putMessage(8, o)
+	}
+	for _, p := range m.MetadataProps {
+		b.putMessage(14, p)
+	}
+}
+
+//onnxOpset is an OperatorSetIdProto.
+type onnxOpset struct {
+	Domain  string
+	Version int64
+}
+
+func (o *onnxOpset) marshal(b *protoBuffer) {
+	b.putString(1, o.Domain)
+	b.putInt(2, o.Version)
+}
+
+//onnxStringPair is a StringStringEntryProto.
+type onnxStringPair struct {
+	Key   string
+	Value string
+}
+
+func (p *onnxStringPair) marshal(b *protoBuffer) {
+	b.putString(1, p.Key)
+	b.putString(2, p.Value)
+}
+
+//onnxGraph is a GraphProto.
+type onnxGraph struct {
+	Nodes   []*onnxNode
+	Name    string
+	Inputs  []*onnxValueInfo
+	Outputs []*onnxValueInfo
+}
+
+func (g *onnxGraph) marshal(b *protoBuffer) {
+	for _, n := range g.Nodes {
+		b.putMessage(1, n)
+	}
+	b.putString(2, g.Name)
+	for _, v := range g.Inputs {
+		b.putMessage(11, v)
+	}
+	for _, v := range g.Outputs {
+		b.putMessage(12, v)
+	}
+}
+
+//onnxNode is a NodeProto.
+type onnxNode struct {
+	Inputs     []string
+	Outputs    []string
+	Name       string
+	OpType     string
+	Domain     string
+	Attributes []*onnxAttribute
+}
+
+func (n *onnxNode) marshal(b *protoBuffer) {
+	for _, i := range n.Inputs {
+		b.putBytes(1, []byte(i))
+	}
+	for _, o := range n.Outputs {
+		b.putBytes(2, []byte(o))
+	}
+	b.putString(3, n.Name)
+	b.putString(4, n.OpType)
+	for _, a := range n.Attributes {
+		b.putMessage(5, a)
+	}
+	b.putString(7, n.Domain)
+}
+
+//onnxAttribute is an AttributeProto holding one of an int, string, floats, ints or strings as
+//given by Type.
+type onnxAttribute struct {
+	Name    string
+	Type    int64
+	I       int64
+	S       string
+	Floats  []float32
+	Ints    []int64
+	Strings []string
+}
+
+func (a *onnxAttribute) marshal(b *protoBuffer) {
+	b.putString(1, a.Name)
+	b.putInt(3, a.I)
+	b.putString(4, a.S)
+	b.putFloats(7, a.Floats)
+	b.putInts(8, a.Ints)
+	for _, s := range a.Strings {
+		b.putBytes(9, []byte(s))
+	}
+	b.putInt(20, a.Type)
+}
+
+//onnxValueInfo is a ValueInfoProto for a tensor with ElemType elements and shape Dims. Dims
+//less than 0 are written as the symbolic dimension "N".
+type onnxValueInfo struct {
+	Name      string
+	ElemType  int64
+	Dims      []int64
+	DocString string
+}
+
+func (v *onnxValueInfo) marshal(b *protoBuffer) {
+	b.putString(1, v.Name)
+	b.putMessage(2, onnxTypeProto{v})
+	b.putString(3, v.DocString)
+}
+
+//onnxTypeProto writes the TypeProto of a value.
+type onnxTypeProto struct {
+	*onnxValueInfo
+}
+
+func (t onnxTypeProto) marshal(b *protoBuffer) {
+	b.putMessage(1, onnxTensorType{t.onnxValueInfo})
+}
+
+//onnxTensorType writes the TypeProto.Tensor of a value.
+type onnxTensorType struct {
+	*onnxValueInfo
+}
+
+func (t onnxTensorType) marshal(b *protoBuffer) {
+	b.putInt(1, t.ElemType)
+	b.putMessage(2, onnxShape(t.Dims))
+}
+
+//onnxShape writes a TensorShapeProto.
+type onnxShape []int64
+
+func (s onnxShape) marshal(b *protoBuffer) {
+	for _, d := range s {
+		b.putMessage(1, onnxDim(d))
+	}
+}
+
+//onnxDim writes a TensorShapeProto.Dimension.
+type onnxDim int64
+
+func (d onnxDim) marshal(b *protoBuffer) {
+	if d < 0 {
+		b.putString(2, "N")
+		return
+	}
+	b.key(1, 0)
+	b.uvarint(uint64(d))
+}
@@ -0,0 +1,184 @@
+package CloudForest
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+//DependencePoint holds the predictions of a forest with the features of interest set to
+//Values for every case. ICE[class][case] is the individual conditional expectation of each
+//case and PD[class] the partial dependence (the mean over cases). For regression and gradient
+//boosting there is a single row.
+type DependencePoint struct {
+	Values []string
+	ICE    [][]float64
+	PD     []float64
+}
+
+/*
+DependenceGrid returns the values to set the named feature to when calculating partial
+dependence. For numerical features it is the n evenly spaced quantiles (from min to max) of the
+values present with repeats removed. For categorical features it is all of the categories.
+*/
+func (fm *FeatureMatrix) DependenceGrid(feature string, n int) (grid []string, err error) {
+	i, ok := fm.Map[feature]
+	if !ok {
+		err = fmt.Errorf("Feature %v not found in feature matrix.", feature)
+		return
+	}
+	f := fm.Data[i]
+	if f.NCats() > 0 {
+		cf := f.(CatFeature)
+		for c := 0; c < f.NCats(); c++ {
+			grid = append(grid, cf.NumToCat(c))
+		}
+		return
+	}
+
+	nf := f.(NumFeature)
+	vals := make([]float64, 0, f.Length())
+	for c := 0; c < f.Length(); c++ {
+		if !f.IsMissing(c) {
+			vals = append(vals, nf.Get(c))
+		}
+	}
+	if len(vals) == 0 || n < 1 {
+		return
+	}
+	sort.Float64s(vals)
+	last := math.NaN()
+	for k := 0; k < n; k++ {
+		q := 0
+		if n > 1 {
+			q = int(math.Floor(float64(k) * float64(len(vals)-1) / float64(n-1)))
+		}
+		if vals[q] != last {
+			grid = append(grid, fmt.Sprintf("%v", vals[q]))
+			last = vals[q]
+		}
+	}
+	return
+}
+
+/*
+PartialDependence calculates the partial dependence and individual conditional expectation
+curves of the forest's predictions on one or more features. For each combination of the values in
+grid (grid[k] holds the values for features[k], see DependenceGrid) the features are set to those
+values for every case in copies (Feature.Copy and PutStr) of their columns, the forest votes and
+the predictions are recorded.
+
+If classes is not nil predictions are the weighted fraction of votes for each class as in random
+forest classification. Otherwise they are the weighted mean vote plus the forest's Intercept, or if sum
+is true the weighted sum plus the Intercept as in gradient boosting.
+*/
+func (f *Forest) PartialDependence(fm *FeatureMatrix, features []string, grid [][]string, classes []string, sum bool) (points []*DependencePoint, err error) {
+	if len(features) == 0 || len(features) != len(grid) {
+		err = errors.New("Partial dependence needs a grid of values for each feature.")
+		return
+	}
+
+	//A shallow copy of fm with the features of interest replaced by copies.
+	ncases := fm.Data[0].Length()
+	pfm := &FeatureMatrix{make([]Feature, len(fm.Data)), fm.Map, fm.CaseLabels}
+	copy(pfm.Data, fm.Data)
+	copies := make([]Feature, 0, len(features))
+	for _, feature := range features {
+		i, ok := fm.Map[feature]
+		if !ok {
+			err = fmt.Errorf("Feature %v not found in feature matrix.", feature)
+			return
+		}
+		pfm.Data[i] = fm.Data[i].Copy()
+		copies = append(copies, pfm.Data[i])
+	}
+
+	//Iterate over the cartesian product of the grid.
+	index := make([]int, len(grid))
+	for _, g := range grid {
+		if len(g) == 0 {
+			return
+		}
+	}
+	for {
+		values := make([]string, 0, len(grid))
+		for k, g := range grid {
+			values = append(values, g[index[k]])
+			for c := 0; c < ncases; c++ {
+				copies[k].PutStr(c, g[index[k]])
+			}
+		}
+		points = append(points, f.dependencePoint(pfm, values, classes, sum))
+
+		k := len(index) - 1
+		for ; k >= 0; k-- {
+			index[k]++
+			if index[k] < len(grid[k]) {
+				break
+			}
+			index[k] = 0
+		}
+		if k < 0 {
+			break
+		}
+	}
+	return
+}
+
+//dependencePoint votes the forest over all cases in fm and records the predictions.
+func (f *Forest) dependencePoint(fm *FeatureMatrix, values []string, classes []string, sum bool) (p *DependencePoint) {
+	ncases := fm.Data[0].Length()
+	p = &DependencePoint{Values: values}
+
+	var bb VoteTallyer
+	switch {
+	case classes != nil:
+		bb = NewCatBallotBox(ncases)
+	case sum:
+		bb = NewSumBallotBox(ncases)
+	default:
+		bb = NewNumBallotBox(ncases)
+	}
+	for _, tree := range f.Trees {
+		tree.Vote(fm, bb)
+	}
+
+	switch bb.(type) {
+	case *CatBallotBox:
+		cbb := bb.(*CatBallotBox)
+		for _, class := range classes {
+			ice := make([]float64, ncases)
+			classi, voted := cbb.Map[class]
+			for c := 0; c < ncases; c++ {
+				total := 0.0
+				for _, v := range cbb.Box[c].Map {
+					total += v
+				}
+				if voted && total > 0 {
+					ice[c] = cbb.Box[c].Map[classi] / total
+				}
+			}
+			p.ICE = append(p.ICE, ice)
+		}
+	default:
+		ice := make([]float64, ncases)
+		for c := 0; c < ncases; c++ {
+			if sum {
+				ice[c] = bb.(*SumBallotBox).TallyNum(c) + f.Intercept
+			} else {
+				ice[c] = bb.(*NumBallotBox).TallyNum(c) + f.Intercept
+			}
+		}
+		p.ICE = append(p.ICE, ice)
+	}
+
+	for _, ice := range p.ICE {
+		mean := 0.0
+		for _, v := range ice {
+			mean += v
+		}
+		p.PD = append(p.PD, mean/float64(ncases))
+	}
+	return
+}
@@ -0,0 +1,81 @@
+package CloudForest
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestPartialDependence(t *testing.T) {
+	ncases := 200
+	rnd := rand.New(rand.NewSource(1))
+	fm := syntheticAFM(rnd, ncases, []string{"N:y", "N:x1", "N:x2", "C:x3"}, func(i int, rnd *rand.Rand) []interface{} {
+		x1 := rnd.Float64()
+		x3 := "a"
+		if rnd.Intn(2) == 0 {
+			x3 = "b"
+		}
+		y := 4 * x1
+		if x3 == "b" {
+			y += 2.0
+		}
+		return []interface{}{y, x1, rnd.Float64(), x3}
+	})
+	firstx1 := fm.Data[1].GetStr(0)
+	target := fm.Data[0]
+	candidates := []int{1, 2, 3}
+
+	forest := &Forest{Target: "N:y"}
+	allocs := NewBestSplitAllocs(ncases, target)
+	for i := 0; i < 20; i++ {
+		cases := make([]int, 0, ncases)
+		for len(cases) < ncases {
+			cases = append(cases, rnd.Intn(ncases))
+		}
+		tree := NewTree()
+		tree.Grow(fm, target, cases, candidates, nil, 2, 4, 0, false, false, false, false, false, 0, nil, nil, allocs)
+		forest.Trees = append(forest.Trees, tree)
+	}
+
+	x1grid, err := fm.DependenceGrid("N:x1", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(x1grid) != 10 {
+		t.Errorf("Numerical grid had %v values not 10.", len(x1grid))
+	}
+	x3grid, _ := fm.DependenceGrid("C:x3", 10)
+	if len(x3grid) != 2 {
+		t.Errorf("Categorical grid had %v values not 2.", len(x3grid))
+	}
+
+	points, err := forest.PartialDependence(fm, []string{"N:x1"}, [][]string{x1grid}, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != len(x1grid) {
+		t.Fatalf("Partial dependence had %v points not %v.", len(points), len(x1grid))
+	}
+	if len(points[0].ICE) != 1 || len(points[0].ICE[0]) != ncases {
+		t.Errorf("ICE curves not recorded for %v cases.", ncases)
+	}
+	if rise := points[len(points)-1].PD[0] - points[0].PD[0]; rise < 2.0 {
+		t.Errorf("Partial dependence on x1 rose by %v not close to 4.", rise)
+	}
+
+	points, err = forest.PartialDependence(fm, []string{"N:x1", "C:x3"}, [][]string{x1grid, x3grid}, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != len(x1grid)*len(x3grid) {
+		t.Errorf("Two way partial dependence had %v points not %v.", len(points), len(x1grid)*len(x3grid))
+	}
+
+	//The original data must not be changed.
+	if fm.Data[1].GetStr(0) != firstx1 {
+		t.Error("Partial dependence modified the feature matrix.")
+	}
+
+	if _, err = forest.PartialDependence(fm, []string{"N:NotAFeature"}, [][]string{x1grid}, nil, false); err == nil {
+		t.Error("Partial dependence on a missing feature didn't return an error.")
+	}
+}
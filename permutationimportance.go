@@ -0,0 +1,160 @@
+package CloudForest
+
+/*
+PermutationImportance adds Breiman's out of bag permutation importance for a single tree to imp.
+
+For each candidate feature the values of the feature are permuted among the out of bag cases
+(cases that are missing the target are ignored) using Feature.ShuffleCases on a copy of the feature
+and the cases are voted down the tree again. The increase in error (mean squared error for
+regression and the proportion of cases falsely classified for classification) over that of the
+unpermuted cases is added to the RunningMean for the feature's index in imp. Averaging over the
+trees of a forest gives the permutation importance of the feature. Features the tree doesn't
+split on (or use as surrogates) can't change its predictions and have 0.0 added without
+being permuted.
+
+If classImp is not nil and target is categorical the increase in the proportion of out of bag
+cases of each class that are falsely classified is also added to classImp[feature][class] where
+class is the index of the category in target.
+
+allocs is only used for its random number source so that trees can be evaluated in parallel.
+*/
+func (t *Tree) PermutationImportance(fm *FeatureMatrix,
+	target Feature,
+	oob []int,
+	candidates []int,
+	allocs *BestSplitAllocs,
+	imp *[]*RunningMean,
+	classImp []*[]*RunningMean) {
+	t.permutationImportance(fm, target, oob, candidates, nil, allocs, imp, classImp)
+}
+
+//permutationImportance implements PermutationImportance and ConditionalPermutationImportance.
+//If conditioning is not nil each feature is permuted within the cells of the grid defined by
+//this tree's splits on the features listed in conditioning[feature].
+func (t *Tree) permutationImportance(fm *FeatureMatrix,
+	target Feature,
+	oob []int,
+	candidates []int,
+	conditioning [][]int,
+	allocs *BestSplitAllocs,
+	imp *[]*RunningMean,
+	classImp []*[]*RunningMean) {
+
+	cases := make([]int, 0, len(oob))
+	for _, c := range oob {
+		if !target.IsMissing(c) {
+			cases = append(cases, c)
+		}
+	}
+	if len(cases) == 0 {
+		return
+	}
+
+	used := make([]bool, len(fm.Data))
+	t.Root.Climb(func(n *Node) {
+		if n.Splitter != nil {
+			for _, name := range n.Splitter.UsedFeatures() {
+				used[fm.Map[name]] = true
+			}
+		}
+		for _, s := range n.Surrogates {
+			used[fm.Map[s.Splitter.Feature]] = true
+		}
+	})
+
+	ncats := target.NCats()
+	if ncats == 0 {
+		classImp = nil
+	}
+	var classCounts, baseClassErr, classErr []float64
+	if classImp != nil {
+		classCounts = make([]float64, ncats)
+		baseClassErr = make([]float64, ncats)
+		classErr = make([]float64, ncats)
+		for _, c := range cases {
+			classCounts[target.(CatFeature).Geti(c)]++
+		}
+	}
+
+	work := make([]int, len(cases))
+	copy(work, cases)
+	baseErr := t.oobError(fm, target, work, baseClassErr)
+
+	//A shallow copy of the feature matrix so that permuted features can be swapped in without
+	//effecting other trees using fm.
+	pfm := &FeatureMatrix{make([]Feature, len(fm.Data)), fm.Map, fm.CaseLabels}
+	copy(pfm.Data, fm.Data)
+
+	for _, i := range candidates {
+		e := 0.0
+		if used[i] {
+			permuted := fm.Data[i].Copy()
+			copy(work, cases)
+			if conditioning != nil && len(conditioning[i]) > 0 {
+				for _, cell := range t.conditioningCells(fm, work, conditioning[i]) {
+					permuted.ShuffleCases(&cell, allocs)
+				}
+			} else {
+				permuted.ShuffleCases(&work, allocs)
+			}
+			pfm.Data[i] = permuted
+			copy(work, cases)
+			e = t.oobError(pfm, target, work, classErr) - baseErr
+			pfm.Data[i] = fm.Data[i]
+		}
+		(*imp)[i].Add(e)
+
+		if classImp != nil {
+			for k, n := range classCounts {
+				if n == 0 {
+					continue
+				}
+				ce := 0.0
+				if used[i] {
+					ce = (classErr[k] - baseClassErr[k]) / n
+				}
+				(*classImp[i])[k].Add(ce)
+			}
+		}
+	}
+}
+
+//oobError returns the mean squared error or proportion of cases falsely classified by the tree
+//over the specified cases (which are reordered) and, if classErr is not nil, fills it with the
+//number of cases of each class that were falsely classified. Cases that don't reach a leaf
+//are counted as correctly predicted.
+func (t *Tree) oobError(fm *FeatureMatrix, target Feature, cases []int, classErr []float64) (e float64) {
+	for k := range classErr {
+		classErr[k] = 0.0
+	}
+	ncases := float64(len(cases))
+
+	switch target.NCats() {
+	case 0:
+		nf := target.(NumFeature)
+		t.Root.Recurse(func(n *Node, cases []int, depth int) {
+			if n.Left == nil && n.Right == nil {
+				pred := ParseFloat(n.Pred)
+				for _, c := range cases {
+					d := nf.Get(c) - pred
+					e += d * d
+				}
+			}
+		}, fm, cases, 0)
+	default:
+		cf := target.(CatFeature)
+		t.Root.Recurse(func(n *Node, cases []int, depth int) {
+			if n.Left == nil && n.Right == nil {
+				for _, c := range cases {
+					if cf.NumToCat(cf.Geti(c)) != n.Pred {
+						e++
+						if classErr != nil {
+							classErr[cf.Geti(c)]++
+						}
+					}
+				}
+			}
+		}, fm, cases, 0)
+	}
+	return e / ncases
+}
@@ -0,0 +1,371 @@
+package CloudForest
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//PMMLVersion is the version of PMML written by WritePMML.
+const PMMLVersion = "4.4"
+
+type pmmlDocument struct {
+	XMLName        xml.Name           `xml:"PMML"`
+	Xmlns          string             `xml:"xmlns,attr"`
+	Version        string             `xml:"version,attr"`
+	Header         pmmlHeader         `xml:"Header"`
+	DataDictionary pmmlDataDictionary `xml:"DataDictionary"`
+	MiningModel    pmmlMiningModel    `xml:"MiningModel"`
+}
+
+type pmmlHeader struct {
+	Description string          `xml:"description,attr"`
+	Application pmmlApplication `xml:"Application"`
+	Timestamp   string          `xml:"Timestamp,omitempty"`
+}
+
+type pmmlApplication struct {
+	Name    string `xml:"name,attr"`
+	Version string `xml:"version,attr"`
+}
+
+type pmmlDataDictionary struct {
+	NumberOfFields int             `xml:"numberOfFields,attr"`
+	DataFields     []pmmlDataField `xml:"DataField"`
+}
+
+type pmmlDataField struct {
+	Name     string      `xml:"name,attr"`
+	Optype   string      `xml:"optype,attr"`
+	DataType string      `xml:"dataType,attr"`
+	Values   []pmmlValue `xml:"Value"`
+}
+
+type pmmlValue struct {
+	Value string `xml:"value,attr"`
+}
+
+type pmmlMiningField struct {
+	Name      string `xml:"name,attr"`
+	UsageType string `xml:"usageType,attr,omitempty"`
+}
+
+type pmmlTargets struct {
+	Targets []pmmlTarget `xml:"Target"`
+}
+
+type pmmlTarget struct {
+	Field           string  `xml:"field,attr"`
+	RescaleConstant float64 `xml:"rescaleConstant,attr"`
+}
+
+type pmmlMiningModel struct {
+	FunctionName string            `xml:"functionName,attr"`
+	MiningSchema []pmmlMiningField `xml:"MiningSchema>MiningField"`
+	Targets      *pmmlTargets      `xml:"Targets"`
+	Segmentation pmmlSegmentation  `xml:"Segmentation"`
+}
+
+type pmmlSegmentation struct {
+	MultipleModelMethod string        `xml:"multipleModelMethod,attr"`
+	Segments            []pmmlSegment `xml:"Segment"`
+}
+
+type pmmlSegment struct {
+	ID        string        `xml:"id,attr"`
+	Weight    string        `xml:"weight,attr,omitempty"`
+	Predicate pmmlTrue      `xml:"True"`
+	TreeModel pmmlTreeModel `xml:"TreeModel"`
+}
+
+type pmmlTreeModel struct {
+	FunctionName         string            `xml:"functionName,attr"`
+	MissingValueStrategy string            `xml:"missingValueStrategy,attr"`
+	NoTrueChildStrategy  string            `xml:"noTrueChildStrategy,attr"`
+	SplitCharacteristic  string            `xml:"splitCharacteristic,attr"`
+	MiningSchema         []pmmlMiningField `xml:"MiningSchema>MiningField"`
+	Node                 *pmmlNode         `xml:"Node"`
+}
+
+type pmmlNode struct {
+	ID           string      `xml:"id,attr"`
+	Score        string      `xml:"score,attr,omitempty"`
+	DefaultChild string      `xml:"defaultChild,attr,omitempty"`
+	Predicate    interface{} `xml:",any"`
+	Nodes        []*pmmlNode `xml:"Node"`
+}
+
+type pmmlTrue struct {
+	XMLName xml.Name `xml:"True"`
+}
+
+type pmmlFalse struct {
+	XMLName xml.Name `xml:"False"`
+}
+
+type pmmlSimplePredicate struct {
+	XMLName  xml.Name `xml:"SimplePredicate"`
+	Field    string   `xml:"field,attr"`
+	Operator string   `xml:"operator,attr"`
+	Value    string   `xml:"value,attr,omitempty"`
+}
+
+type pmmlSimpleSetPredicate struct {
+	XMLName         xml.Name  `xml:"SimpleSetPredicate"`
+	Field           string    `xml:"field,attr"`
+	BooleanOperator string    `xml:"booleanOperator,attr"`
+	Array           pmmlArray `xml:"Array"`
+}
+
+type pmmlArray struct {
+	N      int    `xml:"n,attr"`
+	Type   string `xml:"type,attr"`
+	Values string `xml:",chardata"`
+}
+
+type pmmlCompoundPredicate struct {
+	XMLName         xml.Name      `xml:"CompoundPredicate"`
+	BooleanOperator string        `xml:"booleanOperator,attr"`
+	Predicates      []interface{} `xml:",any"`
+}
+
+/*
+WritePMML writes forest to w as a PMML 4.4 document containing a MiningModel with a TreeModel
+segment for each tree.
+
+Fields are described by meta, or forest.Metadata if meta is nil, and any feature used in a split
+but not described is added as numerical or categorical (with the categories seen in splits) by
+the type of the split. method is "vote" (majority vote classification), "average" or "sum"
+(regression); if it is empty "vote" is used for categorical targets, "sum" for forests with an
+intercept (gradient boosting) and "average" otherwise. Tree weights make the method weighted and
+a non zero intercept is added to the prediction as the rescaleConstant of the target. For sum
+and average the target is written as a continuous field.
+
+Numerical splits become SimplePredicates and categorical splits SimpleSetPredicates. Missing
+branches are a third child with an isMissing predicate. Surrogates become surrogate
+CompoundPredicates ending with the MissingLeft direction and every split node's defaultChild is
+the Missing branch if there is one and otherwise the MissingLeft direction. Oblique splits can't be
+written.
+*/
+func WritePMML(w io.Writer, forest *Forest, meta *ForestMetadata, method string) error {
+	if meta == nil {
+		meta = forest.Metadata
+	}
+	if meta == nil {
+		meta = new(ForestMetadata)
+	}
+
+	target := meta.Target
+	if target == nil {
+		target = &FeatureMetadata{forest.Target, "categorical", nil}
+		if strings.HasPrefix(forest.Target, "N:") {
+			target.Type = "numerical"
+		}
+	}
+	if method == "" {
+		switch {
+		case target.Type == "categorical" && forest.Intercept == 0.0:
+			method = "vote"
+		case forest.Intercept != 0.0:
+			method = "sum"
+		default:
+			method = "average"
+		}
+	}
+	function := "regression"
+	switch method {
+	case "vote":
+		function = "classification"
+		method = "majorityVote"
+	case "average", "sum":
+		target = &FeatureMetadata{target.Name, "numerical", nil}
+	default:
+		return fmt.Errorf("Unknown PMML segmentation method %v.", method)
+	}
+	for _, tree := range forest.Trees {
+		if tree.Weight >= 0.0 {
+			method = "weighted" + strings.ToUpper(method[:1]) + method[1:]
+			break
+		}
+	}
+
+	features, err := forestFeatures(forest, meta.Features)
+	if err != nil {
+		return err
+	}
+	doc := &pmmlDocument{Xmlns: "http://www.dmg.org/PMML-4_4", Version: PMMLVersion}
+	doc.Header = pmmlHeader{"CloudForest forest predicting " + forest.Target,
+		pmmlApplication{"CloudForest", Version},
+		meta.Timestamp}
+	schema := []pmmlMiningField{{target.Name, "target"}}
+	for _, f := range append([]*FeatureMetadata{target}, features...) {
+		field := pmmlDataField{f.Name, "continuous", "double", nil}
+		if f.Type == "categorical" {
+			field.Optype, field.DataType = "categorical", "string"
+			for _, level := range f.Levels {
+				field.Values = append(field.Values, pmmlValue{level})
+			}
+		}
+		doc.DataDictionary.DataFields = append(doc.DataDictionary.DataFields, field)
+		if f != target {
+			schema = append(schema, pmmlMiningField{f.Name, "active"})
+		}
+	}
+	doc.DataDictionary.NumberOfFields = len(doc.DataDictionary.DataFields)
+
+	doc.MiningModel = pmmlMiningModel{function, schema, nil, pmmlSegmentation{method, nil}}
+	if forest.Intercept != 0.0 {
+		doc.MiningModel.Targets = &pmmlTargets{[]pmmlTarget{{target.Name, forest.Intercept}}}
+	}
+	for i, tree := range forest.Trees {
+		ids := 0
+		root, err := pmmlTreeNode(tree.Root, pmmlTrue{}, &ids)
+		if err != nil {
+			return fmt.Errorf("Tree %v: %v", i, err)
+		}
+		segment := pmmlSegment{ID: strconv.Itoa(i + 1),
+			TreeModel: pmmlTreeModel{function, "defaultChild", "returnLastPrediction", "multiSplit", schema, root}}
+		if tree.Weight >= 0.0 {
+			segment.Weight = strconv.FormatFloat(tree.Weight, 'g', -1, 64)
+		}
+		doc.MiningModel.Segmentation.Segments = append(doc.MiningModel.Segmentation.Segments, segment)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+//forestFeatures returns described followed by any features used in splits of forest that aren't
+//described.
+func forestFeatures(forest *Forest, described []*FeatureMetadata) (features []*FeatureMetadata, err error) {
+	features = append(features, described...)
+	added := make(map[string]*FeatureMetadata)
+	for _, f := range described {
+		added[f.Name] = nil
+	}
+	add := func(s *Splitter) {
+		if s.IsOblique() {
+			err = fmt.Errorf("Oblique splits on %v can't be exported.", s.Feature)
+			return
+		}
+		f, ok := added[s.Feature]
+		if !ok {
+			f = &FeatureMetadata{s.Feature, "numerical", nil}
+			added[s.Feature] = f
+			features = append(features, f)
+		}
+		if f == nil || s.Numerical {
+			return
+		}
+		f.Type = "categorical"
+		for cat := range s.Left {
+			i := sort.SearchStrings(f.Levels, cat)
+			if i == len(f.Levels) || f.Levels[i] != cat {
+				f.Levels = append(f.Levels[:i], append([]string{cat}, f.Levels[i:]...)...)
+			}
+		}
+	}
+	for _, tree := range forest.Trees {
+		tree.Root.Climb(func(n *Node) {
+			if n.Splitter == nil {
+				return
+			}
+			add(n.Splitter)
+			for _, s := range n.Surrogates {
+				add(s.Splitter)
+			}
+		})
+	}
+	return
+}
+
+//pmmlPredicate returns the predicate satisfied by cases that s sends left or, if left is false,
+//right.
+func pmmlPredicate(s *Splitter, left bool) interface{} {
+	if s.Numerical {
+		op := "greaterThan"
+		if left {
+			op = "lessOrEqual"
+		}
+		return pmmlSimplePredicate{Field: s.Feature, Operator: op, Value: strconv.FormatFloat(s.Value, 'g', -1, 64)}
+	}
+	cats := make([]string, 0, len(s.Left))
+	for cat := range s.Left {
+		cats = append(cats, cat)
+	}
+	sort.Strings(cats)
+	quoted := make([]string, 0, len(cats))
+	for _, cat := range cats {
+		quoted = append(quoted, `"`+strings.Replace(strings.Replace(cat, `\`, `\\`, -1), `"`, `\"`, -1)+`"`)
+	}
+	op := "isNotIn"
+	if left {
+		op = "isIn"
+	}
+	return pmmlSimpleSetPredicate{Field: s.Feature, BooleanOperator: op, Array: pmmlArray{len(cats), "string", strings.Join(quoted, " ")}}
+}
+
+//pmmlTreeNode converts n, which is reached when predicate is true, and its children numbering
+//them from ids in pre order.
+func pmmlTreeNode(n *Node, predicate interface{}, ids *int) (*pmmlNode, error) {
+	pn := &pmmlNode{ID: strconv.Itoa(*ids), Score: n.Pred, Predicate: predicate}
+	*ids++
+	if n.Splitter == nil {
+		return pn, nil
+	}
+	if n.Splitter.IsOblique() {
+		return nil, fmt.Errorf("Oblique splits on %v can't be exported.", n.Splitter.Feature)
+	}
+
+	branch := func(left bool) interface{} {
+		p := pmmlPredicate(n.Splitter, left)
+		if n.Missing != nil || len(n.Surrogates) == 0 {
+			return p
+		}
+		compound := pmmlCompoundPredicate{BooleanOperator: "surrogate", Predicates: []interface{}{p}}
+		for _, s := range n.Surrogates {
+			compound.Predicates = append(compound.Predicates, pmmlPredicate(s.Splitter, left != s.Reversed))
+		}
+		if n.MissingLeft == left {
+			compound.Predicates = append(compound.Predicates, pmmlTrue{})
+		} else {
+			compound.Predicates = append(compound.Predicates, pmmlFalse{})
+		}
+		return compound
+	}
+	defaultChild := 1
+	switch {
+	case n.Missing != nil:
+		defaultChild = 2
+	case n.MissingLeft:
+		defaultChild = 0
+	}
+	children := []*Node{n.Left, n.Right, n.Missing}
+	predicates := []interface{}{branch(true), branch(false),
+		pmmlSimplePredicate{Field: n.Splitter.Feature, Operator: "isMissing"}}
+	for i, child := range children {
+		if child == nil {
+			continue
+		}
+		c, err := pmmlTreeNode(child, predicates[i], ids)
+		if err != nil {
+			return nil, err
+		}
+		pn.Nodes = append(pn.Nodes, c)
+		if i == defaultChild {
+			pn.DefaultChild = c.ID
+		}
+	}
+	return pn, nil
+}
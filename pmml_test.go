@@ -0,0 +1,78 @@
+package CloudForest
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+func TestWritePMML(t *testing.T) {
+	tree := &Tree{nil, "C:CatTarget", -1.0}
+	root := tree.AddNode("*", "0", &Splitter{"C:QuadVar", false, 0.0, map[string]bool{"0": true, "3": true}, nil, nil})
+	root.Surrogates = []*Surrogate{{&Splitter{"N:FloatVar", true, 0.5, nil, nil, nil}, true, 0.8}}
+	tree.AddNode("*L", "0", &Splitter{"N:FloatVar", true, 0.5, nil, nil, nil})
+	tree.AddNode("*LL", "1", nil)
+	tree.AddNode("*LR", "0", nil)
+	tree.AddNode("*LM", "1", nil)
+	tree.AddNode("*R", "1", nil)
+	forest := &Forest{"C:CatTarget", []*Tree{tree, tree}, 0.0, nil}
+
+	pmml := new(bytes.Buffer)
+	if err := WritePMML(pmml, forest, nil, ""); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		`<PMML xmlns="http://www.dmg.org/PMML-4_4" version="4.4">`,
+		`<DataField name="C:QuadVar" optype="categorical" dataType="string">`,
+		`<DataField name="N:FloatVar" optype="continuous" dataType="double"></DataField>`,
+		`<MiningModel functionName="classification">`,
+		`<Segmentation multipleModelMethod="majorityVote">`,
+		`<Node id="0" score="0" defaultChild="5">`,
+		`<CompoundPredicate booleanOperator="surrogate">`,
+		`<SimpleSetPredicate field="C:QuadVar" booleanOperator="isIn">`,
+		`<Array n="2" type="string">&#34;0&#34; &#34;3&#34;</Array>`,
+		`<SimplePredicate field="N:FloatVar" operator="greaterThan" value="0.5"></SimplePredicate>`,
+		`<Node id="1" score="0" defaultChild="4">`,
+		`<SimplePredicate field="N:FloatVar" operator="isMissing"></SimplePredicate>`} {
+		if !strings.Contains(pmml.String(), line) {
+			t.Errorf("PMML doesn't contain %v:\n%v", line, pmml.String())
+		}
+	}
+	var doc pmmlDocument
+	if err := xml.Unmarshal(pmml.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.MiningModel.Segmentation.Segments) != 2 || doc.DataDictionary.NumberOfFields != 3 {
+		t.Errorf("PMML has %v segments and %v fields not 2 and 3.", len(doc.MiningModel.Segmentation.Segments), doc.DataDictionary.NumberOfFields)
+	}
+
+	//Boosted regression with metadata.
+	data := ParseAFM(strings.NewReader(fm))
+	tree.Weight = 0.1
+	forest.Intercept = 0.5
+	forest.Target = "N:NumTarget"
+	pmml.Reset()
+	if err := WritePMML(pmml, forest, NewForestMetadata(data, 0, []int{2, 3, 4}, nil), ""); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		`<Value value="4"></Value>`,
+		`<DataField name="C:BoolVar" optype="categorical" dataType="string">`,
+		`<MiningModel functionName="regression">`,
+		`<Target field="N:NumTarget" rescaleConstant="0.5"></Target>`,
+		`<Segmentation multipleModelMethod="weightedSum">`,
+		`<Segment id="2" weight="0.1">`} {
+		if !strings.Contains(pmml.String(), line) {
+			t.Errorf("PMML doesn't contain %v:\n%v", line, pmml.String())
+		}
+	}
+
+	if err := WritePMML(pmml, forest, nil, "median"); err == nil {
+		t.Error("Unknown segmentation method accepted.")
+	}
+	tree.Root.Left.Splitter = NewObliqueSplitter([]string{"N:FloatVar", "N:NumTarget"}, []float64{1, 1}, 0)
+	if err := WritePMML(pmml, forest, nil, ""); err == nil {
+		t.Error("Oblique split written as PMML.")
+	}
+}
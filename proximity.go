@@ -0,0 +1,254 @@
+package CloudForest
+
+import (
+	"math"
+	"sort"
+)
+
+//CountProximity adds one to counts for every pair of the specified cases (including each case
+//paired with itself) that land in the same leaf of the tree.
+func (t *Tree) CountProximity(fm *FeatureMatrix, cases []int, counts *ShardedCounter) {
+	t.Root.Recurse(func(n *Node, cases []int, depth int) {
+		if n.Left == nil && n.Right == nil {
+			for _, c := range cases {
+				counts.AddRow(c, cases, 1)
+			}
+		}
+	}, fm, append([]int(nil), cases...), 0)
+}
+
+//CaseTrees holds for each case the increasing indexes of the trees it was out of bag for so
+//that proximities counted only on out of bag pairs can be normalized.
+type CaseTrees [][]int
+
+//NewCaseTrees returns an empty CaseTrees for nCases cases.
+func NewCaseTrees(nCases int) CaseTrees {
+	return make(CaseTrees, nCases)
+}
+
+//AddTree records that the specified cases were out of bag for tree. Trees must be added in
+//increasing order.
+func (ct CaseTrees) AddTree(tree int, cases []int) {
+	for _, c := range cases {
+		if n := len(ct[c]); n == 0 || ct[c][n-1] != tree {
+			ct[c] = append(ct[c], tree)
+		}
+	}
+}
+
+//Shared returns the number of trees both case i and case j were out of bag for.
+func (ct CaseTrees) Shared(i int, j int) (shared int) {
+	a, b := ct[i], ct[j]
+	for x, y := 0, 0; x < len(a) && y < len(b); {
+		switch {
+		case a[x] < b[y]:
+			x++
+		case a[x] > b[y]:
+			y++
+		default:
+			shared++
+			x++
+			y++
+		}
+	}
+	return
+}
+
+/*
+NormalizeProximity divides the counts of leaf co-occurrence by the number of trees each pair
+was counted in giving proximities between 0 and 1. This is nTrees or, if oob isn't nil, the
+number of trees both cases were out of bag for. prox[i] holds the non zero proximities of case i.
+*/
+func NormalizeProximity(counts *ShardedCounter, nCases int, nTrees int, oob CaseTrees) (prox []map[int]float64) {
+	prox = make([]map[int]float64, nCases)
+	for i := 0; i < nCases; i++ {
+		row := counts.Row(i)
+		prox[i] = make(map[int]float64, len(row))
+		for j, count := range row {
+			total := float64(nTrees)
+			if oob != nil {
+				total = float64(oob.Shared(i, j))
+			}
+			if total > 0 {
+				prox[i][j] = float64(count) / total
+			}
+		}
+	}
+	return
+}
+
+/*
+OutlierScores returns Breiman's outlier measure for each case. The raw measure of a case is
+the number of cases in its class divided by the sum of its squared proximities to the other
+cases in its class. Within each class raw measures are centered on their median and divided by
+their median absolute deviation. Cases with no proximity to their class have an infinite score.
+
+labels gives the class of each case. If it is nil all cases are treated as a single class as
+for regression or unsupervised forests.
+*/
+func OutlierScores(prox []map[int]float64, labels []string) (scores []float64) {
+	nCases := len(prox)
+	scores = make([]float64, nCases)
+	classes := make(map[string][]int)
+	for i := 0; i < nCases; i++ {
+		label := ""
+		if labels != nil {
+			label = labels[i]
+		}
+		classes[label] = append(classes[label], i)
+	}
+
+	for label, members := range classes {
+		for _, i := range members {
+			sum := 0.0
+			for j, p := range prox[i] {
+				if j != i && (labels == nil || labels[j] == label) {
+					sum += p * p
+				}
+			}
+			scores[i] = math.Inf(1)
+			if sum > 0 {
+				scores[i] = float64(len(members)) / sum
+			}
+		}
+
+		raw := make([]float64, 0, len(members))
+		for _, i := range members {
+			raw = append(raw, scores[i])
+		}
+		med := median(raw)
+		for k, v := range raw {
+			raw[k] = math.Abs(v - med)
+		}
+		mad := median(raw)
+		for _, i := range members {
+			scores[i] -= med
+			if mad > 0 && !math.IsInf(mad, 0) {
+				scores[i] /= mad
+			}
+		}
+	}
+	return
+}
+
+//median returns the median of values, which are sorted in place.
+func median(values []float64) float64 {
+	sort.Float64s(values)
+	n := len(values)
+	if n%2 == 1 {
+		return values[n/2]
+	}
+	return (values[n/2-1] + values[n/2]) / 2
+}
+
+/*
+ClassicalMDS returns the k dimensional classical (Torgerson) multidimensional scaling
+coordinates of each case using 1 - proximity as the distance between cases along with the
+eigenvalue of each dimension. The doubly centered matrix of squared distances is built in memory
+(nCases by nCases) and its largest eigenvalues are found by power iteration with deflation.
+Dimensions without a positive eigenvalue have coordinates of 0.
+*/
+func ClassicalMDS(prox []map[int]float64, k int) (coords [][]float64, eigenvalues []float64) {
+	n := len(prox)
+	b := make([][]float64, n)
+	rowmeans := make([]float64, n)
+	grandmean := 0.0
+	for i := 0; i < n; i++ {
+		b[i] = make([]float64, n)
+		for j := 0; j < n; j++ {
+			d := 1.0
+			if i == j {
+				d = 0.0
+			} else if p, ok := prox[i][j]; ok {
+				d = 1.0 - p
+			}
+			b[i][j] = -0.5 * d * d
+			rowmeans[i] += b[i][j]
+		}
+		rowmeans[i] /= float64(n)
+		grandmean += rowmeans[i]
+	}
+	grandmean /= float64(n)
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			b[i][j] = b[i][j] - rowmeans[i] - rowmeans[j] + grandmean
+		}
+	}
+
+	coords = make([][]float64, n)
+	for i := range coords {
+		coords[i] = make([]float64, k)
+	}
+	vectors := make([][]float64, 0, k)
+	for d := 0; d < k && d < n; d++ {
+		v, lambda := powerIteration(b, vectors, 0.0)
+		if lambda < 0 {
+			//The largest magnitude eigenvalue left is negative so shift by it to find the
+			//largest positive one.
+			v, lambda = powerIteration(b, vectors, -lambda)
+		}
+		vectors = append(vectors, v)
+		eigenvalues = append(eigenvalues, lambda)
+		if lambda > 0 {
+			for i := range v {
+				coords[i][d] = v[i] * math.Sqrt(lambda)
+			}
+		}
+	}
+	return
+}
+
+//powerIteration returns the unit eigenvector and eigenvalue of the symmetric matrix m with the
+//largest magnitude after adding shift to the diagonal, ignoring the space spanned by the
+//orthonormal vectors found. The returned eigenvalue is of m without the shift.
+func powerIteration(m [][]float64, found [][]float64, shift float64) (v []float64, lambda float64) {
+	n := len(m)
+	v = make([]float64, n)
+	for i := range v {
+		v[i] = float64(i%7) + 1.0
+	}
+	next := make([]float64, n)
+	normalize := func() bool {
+		for _, u := range found {
+			dot := 0.0
+			for i := range v {
+				dot += v[i] * u[i]
+			}
+			for i := range v {
+				v[i] -= dot * u[i]
+			}
+		}
+		norm := 0.0
+		for _, x := range v {
+			norm += x * x
+		}
+		norm = math.Sqrt(norm)
+		if norm == 0 {
+			return false
+		}
+		for i := range v {
+			v[i] /= norm
+		}
+		return true
+	}
+
+	for iter := 0; iter < 1000 && normalize(); iter++ {
+		newlambda := 0.0
+		for i := 0; i < n; i++ {
+			next[i] = shift * v[i]
+			for j := 0; j < n; j++ {
+				next[i] += m[i][j] * v[j]
+			}
+			newlambda += v[i] * next[i]
+		}
+		v, next = next, v
+		converged := math.Abs(newlambda-lambda) <= 1e-12*math.Max(1.0, math.Abs(newlambda))
+		lambda = newlambda
+		if converged {
+			break
+		}
+	}
+	normalize()
+	lambda -= shift
+	return
+}
@@ -0,0 +1,114 @@
+package CloudForest
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestShardedCounter(t *testing.T) {
+	sparse := new(SparseCounter)
+	sharded := NewShardedCounter(3)
+	for i := 0; i < 10; i++ {
+		js := []int{i, (i + 1) % 10, (i * 7) % 10}
+		for _, j := range js {
+			sparse.Add(i, j, 2)
+		}
+		sharded.AddRow(i, js, 2)
+	}
+	for i := 0; i < 10; i++ {
+		row := sharded.Row(i)
+		if len(row) != len(sparse.Map[i]) {
+			t.Errorf("Row %v had %v entries not %v.", i, len(row), len(sparse.Map[i]))
+		}
+		for j, v := range sparse.Map[i] {
+			if row[j] != v {
+				t.Errorf("Count for %v,%v was %v not %v.", i, j, row[j], v)
+			}
+		}
+	}
+}
+
+func TestCountProximity(t *testing.T) {
+	fm := ParseAFM(strings.NewReader(".\t0\t1\t2\t3\nN:x\t0\t1\t2\t3\n"))
+	tree := new(Tree)
+	tree.AddNode("*", "", &Splitter{"N:x", true, 1.5, nil, nil, nil})
+	tree.AddNode("*L", "a", nil)
+	tree.AddNode("*R", "b", nil)
+
+	counts := NewShardedCounter(2)
+	tree.CountProximity(fm, []int{0, 1, 2, 3}, counts)
+	tree.CountProximity(fm, []int{0, 2, 3}, counts)
+
+	ct := NewCaseTrees(4)
+	ct.AddTree(0, []int{0, 1, 2, 3})
+	ct.AddTree(1, []int{0, 2, 3})
+	if ct.Shared(0, 1) != 1 || ct.Shared(2, 3) != 2 {
+		t.Errorf("Shared out of bag trees were %v and %v not 1 and 2.", ct.Shared(0, 1), ct.Shared(2, 3))
+	}
+
+	prox := NormalizeProximity(counts, 4, 2, nil)
+	if prox[0][1] != 0.5 || prox[2][3] != 1.0 || prox[0][2] != 0.0 {
+		t.Errorf("Proximities were %v, %v and %v not 0.5, 1 and 0.", prox[0][1], prox[2][3], prox[0][2])
+	}
+	prox = NormalizeProximity(counts, 4, 2, ct)
+	if prox[0][1] != 1.0 || prox[1][1] != 1.0 {
+		t.Errorf("Out of bag proximities were %v and %v not 1.", prox[0][1], prox[1][1])
+	}
+}
+
+func TestOutlierScores(t *testing.T) {
+	//Cases 0 to 3 are close to each other and case 4 is far from all of them.
+	n := 5
+	prox := make([]map[int]float64, n)
+	for i := 0; i < n; i++ {
+		prox[i] = map[int]float64{i: 1.0}
+		for j := 0; j < n; j++ {
+			if i != j {
+				prox[i][j] = 0.8
+				if i == 4 || j == 4 {
+					prox[i][j] = 0.1
+				}
+			}
+		}
+	}
+	scores := OutlierScores(prox, nil)
+	for i := 0; i < 4; i++ {
+		if scores[i] >= scores[4] {
+			t.Errorf("Case %v had outlier score %v not below the outlier's %v.", i, scores[i], scores[4])
+		}
+	}
+
+	//With a label of its own the far case has no proximity to its class.
+	scores = OutlierScores(prox, []string{"a", "a", "a", "a", "b"})
+	if !math.IsInf(scores[4], 1) && !math.IsNaN(scores[4]) {
+		t.Errorf("Case alone in its class had outlier score %v.", scores[4])
+	}
+}
+
+func TestClassicalMDS(t *testing.T) {
+	//Points on a line with proximity 1 - distance should be recovered up to sign and shift.
+	xs := []float64{0.0, 0.1, 0.25, 0.5, 0.9}
+	prox := make([]map[int]float64, len(xs))
+	for i := range xs {
+		prox[i] = make(map[int]float64)
+		for j := range xs {
+			prox[i][j] = 1.0 - math.Abs(xs[i]-xs[j])
+		}
+	}
+	coords, eigenvalues := ClassicalMDS(prox, 2)
+	if len(coords) != len(xs) || len(eigenvalues) != 2 {
+		t.Fatalf("MDS returned %v cases and %v eigenvalues.", len(coords), len(eigenvalues))
+	}
+	if math.Abs(eigenvalues[1]) > 1e-6 {
+		t.Errorf("Second eigenvalue of points on a line was %v not 0.", eigenvalues[1])
+	}
+	for i := range xs {
+		for j := range xs {
+			d := math.Abs(coords[i][0] - coords[j][0])
+			if math.Abs(d-math.Abs(xs[i]-xs[j])) > 1e-6 {
+				t.Errorf("MDS distance between %v and %v was %v not %v.", i, j, d, math.Abs(xs[i]-xs[j]))
+			}
+		}
+	}
+}
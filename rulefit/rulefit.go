@@ -0,0 +1,177 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/ryanbressler/CloudForest"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strings"
+)
+
+//rankedRules sorts rules by decreasing RuleFit importance or, if byImportance is false,
+//decreasing confidence and then support.
+type rankedRules struct {
+	rules        []*CloudForest.Rule
+	byImportance bool
+}
+
+func (r *rankedRules) Len() int {
+	return len(r.rules)
+}
+
+func (r *rankedRules) Less(i, j int) bool {
+	a, b := r.rules[i], r.rules[j]
+	if r.byImportance {
+		return a.Importance > b.Importance
+	}
+	if a.Confidence != b.Confidence {
+		return a.Confidence > b.Confidence
+	}
+	return a.Support > b.Support
+}
+
+func (r *rankedRules) Swap(i, j int) {
+	r.rules[i], r.rules[j] = r.rules[j], r.rules[i]
+}
+
+func main() {
+	fm := flag.String("fm",
+		"featurematrix.afm", "AFM formated feature matrix containing data.")
+	rf := flag.String("rfpred",
+		"", "A predictor forest to extract rules from. If empty shallow trees are grown.")
+	targetname := flag.String("target",
+		"", "The row header of the target in the feature matrix.")
+	outfn := flag.String("out",
+		"", "File to write a tsv of all rules to.")
+	positive := flag.String("positive",
+		"", "The class treated as 1 by -rulefit with a categorical target.")
+
+	var nTrees int
+	flag.IntVar(&nTrees, "nTrees", 100, "Number of trees to grow if -rfpred isn't specified.")
+	var maxDepth int
+	flag.IntVar(&maxDepth, "maxDepth", 3, "Maximum depth of trees grown if -rfpred isn't specified.")
+	var mTry int
+	flag.IntVar(&mTry, "mTry", 0, "Number of candidate features for each split of grown trees. Default: sqrt(N).")
+	var minSupport float64
+	flag.Float64Var(&minSupport, "minsupport", 0.01, "Minimum support of rules to report.")
+	var rulefit bool
+	flag.BoolVar(&rulefit, "rulefit", false, "Fit a sparse (lasso) linear model over the rules.")
+	var lambda float64
+	flag.Float64Var(&lambda, "lambda", 0.05, "RuleFit penalty as a fraction of the smallest penalty giving no rules.")
+	var top int
+	flag.IntVar(&top, "top", 20, "Number of rules to print.")
+
+	flag.Parse()
+
+	//Parse Data
+	data, err := CloudForest.LoadAFM(*fm)
+	if err != nil {
+		log.Fatal(err)
+	}
+	targeti, ok := data.Map[*targetname]
+	if !ok {
+		log.Fatal("Target not found in data.")
+	}
+	target := data.Data[targeti]
+	nCases := target.Length()
+	cases := make([]int, 0, nCases)
+	for i := 0; i < nCases; i++ {
+		cases = append(cases, i)
+	}
+
+	rules := make([]*CloudForest.Rule, 0)
+	if *rf != "" {
+		forestfile, err := os.Open(*rf) // For read access.
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer forestfile.Close()
+		forest, err := CloudForest.NewForestReader(forestfile).ReadForest()
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, tree := range forest.Trees {
+			rules = append(rules, tree.Rules(data, target, cases, nil)...)
+		}
+	} else {
+		candidates := make([]int, 0, len(data.Data))
+		for i := range data.Data {
+			if i != targeti {
+				candidates = append(candidates, i)
+			}
+		}
+		if mTry == 0 {
+			mTry = int(math.Ceil(math.Sqrt(float64(len(candidates)))))
+		}
+		allocs := CloudForest.NewBestSplitAllocs(nCases, target)
+		inbag := make([]bool, nCases)
+		for i := 0; i < nTrees; i++ {
+			treecases := CloudForest.SampleWithReplacment(nCases, nCases)
+			for j := range inbag {
+				inbag[j] = false
+			}
+			for _, c := range treecases {
+				inbag[c] = true
+			}
+			oob := make([]int, 0, nCases)
+			for c, in := range inbag {
+				if !in {
+					oob = append(oob, c)
+				}
+			}
+			tree := CloudForest.NewTree()
+			tree.Grow(data, target, treecases, candidates, nil, mTry, 1, maxDepth, false, false, false, false, false, 0, nil, nil, allocs)
+			rules = append(rules, tree.Rules(data, target, treecases, oob)...)
+		}
+	}
+
+	supported := make([]*CloudForest.Rule, 0, len(rules))
+	for _, r := range rules {
+		if r.Support >= minSupport {
+			supported = append(supported, r)
+		}
+	}
+	rules = CloudForest.UniqueRules(supported)
+	fmt.Printf("Extracted %v unique rules with support of at least %v.\n", len(rules), minSupport)
+
+	if rulefit {
+		if target.NCats() > 0 && *positive == "" {
+			log.Fatal("-rulefit with a categorical target requires -positive.")
+		}
+		intercept := CloudForest.FitRuleFit(data, target, *positive, rules, cases, lambda)
+		nonzero := 0
+		for _, r := range rules {
+			if r.Coefficient != 0.0 {
+				nonzero++
+			}
+		}
+		fmt.Printf("RuleFit intercept %v with %v rules.\n", intercept, nonzero)
+	}
+	sort.Stable(&rankedRules{rules, rulefit})
+
+	for i, r := range rules {
+		if i >= top || (rulefit && r.Coefficient == 0.0) {
+			break
+		}
+		fmt.Printf("%v\n  predict %v (support %v, confidence %v", r, r.Pred, r.Support, r.Confidence)
+		if rulefit {
+			fmt.Printf(", coefficient %v, importance %v", r.Coefficient, r.Importance)
+		}
+		fmt.Print(")\n")
+	}
+
+	if *outfn != "" {
+		outfile, err := os.Create(*outfn)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer outfile.Close()
+		fmt.Fprintln(outfile, strings.Join([]string{"Rule", "Prediction", "Support", "Confidence", "Coefficient", "Importance"}, "\t"))
+		for _, r := range rules {
+			fmt.Fprintf(outfile, "%v\t%v\t%v\t%v\t%v\t%v\n", r, r.Pred, r.Support, r.Confidence, r.Coefficient, r.Importance)
+		}
+	}
+}
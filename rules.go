@@ -0,0 +1,281 @@
+package CloudForest
+
+import (
+	"math"
+	"strings"
+)
+
+//RuleCondition is a single condition of a Rule. Cases meet it if Splitter sends them left
+//(Left is true) or right (Left is false). Cases missing the feature never meet it.
+type RuleCondition struct {
+	Splitter *Splitter
+	Left     bool
+}
+
+/*
+Rule is a conjunction of the conditions on the path from the root of a tree to one of its
+nodes. Pred is the prediction (mode or mean of the target) for the cases meeting the rule,
+Support is the fraction of the cases used to extract it that meet it and Confidence is
+measured on out of bag cases (see Tree.Rules).
+
+Coefficient and Importance are set by FitRuleFit.
+*/
+type Rule struct {
+	Conditions  []RuleCondition
+	Pred        string
+	Support     float64
+	Confidence  float64
+	Coefficient float64
+	Importance  float64
+}
+
+//String returns the conditions of the rule joined by AND.
+func (r *Rule) String() string {
+	conds := make([]string, 0, len(r.Conditions))
+	for _, c := range r.Conditions {
+		conds = append(conds, c.Splitter.Describe(c.Left))
+	}
+	return strings.Join(conds, " AND ")
+}
+
+//Applies returns true if case c in fm meets all of the rule's conditions.
+func (r *Rule) Applies(fm *FeatureMatrix, c int) bool {
+	for _, cond := range r.Conditions {
+		if left, ok := cond.Splitter.GoesLeft(fm, c); !ok || left != cond.Left {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+Rules extracts a Rule for every node of the tree except the root from the conditions on the path
+to it. Rules for Missing branches aren't extracted.
+
+The Pred and Support of each rule are found from cases, normally the cases the tree was grown on.
+Confidence is found from the oob cases (or cases if oob is nil) that meet the rule. For
+classification it is the fraction of them whose target is Pred. For regression it is one minus
+the mean squared error of predicting them with Pred divided by the variance of target over
+all of the oob cases. Cases missing the target are ignored.
+*/
+func (t *Tree) Rules(fm *FeatureMatrix, target Feature, cases []int, oob []int) (rules []*Rule) {
+	incases := make([]int, 0, len(cases))
+	for _, c := range cases {
+		if !target.IsMissing(c) {
+			incases = append(incases, c)
+		}
+	}
+	if oob == nil {
+		oob = incases
+	}
+	oobcases := make([]int, 0, len(oob))
+	for _, c := range oob {
+		if !target.IsMissing(c) {
+			oobcases = append(oobcases, c)
+		}
+	}
+	if len(incases) == 0 {
+		return
+	}
+	total := float64(len(incases))
+
+	variance := 0.0
+	if target.NCats() == 0 && len(oobcases) > 0 {
+		nf := target.(NumFeature)
+		mean := nf.Mean(&oobcases)
+		for _, c := range oobcases {
+			variance += (nf.Get(c) - mean) * (nf.Get(c) - mean)
+		}
+		variance /= float64(len(oobcases))
+	}
+
+	var walk func(n *Node, conditions []RuleCondition, incases []int, oobcases []int)
+	walk = func(n *Node, conditions []RuleCondition, incases []int, oobcases []int) {
+		if len(conditions) > 0 && len(incases) > 0 {
+			r := &Rule{Conditions: conditions, Support: float64(len(incases)) / total}
+			r.Pred = target.FindPredicted(incases)
+			if len(oobcases) > 0 {
+				switch target.NCats() {
+				case 0:
+					pred := ParseFloat(r.Pred)
+					mse := 0.0
+					for _, c := range oobcases {
+						d := target.(NumFeature).Get(c) - pred
+						mse += d * d
+					}
+					mse /= float64(len(oobcases))
+					if variance > 0 {
+						r.Confidence = 1.0 - mse/variance
+					}
+				default:
+					for _, c := range oobcases {
+						if target.GetStr(c) == r.Pred {
+							r.Confidence++
+						}
+					}
+					r.Confidence /= float64(len(oobcases))
+				}
+			}
+			rules = append(rules, r)
+		}
+		if n.Splitter == nil {
+			return
+		}
+
+		l, r, _ := n.Splitter.Split(fm, append([]int(nil), incases...))
+		ol, or, _ := n.Splitter.Split(fm, append([]int(nil), oobcases...))
+		for _, left := range []bool{true, false} {
+			child, cs, ocs := n.Left, l, ol
+			if !left {
+				child, cs, ocs = n.Right, r, or
+			}
+			if child == nil {
+				continue
+			}
+			childconds := make([]RuleCondition, len(conditions), len(conditions)+1)
+			copy(childconds, conditions)
+			childconds = append(childconds, RuleCondition{n.Splitter, left})
+			walk(child, childconds, cs, ocs)
+		}
+	}
+	walk(t.Root, nil, incases, oobcases)
+	return
+}
+
+//UniqueRules returns the rules with repeated rules (those with the same String()) removed
+//keeping the first occurrence.
+func UniqueRules(rules []*Rule) (unique []*Rule) {
+	seen := make(map[string]bool)
+	for _, r := range rules {
+		s := r.String()
+		if !seen[s] {
+			seen[s] = true
+			unique = append(unique, r)
+		}
+	}
+	return
+}
+
+/*
+FitRuleFit fits the RuleFit model of Friedman and Popescu ("Predictive Learning via Rule
+Ensembles"), a sparse linear model over indicators of whether each case meets each rule,
+setting the Coefficient and Importance (the absolute coefficient times the standard deviation
+of the indicator) of each rule and returning the intercept.
+
+The model is fit to the numerical target, or for categorical targets to the indicator of
+target being the positive class, over the specified cases (those missing the target are
+ignored) by minimizing squared error with an L1 (lasso) penalty using coordinate descent.
+lambda is the penalty as a fraction of the smallest penalty for which all coefficients are zero
+so values closer to 1 give sparser models.
+*/
+func FitRuleFit(fm *FeatureMatrix, target Feature, positive string, rules []*Rule, cases []int, lambda float64) (intercept float64) {
+	y := make([]float64, 0, len(cases))
+	obs := make([]int, 0, len(cases))
+	for _, c := range cases {
+		if target.IsMissing(c) {
+			continue
+		}
+		obs = append(obs, c)
+		switch target.NCats() {
+		case 0:
+			y = append(y, target.(NumFeature).Get(c))
+		default:
+			v := 0.0
+			if target.GetStr(c) == positive {
+				v = 1.0
+			}
+			y = append(y, v)
+		}
+	}
+	n := float64(len(obs))
+	if n == 0 {
+		return
+	}
+
+	//Standardized rule indicators.
+	x := make([][]float64, len(rules))
+	means := make([]float64, len(rules))
+	sds := make([]float64, len(rules))
+	for j, r := range rules {
+		x[j] = make([]float64, len(obs))
+		for i, c := range obs {
+			if r.Applies(fm, c) {
+				x[j][i] = 1.0
+				means[j]++
+			}
+		}
+		means[j] /= n
+		sds[j] = math.Sqrt(means[j] * (1 - means[j]))
+		for i := range x[j] {
+			if sds[j] > 0 {
+				x[j][i] = (x[j][i] - means[j]) / sds[j]
+			} else {
+				x[j][i] = 0.0
+			}
+		}
+	}
+
+	ymean := 0.0
+	for _, v := range y {
+		ymean += v
+	}
+	ymean /= n
+	residual := make([]float64, len(y))
+	for i, v := range y {
+		residual[i] = v - ymean
+	}
+
+	lambdaMax := 0.0
+	for j := range rules {
+		dot := 0.0
+		for i, v := range x[j] {
+			dot += v * residual[i]
+		}
+		lambdaMax = math.Max(lambdaMax, math.Abs(dot/n))
+	}
+	penalty := lambda * lambdaMax
+
+	beta := make([]float64, len(rules))
+	for iter := 0; iter < 1000; iter++ {
+		maxChange := 0.0
+		for j := range rules {
+			if sds[j] == 0 {
+				continue
+			}
+			//The standardized columns have variance 1.
+			rho := 0.0
+			for i, v := range x[j] {
+				rho += v * residual[i]
+			}
+			rho = rho/n + beta[j]
+			newbeta := 0.0
+			switch {
+			case rho > penalty:
+				newbeta = rho - penalty
+			case rho < -penalty:
+				newbeta = rho + penalty
+			}
+			if delta := newbeta - beta[j]; delta != 0 {
+				for i, v := range x[j] {
+					residual[i] -= delta * v
+				}
+				beta[j] = newbeta
+				maxChange = math.Max(maxChange, math.Abs(delta))
+			}
+		}
+		if maxChange < 1e-7 {
+			break
+		}
+	}
+
+	intercept = ymean
+	for j, r := range rules {
+		r.Coefficient = 0.0
+		r.Importance = math.Abs(beta[j])
+		if sds[j] > 0 {
+			r.Coefficient = beta[j] / sds[j]
+			intercept -= r.Coefficient * means[j]
+		}
+	}
+	return
+}
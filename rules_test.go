@@ -0,0 +1,95 @@
+package CloudForest
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestRules(t *testing.T) {
+	ncases := 200
+	rnd := rand.New(rand.NewSource(1))
+	fm := syntheticAFM(rnd, ncases, []string{"N:y", "N:x1", "C:x2"}, func(i int, rnd *rand.Rand) []interface{} {
+		x1 := rnd.Float64()
+		x2 := "a"
+		if rnd.Intn(2) == 0 {
+			x2 = "b"
+		}
+		y := 0.0
+		if x1 > 0.5 && x2 == "a" {
+			y = 3.0
+		}
+		return []interface{}{y, x1, x2}
+	})
+	target := fm.Data[0]
+	cases := make([]int, 0, ncases)
+	for i := 0; i < ncases; i++ {
+		cases = append(cases, i)
+	}
+
+	tree := NewTree()
+	allocs := NewBestSplitAllocs(ncases, target)
+	tree.Grow(fm, target, cases, []int{1, 2}, nil, 2, 1, 2, false, false, false, false, false, 0, nil, nil, allocs)
+
+	rules := tree.Rules(fm, target, cases, nil)
+	nodes := 0
+	tree.Root.Climb(func(n *Node) {
+		nodes++
+	})
+	if len(rules) != nodes-1 {
+		t.Errorf("Extracted %v rules from tree with %v nodes.", len(rules), nodes)
+	}
+	rootSupport := 0.0
+	for _, r := range rules {
+		if len(r.Conditions) == 1 {
+			rootSupport += r.Support
+		}
+	}
+	if math.Abs(rootSupport-1.0) > 1e-9 {
+		t.Errorf("Supports of the root's children sum to %v not 1.", rootSupport)
+	}
+
+	found := false
+	for _, r := range rules {
+		n := 0
+		for c := 0; c < ncases; c++ {
+			if r.Applies(fm, c) {
+				n++
+			}
+		}
+		if math.Abs(float64(n)/float64(ncases)-r.Support) > 1e-9 {
+			t.Errorf("Rule %v applies to %v cases but has support %v.", r, n, r.Support)
+		}
+		if len(r.Conditions) == 2 && r.Pred == "3" {
+			found = true
+			if r.Confidence != 1.0 {
+				t.Errorf("Rule %v predicting 3 had confidence %v not 1.", r, r.Confidence)
+			}
+		}
+	}
+	if !found {
+		t.Error("Rule for the interaction of x1 and x2 not found.")
+	}
+
+	if len(UniqueRules(append(rules, rules...))) != len(rules) {
+		t.Error("UniqueRules didn't remove repeated rules.")
+	}
+
+	FitRuleFit(fm, target, "", rules, cases, 0.01)
+	var best *Rule
+	for _, r := range rules {
+		if best == nil || r.Importance > best.Importance {
+			best = r
+		}
+	}
+	if best.Pred != "3" || best.Coefficient < 2.0 {
+		t.Errorf("Most important RuleFit rule was %v predicting %v with coefficient %v.", best, best.Pred, best.Coefficient)
+	}
+
+	FitRuleFit(fm, target, "", rules, cases, 1.0)
+	for _, r := range rules {
+		if r.Coefficient != 0.0 {
+			t.Errorf("Rule %v had coefficient %v with maximum penalty.", r, r.Coefficient)
+		}
+	}
+}
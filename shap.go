@@ -0,0 +1,271 @@
+package CloudForest
+
+//shapPathElement is an element of the path of unique features followed in the exact TreeSHAP
+//algorithm of Lundberg et al. ("Consistent Individualized Feature Attribution for Tree
+//Ensembles").
+type shapPathElement struct {
+	feature int
+	zero    float64 //fraction of cover flowing down the path when the feature is unknown
+	one     float64 //1 if the case flows down the path when the feature is known
+	weight  float64
+}
+
+/*
+SHAP adds the TreeSHAP attributions of the tree's prediction for case c in fm to phi, which
+should be indexed like fm.Data, and returns the expected value of the tree's prediction over the
+covers of its nodes. The expected value plus the attributions equals the value of the leaf the
+case reaches. They are exact for axis aligned splits. An oblique split is treated as a split on
+the feature with its largest standardized weight (the first of its UsedFeatures) which gets its
+whole contribution, so attributions for trees with oblique splits are an approximation and its
+other features get nothing from it.
+
+value gives the numerical value of a leaf, for example its prediction parsed as a float for
+regression or 1.0 if it predicts a class of interest and 0.0 otherwise for classification.
+
+Node covers (see Node.Cover) must be set by Tree.Grow or Tree.SetCovers. Children are weighted
+by their share of the cover of all of a node's children. A case missing a splitting feature
+follows the Missing branch or its surrogates (with the attribution going to the splitting feature).
+If it doesn't reach a leaf phi is unchanged and ok is false.
+*/
+func (t *Tree) SHAP(fm *FeatureMatrix, c int, value func(*Node) float64, phi []float64) (expected float64, ok bool) {
+	//check that the case reaches a leaf
+	for n := t.Root; n.Splitter != nil; {
+		n = n.hotChild(fm, c)
+		if n == nil {
+			return
+		}
+	}
+	ok = true
+	expected = t.Root.expectedValue(value)
+	t.Root.shap(fm, c, value, phi, make([]shapPathElement, 0, 16), 1.0, 1.0, -1)
+	return
+}
+
+//children returns the non nil children of a node.
+func (n *Node) children() (cs []*Node) {
+	for _, child := range []*Node{n.Left, n.Right, n.Missing} {
+		if child != nil {
+			cs = append(cs, child)
+		}
+	}
+	return
+}
+
+//hotChild returns the child that the case goes to or nil if it doesn't go to one.
+func (n *Node) hotChild(fm *FeatureMatrix, c int) *Node {
+	if n.Splitter == nil {
+		return nil
+	}
+	left, ok := n.Splitter.GoesLeft(fm, c)
+	switch {
+	case ok && left:
+		return n.Left
+	case ok:
+		return n.Right
+	case n.Missing != nil:
+		return n.Missing
+	case n.Surrogates != nil:
+		if n.RouteMissing(fm, []int{c}) == 1 {
+			return n.Left
+		}
+		return n.Right
+	}
+	return nil
+}
+
+//childCover returns the total cover of the children of a node.
+func (n *Node) childCover() (cover float64) {
+	for _, child := range n.children() {
+		cover += child.Cover
+	}
+	return
+}
+
+//expectedValue returns the cover weighted mean value of the leaves below the node.
+func (n *Node) expectedValue(value func(*Node) float64) (e float64) {
+	if n.Splitter == nil {
+		return value(n)
+	}
+	cover := n.childCover()
+	if cover == 0 {
+		return
+	}
+	for _, child := range n.children() {
+		if child.Cover > 0 {
+			e += child.Cover / cover * child.expectedValue(value)
+		}
+	}
+	return
+}
+
+func (n *Node) shap(fm *FeatureMatrix,
+	c int,
+	value func(*Node) float64,
+	phi []float64,
+	parentPath []shapPathElement,
+	parentZero float64,
+	parentOne float64,
+	parentFeature int) {
+
+	path := make([]shapPathElement, len(parentPath), len(parentPath)+1)
+	copy(path, parentPath)
+	path = extendSHAPPath(path, parentZero, parentOne, parentFeature)
+
+	if n.Splitter == nil {
+		v := value(n)
+		for i := 1; i < len(path); i++ {
+			w := unwoundSHAPPathSum(path, i)
+			phi[path[i].feature] += w * (path[i].one - path[i].zero) * v
+		}
+		return
+	}
+
+	cover := n.childCover()
+	if cover == 0 {
+		return
+	}
+	//Oblique splits are attributed to their first (largest weight) feature (see Tree.SHAP).
+	fi := fm.Map[n.Splitter.UsedFeatures()[0]]
+	hot := n.hotChild(fm, c)
+
+	//If the feature was already split on undo that split so it only appears once.
+	incomingZero, incomingOne := 1.0, 1.0
+	for i := 1; i < len(path); i++ {
+		if path[i].feature == fi {
+			incomingZero = path[i].zero
+			incomingOne = path[i].one
+			path = unwindSHAPPath(path, i)
+			break
+		}
+	}
+
+	for _, child := range n.children() {
+		zero := child.Cover / cover * incomingZero
+		one := 0.0
+		if child == hot {
+			one = incomingOne
+		}
+		//paths no case can follow don't contribute
+		if zero == 0 && one == 0 {
+			continue
+		}
+		child.shap(fm, c, value, phi, path, zero, one, fi)
+	}
+}
+
+//extendSHAPPath adds a feature to the path updating the weights of the permutations.
+func extendSHAPPath(path []shapPathElement, zero float64, one float64, feature int) []shapPathElement {
+	depth := len(path)
+	w := 0.0
+	if depth == 0 {
+		w = 1.0
+	}
+	path = append(path, shapPathElement{feature, zero, one, w})
+	for i := depth - 1; i >= 0; i-- {
+		path[i+1].weight += one * path[i].weight * float64(i+1) / float64(depth+1)
+		path[i].weight = zero * path[i].weight * float64(depth-i) / float64(depth+1)
+	}
+	return path
+}
+
+//unwindSHAPPath removes element i from the path, undoing extendSHAPPath.
+func unwindSHAPPath(path []shapPathElement, i int) []shapPathElement {
+	depth := len(path) - 1
+	one := path[i].one
+	zero := path[i].zero
+	next := path[depth].weight
+	for j := depth - 1; j >= 0; j-- {
+		if one != 0 {
+			tmp := path[j].weight
+			path[j].weight = next * float64(depth+1) / (float64(j+1) * one)
+			next = tmp - path[j].weight*zero*float64(depth-j)/float64(depth+1)
+		} else {
+			path[j].weight = path[j].weight * float64(depth+1) / (zero * float64(depth-j))
+		}
+	}
+	for j := i; j < depth; j++ {
+		path[j].feature = path[j+1].feature
+		path[j].zero = path[j+1].zero
+		path[j].one = path[j+1].one
+	}
+	return path[:depth]
+}
+
+//unwoundSHAPPathSum returns the total weight of the path with element i removed.
+func unwoundSHAPPathSum(path []shapPathElement, i int) (total float64) {
+	depth := len(path) - 1
+	one := path[i].one
+	zero := path[i].zero
+	next := path[depth].weight
+	for j := depth - 1; j >= 0; j-- {
+		if one != 0 {
+			tmp := next * float64(depth+1) / (float64(j+1) * one)
+			total += tmp
+			next = path[j].weight - tmp*zero*float64(depth-j)/float64(depth+1)
+		} else if zero != 0 {
+			total += path[j].weight / zero / (float64(depth-j) / float64(depth+1))
+		}
+	}
+	return
+}
+
+/*
+SHAP returns the TreeSHAP attributions (indexed like fm.Data) of the forest's prediction for
+case c in fm along with the expected value they are relative to. The expected value plus the sum
+of the attributions equals the prediction. As in Tree.SHAP they are approximate for oblique splits.
+
+If class is not "" the prediction is the weighted fraction of trees voting for that class as in
+random forest classification. Otherwise the prediction is the weighted mean of the trees'
+numerical predictions plus the forest's Intercept as in random forest regression or, if sum
+is true, the Intercept plus the weighted sum of the trees' predictions as in gradient boosting
+(for which attributions are on the untransformed scale, ie log odds for classification).
+Trees whose weight is unset count with weight 1.0. Trees that the case doesn't reach a leaf
+in don't vote and are left out of the prediction and expected value.
+*/
+func (f *Forest) SHAP(fm *FeatureMatrix, c int, class string, sum bool) (phi []float64, expected float64) {
+	phi = make([]float64, len(fm.Data))
+	treephi := make([]float64, len(fm.Data))
+
+	value := func(n *Node) float64 {
+		return ParseFloat(n.Pred)
+	}
+	if class != "" {
+		value = func(n *Node) float64 {
+			if n.Pred == class {
+				return 1.0
+			}
+			return 0.0
+		}
+	}
+
+	totalWeight := 0.0
+	for _, t := range f.Trees {
+		for i := range treephi {
+			treephi[i] = 0.0
+		}
+		e, ok := t.SHAP(fm, c, value, treephi)
+		if !ok {
+			continue
+		}
+		weight := 1.0
+		if t.Weight >= 0.0 {
+			weight = t.Weight
+		}
+		totalWeight += weight
+		expected += weight * e
+		for i, v := range treephi {
+			phi[i] += weight * v
+		}
+	}
+
+	if !sum && totalWeight > 0 {
+		expected /= totalWeight
+		for i := range phi {
+			phi[i] /= totalWeight
+		}
+	}
+	if class == "" {
+		expected += f.Intercept
+	}
+	return
+}
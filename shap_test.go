@@ -0,0 +1,144 @@
+package CloudForest
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+//bruteForceSHAP computes Shapley values of a tree's prediction by enumerating all subsets of
+//features using the same cover weighted conditional expectation as TreeSHAP.
+func bruteForceSHAP(t *Tree, fm *FeatureMatrix, c int, features []int) (phi map[int]float64) {
+	var condExp func(n *Node, known map[int]bool) float64
+	condExp = func(n *Node, known map[int]bool) float64 {
+		if n.Splitter == nil {
+			return ParseFloat(n.Pred)
+		}
+		if known[fm.Map[n.Splitter.Feature]] {
+			return condExp(n.hotChild(fm, c), known)
+		}
+		cover := n.childCover()
+		e := 0.0
+		for _, child := range n.children() {
+			if child.Cover > 0 {
+				e += child.Cover / cover * condExp(child, known)
+			}
+		}
+		return e
+	}
+
+	m := len(features)
+	fact := func(k int) float64 {
+		return math.Gamma(float64(k + 1))
+	}
+	phi = make(map[int]float64)
+	for _, fi := range features {
+		for subset := 0; subset < 1<<uint(m); subset++ {
+			known := make(map[int]bool)
+			size := 0
+			in := false
+			for k, fk := range features {
+				if subset&(1<<uint(k)) != 0 {
+					if fk == fi {
+						in = true
+					}
+					known[fk] = true
+					size++
+				}
+			}
+			if in {
+				continue
+			}
+			without := condExp(t.Root, known)
+			known[fi] = true
+			with := condExp(t.Root, known)
+			phi[fi] += fact(size) * fact(m-size-1) / fact(m) * (with - without)
+		}
+	}
+	return
+}
+
+func TestSHAP(t *testing.T) {
+	ncases := 100
+	rnd := rand.New(rand.NewSource(1))
+	fm := syntheticAFM(rnd, ncases, []string{"N:y", "N:x1", "N:x2", "N:x3", "C:x4"}, func(i int, rnd *rand.Rand) []interface{} {
+		x1 := rnd.Float64()
+		x2 := rnd.Float64()
+		x4 := "a"
+		if rnd.Intn(2) == 0 {
+			x4 = "b"
+		}
+		y := x1 + 2*x1*x2
+		if x4 == "a" {
+			y += 1.0
+		}
+		return []interface{}{y, x1, x2, rnd.Float64(), x4}
+	})
+	target := fm.Data[0]
+	candidates := []int{1, 2, 3, 4}
+
+	forest := &Forest{Target: "N:y"}
+	allocs := NewBestSplitAllocs(ncases, target)
+	for i := 0; i < 5; i++ {
+		cases := make([]int, 0, ncases)
+		for len(cases) < ncases {
+			cases = append(cases, rnd.Intn(ncases))
+		}
+		tree := NewTree()
+		tree.Grow(fm, target, cases, candidates, nil, 2, 8, 0, false, false, false, false, false, 0, nil, nil, allocs)
+		forest.Trees = append(forest.Trees, tree)
+	}
+
+	value := func(n *Node) float64 {
+		return ParseFloat(n.Pred)
+	}
+	for _, c := range []int{0, 1, 2, 3, 4} {
+		phi := make([]float64, len(fm.Data))
+		expected, ok := forest.Trees[0].SHAP(fm, c, value, phi)
+		if !ok {
+			t.Fatalf("Case %v didn't reach a leaf.", c)
+		}
+		brute := bruteForceSHAP(forest.Trees[0], fm, c, candidates)
+		for _, fi := range candidates {
+			if math.Abs(phi[fi]-brute[fi]) > 1e-9 {
+				t.Errorf("TreeSHAP value %v for feature %v of case %v not equal to brute force value %v.", phi[fi], fi, c, brute[fi])
+			}
+		}
+
+		//local accuracy
+		bb := NewNumBallotBox(ncases)
+		forest.Trees[0].VoteCases(fm, bb, []int{c})
+		total := expected
+		for _, v := range phi {
+			total += v
+		}
+		if pred := bb.TallyNum(c); math.Abs(total-pred) > 1e-9 {
+			t.Errorf("Expected value plus SHAP values %v not equal to tree prediction %v.", total, pred)
+		}
+	}
+
+	//forest attributions sum to the prediction
+	forest.Intercept = 1.5
+	bb := NewNumBallotBox(ncases)
+	sbb := NewSumBallotBox(ncases)
+	for _, tree := range forest.Trees {
+		tree.Vote(fm, bb)
+		tree.Vote(fm, sbb)
+	}
+	for c := 0; c < ncases; c++ {
+		for _, sum := range []bool{false, true} {
+			phi, expected := forest.SHAP(fm, c, "", sum)
+			total := expected
+			for _, v := range phi {
+				total += v
+			}
+			pred := bb.TallyNum(c) + forest.Intercept
+			if sum {
+				pred = sbb.TallyNum(c) + forest.Intercept
+			}
+			if math.Abs(total-pred) > 1e-9 {
+				t.Errorf("Forest SHAP values for case %v sum to %v not prediction %v.", c, total, pred)
+			}
+		}
+	}
+}
@@ -1,6 +1,10 @@
 package CloudForest
 
-import ()
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
 
 // ScikitNode
 // cdef struct Node:
@@ -13,15 +17,17 @@ import ()
 //     DOUBLE_t impurity                    # Impurity of the node (i.e., the value of the criterion)
 //     SIZE_t n_node_samples                # Number of samples at the node
 //     DOUBLE_t weighted_n_node_samples     # Weighted number of samples at the node
+//     unsigned char missing_go_to_left     # Whether features have missing values
 
 type ScikitNode struct {
 	LeftChild            int     `json:"left_child"`
 	RightChild           int     `json:"right_child"`
 	Feature              int     `json:"feature"`
 	Threshold            float64 `json:"threshold"`
-	Impurity             float64 `json:"impurity"`                //TODO(ryan): support this?
-	NNodeSamples         int     `json:"n_node_samples"`          //TODO(ryan): support this?
-	WeightedNNodeSamples float64 `json:"weighted_n_node_samples"` //TODO(ryan): support this?
+	Impurity             float64 `json:"impurity"`
+	NNodeSamples         int     `json:"n_node_samples"`
+	WeightedNNodeSamples float64 `json:"weighted_n_node_samples"`
+	MissingGoToLeft      uint8   `json:"missing_go_to_left"`
 }
 
 // AnnotatedTree represents a decision tree in the memory format used by scikit learn.
@@ -47,34 +53,46 @@ type ScikitNode struct {
 type ScikitTree struct {
 	NFeatures   int           `json:"n_features"`
 	NClasses    []int         `json:"n_classes"`
-	NOutputs    int           `json:"n_outputs"`     //TODO(ryan): support other values
-	MaxNClasses int           `json:"max_n_classes"` //TODO(ryan): support other values
+	NOutputs    int           `json:"n_outputs"`
+	MaxNClasses int           `json:"max_n_classes"`
 	MaxDepth    int           `json:"max_depth"`
 	NodeCount   int           `json:"node_count"`
 	Capacity    int           `json:"capacity"`
 	Nodes       []ScikitNode  `json:"nodes"`
-	Value       [][][]float64 `json:"value"` //TODO(ryan): support actual values
+	Value       [][][]float64 `json:"value"`
 	ValueStride int           `json:"value_stride"`
 }
 
+//NewScikitTree returns an empty two class ScikitTree with nFeatures columns.
 func NewScikitTree(nFeatures int) *ScikitTree {
+	return newScikitTree(nFeatures, 2)
+}
+
+//newScikitTree returns an empty single output ScikitTree with nFeatures columns and nClasses
+//classes (1 for regression).
+func newScikitTree(nFeatures int, nClasses int) *ScikitTree {
 	tree := &ScikitTree{
 		NFeatures:   nFeatures,
-		NClasses:    []int{2},
+		NClasses:    []int{nClasses},
 		NOutputs:    1,
-		MaxNClasses: 2,
+		MaxNClasses: nClasses,
 		MaxDepth:    0,
 		NodeCount:   0,
 		Capacity:    0,
 		Nodes:       make([]ScikitNode, 0),
 		Value:       make([][][]float64, 0),
-		ValueStride: 0}
+		ValueStride: nClasses}
 
 	return tree
 }
 
-// BuildScikkitTree currentelly only builds the split threshold and node structure of a sickit tree from a
-// Cloudforest tree specified by root node
+/*
+BuildScikitTree builds only the split thresholds and node structure of a scikit tree from the
+CloudForest tree rooted at n with features indexed by Featurei.
+
+Deprecated: use BuildScikitForest or ScikitForest.AddTree which also fill in values, sample
+counts and impurities and one hot encode categorical splits.
+*/
 func BuildScikitTree(depth int, n *Node, sktree *ScikitTree) {
 	if depth > sktree.MaxDepth {
 		sktree.MaxDepth = depth
@@ -82,11 +100,8 @@ func BuildScikitTree(depth int, n *Node, sktree *ScikitTree) {
 	depth++
 	sktree.NodeCount++
 	sktree.Capacity++
-	skn := ScikitNode{}
 	pos := len(sktree.Nodes)
-	// We can't use a pointer here because the array will move and we're building this as an array
-	// of structs for sklearn memory compatibility later so we use a pos.
-	sktree.Nodes = append(sktree.Nodes, skn)
+	sktree.Nodes = append(sktree.Nodes, ScikitNode{-1, -1, 0, 0.0, 0.0, 0, 0.0, 0})
 	if n.Splitter != nil {
 		sktree.Nodes[pos].Feature = n.Featurei
 		sktree.Nodes[pos].Threshold = n.Splitter.Value
@@ -94,10 +109,341 @@ func BuildScikitTree(depth int, n *Node, sktree *ScikitTree) {
 		BuildScikitTree(depth, n.Left, sktree)
 		sktree.Nodes[pos].RightChild = sktree.NodeCount
 		BuildScikitTree(depth, n.Right, sktree)
+	}
+}
+
+/*
+ScikitForest holds the trees of a forest converted to the arrays scikit-learn uses for its trees
+with the layout of the numerical matrix X they apply to. Numerical features are a column each
+and categorical features are one hot encoded as a column per category named "feature=category"
+(1 if the case has the category and 0 otherwise, including when it is missing). Categorical splits
+are expanded into chains of splits on these columns which duplicates the subtree on the side of
+the split that missing cases don't follow for each of its categories after the first.
+
+Cases missing a splitting feature follow MissingLeft as scikit-learn can't use surrogates.
+
+Classes are the categories of a categorical target in the order of the class distributions in
+Value. Weights are the CloudForest tree weights (-1 if unweighted) and Intercept is the forest's
+intercept which are needed to combine trees from boosting.
+*/
+type ScikitForest struct {
+	FeatureNames []string      `json:"feature_names"`
+	Classes      []string      `json:"classes,omitempty"`
+	Intercept    float64       `json:"intercept"`
+	Weights      []float64     `json:"weights"`
+	Estimators   []*ScikitTree `json:"estimators"`
+
+	columns    map[string]int
+	catcolumns map[string]map[string]int
+	target     Feature
+}
+
+/*
+NewScikitForest returns an empty ScikitForest with a column for each feature of fm other than the
+named target. If target is a categorical feature trees are exported as classifiers with the class
+distribution of the cases at each internal node as the value and all of the cases counted for the
+predicted class at leaves (so the most likely class is the tree's prediction and predict_proba of
+a forest is the fraction of trees voting for each class). If it is numerical they are regressors
+with the mean target value as the value of internal nodes. If it is nil (for example for gradient
+boosting where trees don't predict the target) values are the mean prediction of the cases at each
+node. Leaf values of regressors are always the tree's predictions.
+*/
+func NewScikitForest(fm *FeatureMatrix, targetname string, target Feature) *ScikitForest {
+	sf := &ScikitForest{make([]string, 0, len(fm.Data)),
+		nil,
+		0.0,
+		make([]float64, 0),
+		make([]*ScikitTree, 0),
+		make(map[string]int),
+		make(map[string]map[string]int),
+		target}
+	for _, f := range fm.Data {
+		name := f.GetName()
+		if name == targetname {
+			continue
+		}
+		cf, ok := f.(CatFeature)
+		if !ok {
+			sf.columns[name] = len(sf.FeatureNames)
+			sf.FeatureNames = append(sf.FeatureNames, name)
+			continue
+		}
+		sf.catcolumns[name] = make(map[string]int)
+		for i := 0; i < cf.NCats(); i++ {
+			sf.catcolumns[name][cf.NumToCat(i)] = len(sf.FeatureNames)
+			sf.FeatureNames = append(sf.FeatureNames, name+"="+cf.NumToCat(i))
+		}
+	}
+	if cf, ok := target.(CatFeature); ok {
+		sf.Classes = make([]string, 0, cf.NCats())
+		for i := 0; i < cf.NCats(); i++ {
+			sf.Classes = append(sf.Classes, cf.NumToCat(i))
+		}
+	}
+	return sf
+}
+
+/*
+AddTree converts tree and adds it to the forest. Node sample counts, impurities (gini for
+classification and variance for regression) and values are found from the cases (which may
+include repeats from bagging) of fm, usually the cases the tree was grown on. Trees with oblique
+splits or a third branch for missing values can't be converted.
+*/
+func (sf *ScikitForest) AddTree(tree *Tree, fm *FeatureMatrix, cases []int) error {
+	nClasses := 1
+	if sf.Classes != nil {
+		nClasses = len(sf.Classes)
+	}
+	b := &scikitBuilder{sf, newScikitTree(len(sf.FeatureNames), nClasses), fm}
+	if _, _, err := b.build(tree.Root, append([]int(nil), cases...), 0); err != nil {
+		return err
+	}
+	b.tree.NodeCount = len(b.tree.Nodes)
+	b.tree.Capacity = len(b.tree.Nodes)
+	sf.Estimators = append(sf.Estimators, b.tree)
+	sf.Weights = append(sf.Weights, tree.Weight)
+	return nil
+}
+
+//BuildScikitForest converts every tree of forest as in NewScikitForest and AddTree.
+func BuildScikitForest(forest *Forest, fm *FeatureMatrix, target Feature, cases []int) (*ScikitForest, error) {
+	sf := NewScikitForest(fm, forest.Target, target)
+	sf.Intercept = forest.Intercept
+	for i, tree := range forest.Trees {
+		if err := sf.AddTree(tree, fm, cases); err != nil {
+			return nil, fmt.Errorf("Tree %v: %v", i, err)
+		}
+	}
+	return sf, nil
+}
+
+//scikitStats accumulates the predictions of the cases at a node when there is no target.
+type scikitStats struct {
+	Sum   float64
+	SumSq float64
+	N     float64
+}
+
+func (s scikitStats) add(o scikitStats) scikitStats {
+	return scikitStats{s.Sum + o.Sum, s.SumSq + o.SumSq, s.N + o.N}
+}
+
+//scikitBuilder converts a single tree.
+type scikitBuilder struct {
+	sf   *ScikitForest
+	tree *ScikitTree
+	fm   *FeatureMatrix
+}
+
+//addNode appends a leaf node describing cases and returns its id.
+func (b *scikitBuilder) addNode(cases []int, depth int) int {
+	if depth > b.tree.MaxDepth {
+		b.tree.MaxDepth = depth
+	}
+	id := len(b.tree.Nodes)
+	distinct := make(map[int]bool, len(cases))
+	for _, c := range cases {
+		distinct[c] = true
+	}
+	b.tree.Nodes = append(b.tree.Nodes, ScikitNode{-1, -1, -2, -2.0, 0.0, len(distinct), float64(len(cases)), 0})
+	value := make([]float64, b.tree.MaxNClasses)
+	b.tree.Value = append(b.tree.Value, [][]float64{value})
 
+	switch target := b.sf.target.(type) {
+	case CatFeature:
+		total := 0.0
+		for _, c := range cases {
+			if !target.IsMissing(c) {
+				value[target.Geti(c)]++
+				total++
+			}
+		}
+		if total > 0 {
+			gini := 1.0
+			for _, v := range value {
+				gini -= (v / total) * (v / total)
+			}
+			b.tree.Nodes[id].Impurity = gini
+		}
+	case NumFeature:
+		sum, sumsq, n := 0.0, 0.0, 0.0
+		for _, c := range cases {
+			if !target.IsMissing(c) {
+				v := target.Get(c)
+				sum += v
+				sumsq += v * v
+				n++
+			}
+		}
+		if n > 0 {
+			value[0] = sum / n
+			b.tree.Nodes[id].Impurity = sumsq/n - value[0]*value[0]
+		}
+	}
+	return id
+}
+
+//finish sets the value and impurity of a node from the predictions of its cases if there is no
+//target.
+func (b *scikitBuilder) finish(id int, s scikitStats) {
+	if b.sf.target == nil && s.N > 0 {
+		mean := s.Sum / s.N
+		b.tree.Value[id][0][0] = mean
+		b.tree.Nodes[id].Impurity = s.SumSq/s.N - mean*mean
+	}
+}
+
+//build converts n and its children for the cases reaching it and returns the id of the
+//converted node.
+func (b *scikitBuilder) build(n *Node, cases []int, depth int) (id int, s scikitStats, err error) {
+	if n.Splitter == nil {
+		return b.leaf(n, cases, depth)
+	}
+	if n.Missing != nil {
+		return 0, s, fmt.Errorf("Splits with a missing branch on %v can't be converted.", n.Splitter.Feature)
+	}
+	if n.Splitter.IsOblique() {
+		return 0, s, fmt.Errorf("Oblique splits on %v can't be converted.", n.Splitter.Feature)
+	}
+	if !n.Splitter.Numerical {
+		return b.categorical(n, cases, depth)
+	}
+
+	col, ok := b.sf.columns[n.Splitter.Feature]
+	if !ok {
+		return 0, s, fmt.Errorf("Numerical feature %v not found.", n.Splitter.Feature)
+	}
+	id = b.addNode(cases, depth)
+	b.tree.Nodes[id].Feature = col
+	b.tree.Nodes[id].Threshold = n.Splitter.Value
+	if n.MissingLeft {
+		b.tree.Nodes[id].MissingGoToLeft = 1
+	}
+	ls, rs, ms := n.SplitCases(b.fm, cases)
+	//Cases still missing go the way scikit-learn will send NaN.
+	if len(ms) > 0 {
+		if n.MissingLeft {
+			ls = append(append([]int(nil), ls...), ms...)
+		} else {
+			rs = append(append([]int(nil), rs...), ms...)
+		}
+	}
+	left, lstats, err := b.build(n.Left, ls, depth+1)
+	if err != nil {
+		return
+	}
+	right, rstats, err := b.build(n.Right, rs, depth+1)
+	if err != nil {
+		return
+	}
+	b.tree.Nodes[id].LeftChild = left
+	b.tree.Nodes[id].RightChild = right
+	s = lstats.add(rstats)
+	b.finish(id, s)
+	return
+}
+
+//leaf converts a leaf node.
+func (b *scikitBuilder) leaf(n *Node, cases []int, depth int) (id int, s scikitStats, err error) {
+	id = b.addNode(cases, depth)
+	value := b.tree.Value[id][0]
+	if cf, ok := b.sf.target.(CatFeature); ok {
+		//The leaf's cases all count for its prediction which isn't always their most common
+		//class (with costs, class weights, hellinger distance or boosting).
+		total := 0.0
+		for i, v := range value {
+			total += v
+			value[i] = 0.0
+		}
+		if total == 0 {
+			total = 1.0
+		}
+		for i := 0; i < cf.NCats(); i++ {
+			if cf.NumToCat(i) == n.Pred {
+				value[i] = total
+			}
+		}
+		return
+	}
+	pred, perr := strconv.ParseFloat(n.Pred, 64)
+	if perr != nil {
+		return 0, s, fmt.Errorf("Leaf prediction %v isn't a number.", n.Pred)
+	}
+	value[0] = pred
+	N := float64(len(cases))
+	s = scikitStats{pred * N, pred * pred * N, N}
+	return
+}
+
+//categorical converts a categorical split into a chain of splits on one hot encoded columns.
+func (b *scikitBuilder) categorical(n *Node, cases []int, depth int) (id int, s scikitStats, err error) {
+	cols, ok := b.sf.catcolumns[n.Splitter.Feature]
+	if !ok {
+		return 0, s, fmt.Errorf("Categorical feature %v not found.", n.Splitter.Feature)
+	}
+	var left, right []string
+	for cat := range cols {
+		if n.Splitter.Left[cat] {
+			left = append(left, cat)
+		} else {
+			right = append(right, cat)
+		}
+	}
+	switch {
+	case len(left) == 0:
+		return b.build(n.Right, cases, depth)
+	case len(right) == 0:
+		return b.build(n.Left, cases, depth)
+	}
+	sort.Strings(left)
+	sort.Strings(right)
+
+	//Test membership in the side missing cases, which have no one hot column set, don't follow.
+	chain, branch, other := left, n.Left, n.Right
+	if n.MissingLeft {
+		chain, branch, other = right, n.Right, n.Left
+	}
+	id = b.addNode(cases, depth)
+	s, err = b.chain(id, n.Splitter.Feature, chain, branch, other, cases, depth)
+	return
+}
+
+/*
+chain makes node id a split on the column of the first category of cats sending cases with it
+right to a copy of branch and the rest left to a split on the next category or, after the last
+one, to a copy of other.
+*/
+func (b *scikitBuilder) chain(id int, feature string, cats []string, branch *Node, other *Node, cases []int, depth int) (s scikitStats, err error) {
+	f := b.fm.Data[b.fm.Map[feature]]
+	b.tree.Nodes[id].Feature = b.sf.catcolumns[feature][cats[0]]
+	b.tree.Nodes[id].Threshold = 0.5
+	in, out := make([]int, 0), make([]int, 0)
+	for _, c := range cases {
+		if !f.IsMissing(c) && f.GetStr(c) == cats[0] {
+			in = append(in, c)
+		} else {
+			out = append(out, c)
+		}
+	}
+
+	var left, right int
+	var lstats, rstats scikitStats
+	if len(cats) > 1 {
+		left = b.addNode(out, depth+1)
+		lstats, err = b.chain(left, feature, cats[1:], branch, other, out, depth+1)
 	} else {
-		// Leaf node
-		sktree.Nodes[pos].LeftChild = -1
-		sktree.Nodes[pos].RightChild = -1
+		left, lstats, err = b.build(other, out, depth+1)
+	}
+	if err != nil {
+		return
+	}
+	right, rstats, err = b.build(branch, in, depth+1)
+	if err != nil {
+		return
 	}
+	b.tree.Nodes[id].LeftChild = left
+	b.tree.Nodes[id].RightChild = right
+	s = lstats.add(rstats)
+	b.finish(id, s)
+	return
 }
@@ -0,0 +1,147 @@
+package CloudForest
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+//scikitRow one hot encodes case c of fm in the column layout of sf.
+func scikitRow(sf *ScikitForest, fm *FeatureMatrix, c int) []float64 {
+	row := make([]float64, len(sf.FeatureNames))
+	for name, col := range sf.columns {
+		f := fm.Data[fm.Map[name]]
+		row[col] = math.NaN()
+		if !f.IsMissing(c) {
+			row[col] = f.(NumFeature).Get(c)
+		}
+	}
+	for name, cols := range sf.catcolumns {
+		f := fm.Data[fm.Map[name]]
+		if !f.IsMissing(c) {
+			row[cols[f.GetStr(c)]] = 1.0
+		}
+	}
+	return row
+}
+
+//scikitLeaf returns the id of the leaf row reaches as scikit-learn's apply would.
+func scikitLeaf(tree *ScikitTree, row []float64) int {
+	id := 0
+	for tree.Nodes[id].LeftChild != -1 {
+		n := tree.Nodes[id]
+		v := row[n.Feature]
+		if (math.IsNaN(v) && n.MissingGoToLeft == 1) || v <= n.Threshold {
+			id = n.LeftChild
+		} else {
+			id = n.RightChild
+		}
+	}
+	return id
+}
+
+func TestScikitExport(t *testing.T) {
+	data := ParseAFM(strings.NewReader(fm))
+	cases := []int{0, 1, 2, 3, 4, 5, 6, 7}
+
+	tree := &Tree{nil, "C:CatTarget", -1.0}
+	tree.AddNode("*", "", &Splitter{"C:QuadVar", false, 0.0, map[string]bool{"0": true, "1": true, "3": true}, nil, nil})
+	tree.AddNode("*L", "", &Splitter{"N:FloatVar", true, 0.5, nil, nil, nil})
+	tree.AddNode("*LL", "1", nil)
+	tree.AddNode("*LR", "2", nil)
+	tree.AddNode("*R", "3", nil)
+	tree.Root.MissingLeft = true
+	forest := &Forest{"C:CatTarget", []*Tree{tree}, 0.0, nil}
+
+	sf, err := BuildScikitForest(forest, data, data.Data[1], cases)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sf.FeatureNames) != 10 || sf.FeatureNames[3] != "C:QuadVar=2" || len(sf.Classes) != 2 {
+		t.Errorf("Scikit forest has features %v and classes %v.", sf.FeatureNames, sf.Classes)
+	}
+	skt := sf.Estimators[0]
+	if skt.NClasses[0] != 2 || skt.NodeCount != 7 || skt.MaxDepth != 3 {
+		t.Errorf("Scikit tree has %v classes, %v nodes and depth %v not 2, 7 and 3.", skt.NClasses[0], skt.NodeCount, skt.MaxDepth)
+	}
+	root := skt.Nodes[0]
+	if root.NNodeSamples != 8 || math.Abs(root.Impurity-30.0/64.0) > 1e-9 || skt.Value[0][0][0] != 5 || skt.Value[0][0][1] != 3 {
+		t.Errorf("Scikit root %+v has value %v.", root, skt.Value[0])
+	}
+	if root.Feature != 3 || root.Threshold != 0.5 || skt.Nodes[skt.Nodes[0].RightChild].NNodeSamples != 1 {
+		t.Errorf("Categorical split converted to %+v.", root)
+	}
+	//Case 4 is the only case on the leaf predicting 1 but is of class 0.
+	if v := skt.Value[scikitLeaf(skt, scikitRow(sf, data, 4))][0]; v[0] != 0 || v[1] != 1 {
+		t.Errorf("Scikit leaf predicting 1 has value %v.", v)
+	}
+
+	//Without a target values are the predictions of the tree and the one hot encoded chains must
+	//reach leaves predicting the same thing.
+	sf, err = BuildScikitForest(forest, data, nil, cases)
+	if err != nil {
+		t.Fatal(err)
+	}
+	skt = sf.Estimators[0]
+	if math.Abs(skt.Value[0][0][0]-(1.0+5*2.0+2*3.0)/8.0) > 1e-9 {
+		t.Errorf("Scikit root value %v isn't the mean prediction.", skt.Value[0][0][0])
+	}
+	bb := NewNumBallotBox(len(cases))
+	tree.Vote(data, bb)
+	for _, c := range cases {
+		pred := bb.TallyNum(c)
+		if v := skt.Value[scikitLeaf(skt, scikitRow(sf, data, c))][0][0]; v != pred {
+			t.Errorf("Case %v reached scikit value %v not %v.", c, v, pred)
+		}
+	}
+
+	//Grown regression trees.
+	target := data.Data[0]
+	grown := GrowRandomForest(data, target, []int{2, 3, 4}, 8, 3, 5, 1, 0, false, false, false, false, nil)
+	sf, err = BuildScikitForest(grown, data, target, cases)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, tree := range grown.Trees {
+		skt := sf.Estimators[i]
+		//Trees that are a single leaf have their prediction as the root value.
+		if skt.NClasses[0] != 1 || (len(skt.Nodes) > 1 && math.Abs(skt.Value[0][0][0]-2.7/8.0) > 1e-9) {
+			t.Errorf("Scikit regressor has %v classes and root value %v.", skt.NClasses[0], skt.Value[0][0][0])
+		}
+		bb := NewNumBallotBox(len(cases))
+		tree.Vote(data, bb)
+		for _, c := range cases {
+			pred := bb.TallyNum(c)
+			if v := skt.Value[scikitLeaf(skt, scikitRow(sf, data, c))][0][0]; math.Abs(v-pred) > 1e-9 {
+				t.Errorf("Case %v reached scikit value %v not %v.", c, v, pred)
+			}
+		}
+	}
+
+	//Case 0 is missing QuadVar and follows MissingLeft to the leaf predicting 2 or to the right.
+	missing := ParseAFM(strings.NewReader(fmissing))
+	for _, missingleft := range []bool{true, false} {
+		tree.Root.MissingLeft = missingleft
+		sf, err = BuildScikitForest(forest, missing, nil, cases)
+		if err != nil {
+			t.Fatal(err)
+		}
+		skt = sf.Estimators[0]
+		want := map[bool]float64{true: 2.0, false: 3.0}[missingleft]
+		if v := skt.Value[scikitLeaf(skt, scikitRow(sf, missing, 0))][0][0]; v != want {
+			t.Errorf("Case missing the split feature with MissingLeft %v reached %v not %v.", missingleft, v, want)
+		}
+	}
+
+	tree.AddNode("*M", "4", nil)
+	if _, err := BuildScikitForest(forest, data, nil, cases); err == nil {
+		t.Error("Tree with a missing branch converted.")
+	}
+
+	//The deprecated structure only conversion.
+	skt = NewScikitTree(len(data.Data))
+	BuildScikitTree(0, tree.Root, skt)
+	if skt.NodeCount != 5 || skt.MaxDepth != 2 || skt.Nodes[0].LeftChild != 1 || skt.Nodes[0].RightChild != 4 || skt.Nodes[4].LeftChild != -1 {
+		t.Errorf("Scikit tree structure %+v.", skt)
+	}
+}
@@ -29,7 +29,8 @@ type BestSplitAllocs struct {
 	SortVals       []float64
 	Sorter         *SortableFeature //for learning from numerical features
 	ContrastTarget Target
-	Rnd            *rand.Rand //prevent contention on global rand source
+	Rnd            *rand.Rand     //prevent contention on global rand source
+	Monotone       map[string]int //monotonicity constraints (1 or -1) of the target on features by name
 }
 
 //NewBestSplitAllocs initializes all of the reusable allocations for split
@@ -68,6 +69,7 @@ func NewBestSplitAllocs(nTotalCases int, target Target) (bsa *BestSplitAllocs) {
 			nil},
 		target.(Feature).Copy().(Target),
 		rand.New(rand.NewSource(rand.Int63())),
+		nil,
 	}
 	return
 }
@@ -1,17 +1,69 @@
 package CloudForest
 
 import (
-//"fmt"
+	"strings"
 )
 
 //Splitter contains fields that can be used to cases by a single feature. The split
 //can be either numerical in which case it is defined by the Value field or
 //categorical in which case it is defined by the Left and Right fields.
+//
+//Oblique splitters split on a linear combination of numerical features. They define
+//Features and Weights and send cases whose weighted sum is <= Value left. Their Feature is
+//the names of the Features joined by ";" and Numerical is true.
 type Splitter struct {
 	Feature   string
 	Numerical bool
 	Value     float64
 	Left      map[string]bool
+	Features  []string
+	Weights   []float64
+}
+
+//NewObliqueSplitter returns a splitter that sends cases whose sum of features weighted by
+//weights is <= threshold left.
+func NewObliqueSplitter(features []string, weights []float64, threshold float64) *Splitter {
+	return &Splitter{strings.Join(features, ";"), true, threshold, nil, features, weights}
+}
+
+//IsOblique returns true if the splitter splits on a linear combination of features.
+func (s *Splitter) IsOblique() bool {
+	return len(s.Weights) > 0
+}
+
+//Project returns the weighted sum of the features of an oblique splitter for case i of fm.
+//ok is false if any of the features is missing or not in fm.
+func (s *Splitter) Project(fm *FeatureMatrix, i int) (v float64, ok bool) {
+	for j, name := range s.Features {
+		fi, present := fm.Map[name]
+		if !present || fm.Data[fi].IsMissing(i) {
+			return 0.0, false
+		}
+		v += s.Weights[j] * fm.Data[fi].(NumFeature).Get(i)
+	}
+	return v, true
+}
+
+//GoesLeft checks if case i of fm goes left according to the splitter. ok is false if the case
+//is missing the splitting feature (or any of the features of an oblique splitter).
+func (s *Splitter) GoesLeft(fm *FeatureMatrix, i int) (left bool, ok bool) {
+	if s.IsOblique() {
+		v, ok := s.Project(fm, i)
+		return ok && v <= s.Value, ok
+	}
+	fi, present := fm.Map[s.Feature]
+	if !present || fm.Data[fi].IsMissing(i) {
+		return false, false
+	}
+	return fm.Data[fi].GoesLeft(i, s), true
+}
+
+//UsedFeatures returns the names of the features the splitter splits on.
+func (s *Splitter) UsedFeatures() []string {
+	if s.IsOblique() {
+		return s.Features
+	}
+	return []string{s.Feature}
 }
 
 //func
@@ -22,6 +74,9 @@ a new underlying array by sorting cases into left, missing, right order and retu
 slices that point to the left and right cases.
 */
 func (s *Splitter) Split(fm *FeatureMatrix, cases []int) (l []int, r []int, m []int) {
+	if s.IsOblique() {
+		return s.splitOblique(fm, cases)
+	}
 	length := len(cases)
 
 	lastleft := -1
@@ -66,3 +121,27 @@ func (s *Splitter) Split(fm *FeatureMatrix, cases []int) (l []int, r []int, m []
 
 	return
 }
+
+//splitOblique is Split for oblique splitters. Cases missing any of the features are missing.
+func (s *Splitter) splitOblique(fm *FeatureMatrix, cases []int) (l []int, r []int, m []int) {
+	lastleft := -1
+	lastright := len(cases)
+	for i := 0; i < lastright; i++ {
+		left, ok := s.GoesLeft(fm, cases[i])
+		switch {
+		case !ok:
+			continue
+		case left:
+			lastleft++
+			cases[i], cases[lastleft] = cases[lastleft], cases[i]
+		default:
+			lastright--
+			cases[i], cases[lastright] = cases[lastright], cases[i]
+			i--
+		}
+	}
+	l = cases[:lastleft+1]
+	r = cases[lastright:]
+	m = cases[lastleft+1 : lastright]
+	return
+}
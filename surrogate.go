@@ -0,0 +1,229 @@
+package CloudForest
+
+import (
+	"github.com/ryanbressler/CloudForest/sortby"
+	"sort"
+)
+
+//Surrogate is a backup splitter used to route cases that are missing the feature used by
+//a node's primary Splitter as in CART. Reversed indicates that cases the surrogate's
+//Splitter sends left should follow the primary right branch and vice versa. Agreement is
+//the fraction of in bag cases the surrogate sent the same way as the primary splitter.
+type Surrogate struct {
+	Splitter  *Splitter
+	Reversed  bool
+	Agreement float64
+}
+
+//GoesLeft checks if case i should follow the primary splitter's left branch according to
+//the surrogate. ok is false if the surrogate's feature is missing for the case or not
+//present in fm.
+func (s *Surrogate) GoesLeft(fm *FeatureMatrix, i int) (left bool, ok bool) {
+	fi, present := fm.Map[s.Splitter.Feature]
+	if !present {
+		return
+	}
+	f := fm.Data[fi]
+	if f.IsMissing(i) {
+		return
+	}
+	ok = true
+	left = f.GoesLeft(i, s.Splitter) != s.Reversed
+	return
+}
+
+/*
+RouteMissing reorders the cases in ms, which should be missing the feature used by the
+node's Splitter, so that the cases that should follow the left branch come first and
+returns how many there are. Each case is routed by the first of the node's Surrogates
+that can be evaluated for it and by the majority direction seen in training otherwise.
+*/
+func (n *Node) RouteMissing(fm *FeatureMatrix, ms []int) (nleft int) {
+	for i, c := range ms {
+		left := n.MissingLeft
+		for _, s := range n.Surrogates {
+			if sl, ok := s.GoesLeft(fm, c); ok {
+				left = sl
+				break
+			}
+		}
+		if left {
+			ms[i], ms[nleft] = ms[nleft], ms[i]
+			nleft++
+		}
+	}
+	return
+}
+
+type surrogatesByAssociation struct {
+	surrogates  []*Surrogate
+	association []float64
+}
+
+func (s *surrogatesByAssociation) Len() int {
+	return len(s.surrogates)
+}
+
+func (s *surrogatesByAssociation) Less(i int, j int) bool {
+	return s.association[i] > s.association[j]
+}
+
+func (s *surrogatesByAssociation) Swap(i int, j int) {
+	s.surrogates[i], s.surrogates[j] = s.surrogates[j], s.surrogates[i]
+	s.association[i], s.association[j] = s.association[j], s.association[i]
+}
+
+/*
+BestSurrogates finds up to nSurrogates Surrogates for the split of cases made by
+splitter on the feature at index fi. Each of the candidates is searched for the split that
+best reproduces the primary split and surrogates are ranked by Breiman et al's predictive
+measure of association, (min(pL,pR)-(1-agreement))/min(pL,pR), which must be positive for a
+surrogate to be kept.
+
+missingLeft reports the direction taken by the majority of the cases and is used as the final
+fallback when no surrogate can be evaluated for a case.
+*/
+func (fm *FeatureMatrix) BestSurrogates(splitter *Splitter,
+	fi int,
+	cases []int,
+	candidates []int,
+	nSurrogates int) (surrogates []*Surrogate, missingLeft bool) {
+
+	primary := fm.Data[fi]
+	pcases := make([]int, 0, len(cases))
+	pleft := make([]bool, 0, len(cases))
+	nl := 0
+	for _, c := range cases {
+		if primary.IsMissing(c) {
+			continue
+		}
+		l := primary.GoesLeft(c, splitter)
+		if l {
+			nl++
+		}
+		pcases = append(pcases, c)
+		pleft = append(pleft, l)
+	}
+	missingLeft = 2*nl >= len(pcases)
+	surrogates = make([]*Surrogate, 0, nSurrogates)
+	if nSurrogates <= 0 || len(pcases) == 0 {
+		return
+	}
+
+	found := &surrogatesByAssociation{make([]*Surrogate, 0), make([]float64, 0)}
+	pos := make([]int, 0, len(pcases))
+	vals := make([]float64, 0, len(pcases))
+
+	for _, j := range candidates {
+		if j == fi {
+			continue
+		}
+		f := fm.Data[j]
+		var s *Surrogate
+		var agree, bothl, both int
+
+		switch f.(type) {
+		case NumFeature:
+			nf := f.(NumFeature)
+			pos = pos[0:0]
+			vals = vals[0:0]
+			for p, c := range pcases {
+				if !nf.IsMissing(c) {
+					pos = append(pos, p)
+					vals = append(vals, nf.Get(c))
+					if pleft[p] {
+						bothl++
+					}
+				}
+			}
+			both = len(pos)
+			if both < 2 {
+				continue
+			}
+			sortby.SortBy(&pos, &vals)
+
+			//Scan the gaps between distinct values counting the cases that agree with
+			//the primary split when values <= the gap go left or, if reversed, right.
+			lsofar := 0
+			for i := 0; i < both-1; i++ {
+				if pleft[pos[i]] {
+					lsofar++
+				}
+				if vals[i+1] <= vals[i]+constant_cutoff {
+					continue
+				}
+				rsofar := i + 1 - lsofar
+				forward := lsofar + (both - bothl) - (rsofar)
+				reversed := rsofar + bothl - lsofar
+				if forward > agree {
+					agree = forward
+					s = &Surrogate{&Splitter{f.GetName(), true, (vals[i] + vals[i+1]) / 2.0, nil, nil, nil}, false, 0.0}
+				}
+				if reversed > agree {
+					agree = reversed
+					s = &Surrogate{&Splitter{f.GetName(), true, (vals[i] + vals[i+1]) / 2.0, nil, nil, nil}, true, 0.0}
+				}
+			}
+
+		case CatFeature:
+			cf := f.(CatFeature)
+			ncats := cf.NCats()
+			lcounts := make([]int, ncats)
+			rcounts := make([]int, ncats)
+			for p, c := range pcases {
+				if !cf.IsMissing(c) {
+					if pleft[p] {
+						lcounts[cf.Geti(c)]++
+						bothl++
+					} else {
+						rcounts[cf.Geti(c)]++
+					}
+					both++
+				}
+			}
+			left := make(map[string]bool)
+			nright := 0
+			for k := 0; k < ncats; k++ {
+				switch {
+				case lcounts[k] > rcounts[k]:
+					left[cf.NumToCat(k)] = true
+					agree += lcounts[k]
+				case rcounts[k] > 0:
+					nright++
+					agree += rcounts[k]
+				}
+			}
+			//skip features for which all categories go the same way
+			if len(left) == 0 || nright == 0 {
+				continue
+			}
+			s = &Surrogate{&Splitter{f.GetName(), false, 0.0, left, nil, nil}, false, 0.0}
+		}
+
+		if s == nil || both == 0 {
+			continue
+		}
+
+		//The blind rule sends every case the majority way.
+		minority := bothl
+		if both-bothl < minority {
+			minority = both - bothl
+		}
+		if minority == 0 {
+			continue
+		}
+		association := float64(minority-(both-agree)) / float64(minority)
+		if association <= 0.0 {
+			continue
+		}
+		s.Agreement = float64(agree) / float64(both)
+		found.surrogates = append(found.surrogates, s)
+		found.association = append(found.association, association)
+	}
+
+	sort.Sort(found)
+	for i := 0; i < len(found.surrogates) && i < nSurrogates; i++ {
+		surrogates = append(surrogates, found.surrogates[i])
+	}
+	return
+}
@@ -0,0 +1,76 @@
+package CloudForest
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+//Two redundant numerical features and a categorical one that
+//each perfectly predict the target.
+var surrogatefm = `.	0	1	2	3	4	5	6	7
+C:CatTarget	0	0	0	0	1	1	1	1
+N:First	.1	.2	.3	.4	.6	.7	.8	.9
+N:Reversed	9	8	7	6	4	3	2	1
+C:Color	red	red	blue	red	green	green	green	green`
+
+func TestSurrogates(t *testing.T) {
+	fm := ParseAFM(strings.NewReader(surrogatefm))
+	cases := []int{0, 1, 2, 3, 4, 5, 6, 7}
+	candidates := []int{1, 2, 3}
+	target := fm.Data[0].(Target)
+
+	tree := NewTree()
+	allocs := NewBestSplitAllocs(len(cases), target)
+	tree.Grow(fm, target, cases, candidates, nil, 1, 1, 0, false, false, false, false, false, 2, nil, nil, allocs)
+
+	root := tree.Root
+	if root.Splitter == nil {
+		t.Fatal("Tree grown for surrogate test has no splitter at root.")
+	}
+	if len(root.Surrogates) != 2 {
+		t.Fatalf("Root node recorded %v surrogates not 2.", len(root.Surrogates))
+	}
+	for _, s := range root.Surrogates {
+		if s.Agreement != 1.0 {
+			t.Errorf("Surrogate on %v had agreement %v not 1.0", s.Splitter.Feature, s.Agreement)
+		}
+	}
+
+	//Write out and read back the tree to make sure surrogates are serialized.
+	pipereader, pipewriter := io.Pipe()
+	go func() {
+		fw := NewForestWriter(pipewriter)
+		fw.WriteTree(tree, 0)
+		pipewriter.Close()
+	}()
+	forest, err := NewForestReader(pipereader).ReadForest()
+	if err != nil {
+		t.Fatalf("Error parsing tree with surrogates: %v", err)
+	}
+
+	//Remove the primary splitter's feature from new data and check that cases
+	//still reach leaves through the surrogates.
+	testfm := ParseAFM(strings.NewReader(surrogatefm))
+	primary := testfm.Data[testfm.Map[root.Splitter.Feature]]
+	for _, c := range cases {
+		primary.PutMissing(c)
+	}
+
+	for _, tr := range []*Tree{tree, forest.Trees[0]} {
+		if len(tr.Root.Surrogates) != 2 {
+			t.Errorf("Tree has %v surrogates at root not 2.", len(tr.Root.Surrogates))
+		}
+		votes := NewCatBallotBox(len(cases))
+		tr.Vote(testfm, votes)
+		for _, c := range cases {
+			if votes.Tally(c) == "NA" {
+				t.Errorf("Case %v with missing primary feature was not routed to a leaf.", c)
+			}
+		}
+		if e := votes.TallyError(testfm.Data[0]); e != 0.0 {
+			t.Errorf("Classification using surrogates had error %v.", e)
+		}
+	}
+
+}
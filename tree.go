@@ -28,8 +28,8 @@ func NewTree() *Tree {
 //Splitter. Paths are specified in the same format as in rf-aces sf files, as a
 //string of 'L' and 'R'. Nodes must be added from the root up as the case where
 //the path specifies a node whose parent does not already exist in the tree is
-//not handled well.
-func (t *Tree) AddNode(path string, pred string, splitter *Splitter) {
+//not handled well. It returns the added node.
+func (t *Tree) AddNode(path string, pred string, splitter *Splitter) *Node {
 	n := new(Node)
 	n.Pred = pred
 	n.Splitter = splitter
@@ -59,6 +59,7 @@ func (t *Tree) AddNode(path string, pred string, splitter *Splitter) {
 
 		}
 	}
+	return n
 
 }
 
@@ -92,6 +93,17 @@ leafSize specifies the minimum number of cases at a leafNode.
 splitmissing indicates if missing values should be split onto a third branch
 
 vet indicates if splits should be penalized against a randomized version of them selves
+
+nSurrogates specifies the maximum number of surrogate splitters to record at each node for use
+in routing cases with missing values at prediction time. Surrogates aren't recorded if it is 0
+or splitmissing is true.
+
+If allocs.Monotone is set the target (which must be numerical) is constrained to be non
+decreasing (1) or non increasing (-1) in the named features. BestNumSplit rejects splits on a
+constrained feature whose mean target values are out of order and the leaf values of the two
+branches of such a split are bounded on either side of the midpoint of their means. Bounds are
+passed down to all descendants so every leaf on one side of a constrained split predicts no more
+(or less) than every leaf on the other.
 */
 func (t *Tree) Grow(fm *FeatureMatrix,
 	target Target,
@@ -106,6 +118,7 @@ func (t *Tree) Grow(fm *FeatureMatrix,
 	vet bool,
 	evaloob bool,
 	extraRandom bool,
+	nSurrogates int,
 	importance *[]*RunningMean,
 	depthUsed *[]int,
 	allocs *BestSplitAllocs) {
@@ -122,9 +135,14 @@ func (t *Tree) Grow(fm *FeatureMatrix,
 	// 	}
 	// 	allocs.Weights[i]++
 	// }
+	var bounds map[*Node]monotoneBounds
+	if allocs.Monotone != nil {
+		bounds = map[*Node]monotoneBounds{t.Root: unbounded()}
+	}
 	t.Root.CodedRecurse(func(n *Node, innercases *[]int, depth int, nconstantsbefore int) (fi int, split interface{}, nconstants int) {
 
 		nconstants = nconstantsbefore
+		n.Cover = float64(len(*innercases))
 
 		if (depth < maxDepth || maxDepth <= 0) && (2*leafSize) <= len(*innercases) {
 			//SampleFirstN(&candidates, &innercanidates, mTry, 0)
@@ -158,6 +176,14 @@ func (t *Tree) Grow(fm *FeatureMatrix,
 				}
 				if splitmissing {
 					n.Missing = new(Node)
+				} else if nSurrogates > 0 {
+					n.Surrogates, n.MissingLeft = fm.BestSurrogates(n.Splitter, fi, *innercases, candidates, nSurrogates)
+				}
+				if bounds != nil {
+					bounds[n.Left], bounds[n.Right] = bounds[n].children(fm, target, n.Splitter, *innercases, allocs.Monotone)
+					if n.Missing != nil {
+						bounds[n.Missing] = bounds[n]
+					}
 				}
 				return
 			}
@@ -170,6 +196,9 @@ func (t *Tree) Grow(fm *FeatureMatrix,
 		n.CodedSplit = nil
 		n.Splitter = nil
 		n.Pred = target.FindPredicted(*innercases)
+		if bounds != nil {
+			n.Pred = bounds[n].ClampPred(n.Pred)
+		}
 		return
 
 	}, fm, &cases, 0, 0)
@@ -350,8 +379,10 @@ func (t *Tree) GetLeaves(fm *FeatureMatrix, fbycase *SparseCounter) []Leaf {
 			leaves = append(leaves, Leaf{cases, n.Pred})
 		}
 		if fbycase != nil && n.Splitter != nil { //I'm not in a leaf node?
-			for _, c := range cases {
-				fbycase.Add(c, fm.Map[n.Splitter.Feature], 1)
+			for _, name := range n.Splitter.UsedFeatures() {
+				for _, c := range cases {
+					fbycase.Add(c, fm.Map[name], 1)
+				}
 			}
 		}
 
@@ -388,6 +419,18 @@ type Leaf struct {
 	Pred  string
 }
 
+//SetCovers sets the Cover of each node to the number of the specified cases in fm that
+//reach it. It can be used to give trees that were grown without recording covers, or
+//read from files written before covers were recorded, the covers needed by Tree.SHAP.
+func (t *Tree) SetCovers(fm *FeatureMatrix, cases []int) {
+	t.Root.Climb(func(n *Node) {
+		n.Cover = 0.0
+	})
+	t.Root.Recurse(func(n *Node, cases []int, depth int) {
+		n.Cover = float64(len(cases))
+	}, fm, cases, 0)
+}
+
 //Vote casts a vote for the predicted value of each case in fm *FeatureMatrix.
 //into bb *BallotBox. Since BallotBox is not thread safe trees should not vote
 //into the same BallotBox in parallel.
@@ -0,0 +1,120 @@
+package CloudForest
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+//Describe returns a human readable condition satisfied by the cases the splitter sends left,
+//or right if left is false, such as "N:age <= 42" or "C:color in {blue, red}".
+func (s *Splitter) Describe(left bool) string {
+	if s.IsOblique() {
+		terms := make([]string, 0, len(s.Features))
+		for i, name := range s.Features {
+			terms = append(terms, fmt.Sprintf("%v*%v", s.Weights[i], name))
+		}
+		if left {
+			return fmt.Sprintf("%v <= %v", strings.Join(terms, " + "), s.Value)
+		}
+		return fmt.Sprintf("%v > %v", strings.Join(terms, " + "), s.Value)
+	}
+	if s.Numerical {
+		if left {
+			return fmt.Sprintf("%v <= %v", s.Feature, s.Value)
+		}
+		return fmt.Sprintf("%v > %v", s.Feature, s.Value)
+	}
+	cats := make([]string, 0, len(s.Left))
+	for cat := range s.Left {
+		cats = append(cats, cat)
+	}
+	sort.Strings(cats)
+	if left {
+		return fmt.Sprintf("%v in {%v}", s.Feature, strings.Join(cats, ", "))
+	}
+	return fmt.Sprintf("%v not in {%v}", s.Feature, strings.Join(cats, ", "))
+}
+
+//branches returns the children of a splitter node along with the condition that leads to each
+//and the letter (L, R or M) that is added to the path of the node to get the child's path.
+func (n *Node) branches() (children []*Node, conditions []string, steps []string) {
+	if n.Splitter == nil {
+		return
+	}
+	if n.Left != nil {
+		children = append(children, n.Left)
+		conditions = append(conditions, n.Splitter.Describe(true))
+		steps = append(steps, "L")
+	}
+	if n.Right != nil {
+		children = append(children, n.Right)
+		conditions = append(conditions, n.Splitter.Describe(false))
+		steps = append(steps, "R")
+	}
+	if n.Missing != nil {
+		children = append(children, n.Missing)
+		conditions = append(conditions, n.Splitter.Feature+" is missing")
+		steps = append(steps, "M")
+	}
+	return
+}
+
+//leafLabel describes the prediction and cover of a leaf.
+func (n *Node) leafLabel() string {
+	if n.Cover > 0 {
+		return fmt.Sprintf("%v (cover %v)", n.Pred, n.Cover)
+	}
+	return n.Pred
+}
+
+/*
+WriteText writes the tree to w as indented text with a line for each branch giving the
+condition cases must meet to follow it and a line for each leaf giving its prediction:
+
+	N:x1 <= 0.5
+	  C:color in {blue, red}
+	    predict 1.2 (cover 14)
+	...
+*/
+func (t *Tree) WriteText(w io.Writer) {
+	var write func(n *Node, indent string)
+	write = func(n *Node, indent string) {
+		if n.Splitter == nil {
+			fmt.Fprintf(w, "%vpredict %v\n", indent, n.leafLabel())
+			return
+		}
+		children, conditions, _ := n.branches()
+		for i, child := range children {
+			fmt.Fprintf(w, "%v%v\n", indent, conditions[i])
+			write(child, indent+"  ")
+		}
+	}
+	write(t.Root, "")
+}
+
+//WriteDOT writes the tree to w as a Graphviz DOT digraph with the specified name. Nodes are
+//named by their path in the tree as in .sf files.
+func (t *Tree) WriteDOT(w io.Writer, name string) {
+	quote := func(s string) string {
+		return "\"" + strings.Replace(s, "\"", "\\\"", -1) + "\""
+	}
+	fmt.Fprintf(w, "digraph %v {\n", quote(name))
+	var write func(n *Node, path string)
+	write = func(n *Node, path string) {
+		if n.Splitter == nil {
+			fmt.Fprintf(w, "\t%v [label=%v, shape=box];\n", quote(path), quote(n.leafLabel()))
+			return
+		}
+		fmt.Fprintf(w, "\t%v [label=%v];\n", quote(path), quote(n.Splitter.Feature))
+		children, conditions, steps := n.branches()
+		for i, child := range children {
+			childpath := path + steps[i]
+			fmt.Fprintf(w, "\t%v -> %v [label=%v];\n", quote(path), quote(childpath), quote(conditions[i]))
+			write(child, childpath)
+		}
+	}
+	write(t.Root, "*")
+	fmt.Fprintln(w, "}")
+}
@@ -0,0 +1,42 @@
+package CloudForest
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTreeFormats(t *testing.T) {
+	tree := new(Tree)
+	tree.AddNode("*", "", &Splitter{"N:age", true, 42.0, nil, nil, nil})
+	tree.AddNode("*L", "", &Splitter{"C:color", false, 0.0, map[string]bool{"red": true, "blue": true}, nil, nil})
+	tree.AddNode("*LL", "1", nil)
+	tree.AddNode("*LR", "2", nil)
+	tree.AddNode("*R", "3", nil)
+
+	text := new(bytes.Buffer)
+	tree.WriteText(text)
+	expected := `N:age <= 42
+  C:color in {blue, red}
+    predict 1
+  C:color not in {blue, red}
+    predict 2
+N:age > 42
+  predict 3
+`
+	if text.String() != expected {
+		t.Errorf("Tree rendered as text:\n%v\nnot:\n%v", text.String(), expected)
+	}
+
+	dot := new(bytes.Buffer)
+	tree.WriteDOT(dot, "tree0")
+	for _, line := range []string{
+		`digraph "tree0" {`,
+		`"*" -> "*L" [label="N:age <= 42"];`,
+		`"*L" -> "*LR" [label="C:color not in {blue, red}"];`,
+		`"*R" [label="3", shape=box];`} {
+		if !strings.Contains(dot.String(), line) {
+			t.Errorf("Tree rendered as dot doesn't contain %v:\n%v", line, dot.String())
+		}
+	}
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/ryanbressler/CloudForest"
+	"github.com/ryanbressler/CloudForest/metrics"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//trial is a point in the search space and its score.
+type trial struct {
+	MTry      string
+	LeafSize  string
+	MaxDepth  int
+	NSamples  string
+	Impurity  string
+	GradBoost float64
+	Score     float64
+	Err       error
+}
+
+//options returns a copy of base with the parameters of the trial set.
+func (t *trial) options(base *CloudForest.GrowOptions, costs map[string]float64) *CloudForest.GrowOptions {
+	o := *base
+	o.MTry = t.MTry
+	o.LeafSize = t.LeafSize
+	o.MaxDepth = t.MaxDepth
+	o.NSamples = t.NSamples
+	o.GradBoost = t.GradBoost
+	switch t.Impurity {
+	case "entropy":
+		o.Entropy = true
+	case "hellinger":
+		o.Hellinger = true
+	case "cost":
+		o.Costs = costs
+	case "l1":
+		o.L1 = true
+	}
+	return &o
+}
+
+//byScore sorts trials best first with failed trials last.
+type byScore struct {
+	Trials []*trial
+	Higher bool
+}
+
+func (s byScore) Len() int      { return len(s.Trials) }
+func (s byScore) Swap(i, j int) { s.Trials[i], s.Trials[j] = s.Trials[j], s.Trials[i] }
+func (s byScore) Less(i, j int) bool {
+	a, b := s.Trials[i].Score, s.Trials[j].Score
+	switch {
+	case math.IsNaN(b):
+		return !math.IsNaN(a)
+	case math.IsNaN(a):
+		return false
+	case s.Higher:
+		return a > b
+	}
+	return a < b
+}
+
+//splitList splits a comma separated list of values.
+func splitList(list string) (values []string) {
+	for _, v := range strings.Split(list, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return
+}
+
+/*
+score grows a forest with the options o and returns the metric on the out of bag cases or, if
+tests isn't nil, the mean of the metric over the cross validation folds with those test cases.
+*/
+func score(data *CloudForest.FeatureMatrix, targetname string, o *CloudForest.GrowOptions, tests [][]int, metric string, positive string) (float64, error) {
+	targetf := data.Data[data.Map[targetname]]
+	if tests == nil {
+		oob := o.NewBallotBox(targetf, targetf.Length())
+		if _, err := o.GrowForestOOB(data, targetname, oob); err != nil {
+			return math.NaN(), err
+		}
+		results, err := metrics.EvaluateVotes(metric, oob, targetf, 0.0, positive)
+		if err != nil {
+			return math.NaN(), err
+		}
+		return results[0].Value, nil
+	}
+
+	folds := CloudForest.NewCVFolds(tests, targetf.Length())
+	CloudForest.CrossValidate(data, targetname, folds, o, 1)
+	foldresults := make([][]metrics.Result, 0, len(folds))
+	for _, fold := range folds {
+		if fold.Err != nil {
+			return math.NaN(), fold.Err
+		}
+		foldtarget := fold.TestData.Data[fold.TestData.Map[targetname]]
+		results, err := metrics.EvaluateVotes(metric, fold.Votes, foldtarget, fold.Forest.Intercept, positive)
+		if err != nil {
+			return math.NaN(), err
+		}
+		foldresults = append(foldresults, results)
+	}
+	means, _ := metrics.Summarize(foldresults)
+	return means[0].Value, nil
+}
+
+func main() {
+	fm := flag.String("train",
+		"featurematrix.afm", "AFM formated feature matrix containing training data.")
+	targetname := flag.String("target",
+		"", "The row header of the target in the feature matrix.")
+	resultsfn := flag.String("results",
+		"tuning.tsv", "File name to write the ranked results table to.")
+	bestfn := flag.String("best",
+		"best.json", "File name to write the options of the best configuration to as json.")
+
+	mTrys := flag.String("mTry",
+		"0", "Comma separated values of mTry to search (counts or portions of total, <=0 for the default).")
+	leafSizes := flag.String("leafSize",
+		"0", "Comma separated values of leafSize to search (counts or portions of total, <=0 for the default).")
+	maxDepths := flag.String("maxDepth",
+		"0", "Comma separated values of maxDepth to search (0 for unlimited).")
+	nSampless := flag.String("nSamples",
+		"0", "Comma separated values of nSamples to search (counts or portions of total, <=0 for all cases).")
+	impurities := flag.String("impurity",
+		"default", "Comma separated impurities to search: default, entropy, hellinger or cost for classification and default or l1 for regression.")
+	gbts := flag.String("gbt",
+		"0", "Comma separated gradient boosting learning rates to search (0 for no boosting).")
+	costs := flag.String("cost",
+		"", "Json string to float map of the cost of falsely identifying each category for the cost impurity.")
+
+	base := CloudForest.NewGrowOptions()
+	flag.IntVar(&base.NTrees, "nTrees", base.NTrees, "Number of trees to grow in each forest.")
+	flag.StringVar(&base.Positive, "positive", base.Positive, "Positive class for hellinger distance, gradient boosting classification and the auc, prauc and brier metrics.")
+	flag.StringVar(&base.BlockRE, "blockRE", base.BlockRE, "A regular expression to identify features that should be filtered out.")
+	flag.StringVar(&base.IncludeRE, "includeRE", base.IncludeRE, "Filter features that DON'T match this RE.")
+
+	var search string
+	flag.StringVar(&search, "search", "grid", "Search strategy: grid to try every combination or random to try -nRandom of them.")
+
+	var nRandom int
+	flag.IntVar(&nRandom, "nRandom", 20, "Number of combinations to try in random search.")
+
+	var scoring string
+	flag.StringVar(&scoring, "score", "oob", "Score configurations by oob (out of bag) or cv (internal cross validation).")
+
+	var nFolds int
+	flag.IntVar(&nFolds, "folds", 5, "Number of folds for -score cv.")
+
+	var metric string
+	flag.StringVar(&metric, "metric", "", "Metric to rank configurations by (see growforest -metrics). Defaults to accuracy or rmse.")
+
+	var nCores int
+	flag.IntVar(&nCores, "nCores", 1, "The number of cores to use (configurations are evaluated in parallel).")
+
+	var noseed bool
+	flag.BoolVar(&noseed, "noseed", false, "Don't seed the random number generator from time.")
+
+	flag.Parse()
+
+	if !noseed {
+		rand.Seed(time.Now().UTC().UnixNano())
+	}
+	if nCores > 1 {
+		runtime.GOMAXPROCS(nCores)
+	}
+
+	fmt.Printf("Loading data from: %v\n", *fm)
+	data, err := CloudForest.LoadAFM(*fm)
+	if err != nil {
+		log.Fatal(err)
+	}
+	targeti, ok := data.Map[*targetname]
+	if !ok {
+		log.Fatal("Target not found in data.")
+	}
+	targetf := data.Data[targeti]
+	if metric == "" {
+		metric = "rmse"
+		if targetf.NCats() > 0 {
+			metric = "accuracy"
+		}
+	}
+	if strings.Contains(metric, ",") || metric == "confusion" {
+		log.Fatal("-metric must be a single metric other than confusion.")
+	}
+
+	var costmap map[string]float64
+	if *costs != "" {
+		if err := json.Unmarshal([]byte(*costs), &costmap); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	//Build the grid.
+	trials := []*trial{new(trial)}
+	expand := func(values []string, set func(t *trial, v string) error) {
+		expanded := make([]*trial, 0, len(trials)*len(values))
+		for _, t := range trials {
+			for _, v := range values {
+				nt := *t
+				if err := set(&nt, v); err != nil {
+					log.Fatal(err)
+				}
+				expanded = append(expanded, &nt)
+			}
+		}
+		trials = expanded
+	}
+	expand(splitList(*mTrys), func(t *trial, v string) error { t.MTry = v; return nil })
+	expand(splitList(*leafSizes), func(t *trial, v string) error { t.LeafSize = v; return nil })
+	expand(splitList(*maxDepths), func(t *trial, v string) (err error) { t.MaxDepth, err = strconv.Atoi(v); return })
+	expand(splitList(*nSampless), func(t *trial, v string) error { t.NSamples = v; return nil })
+	expand(splitList(*impurities), func(t *trial, v string) error {
+		switch {
+		case v == "default":
+		case targetf.NCats() > 0 && (v == "entropy" || v == "hellinger" || v == "cost"):
+		case targetf.NCats() == 0 && v == "l1":
+		default:
+			return fmt.Errorf("Impurity %v can't be used with target %v.", v, *targetname)
+		}
+		if v == "cost" && costmap == nil {
+			return fmt.Errorf("The cost impurity needs -cost.")
+		}
+		t.Impurity = v
+		return nil
+	})
+	expand(splitList(*gbts), func(t *trial, v string) (err error) {
+		t.GradBoost, err = strconv.ParseFloat(v, 64)
+		if err == nil && t.GradBoost != 0.0 && scoring != "cv" {
+			err = fmt.Errorf("Boosting can only be tuned with -score cv.")
+		}
+		return
+	})
+	if len(trials) == 0 {
+		log.Fatal("Empty search space.")
+	}
+
+	switch search {
+	case "grid":
+	case "random":
+		perm := rand.Perm(len(trials))
+		sampled := make([]*trial, 0, nRandom)
+		for i := 0; i < nRandom && i < len(trials); i++ {
+			sampled = append(sampled, trials[perm[i]])
+		}
+		trials = sampled
+	default:
+		log.Fatal("-search must be grid or random.")
+	}
+
+	var tests [][]int
+	switch scoring {
+	case "oob":
+	case "cv":
+		tests = CloudForest.StratifiedFolds(targetf, nFolds)
+	default:
+		log.Fatal("-score must be oob or cv.")
+	}
+	fmt.Printf("Searching %v configurations scored by %v %v on %v cores.\n", len(trials), scoring, metric, nCores)
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	var printing sync.Mutex
+	todo := make(chan *trial, len(trials))
+	for _, t := range trials {
+		todo <- t
+	}
+	close(todo)
+	finished := 0
+	for core := 0; core < nCores; core++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range todo {
+				t.Score, t.Err = score(data, *targetname, t.options(base, costmap), tests, metric, base.Positive)
+				printing.Lock()
+				finished++
+				fmt.Printf("Configuration %v/%v (mTry %v leafSize %v maxDepth %v nSamples %v impurity %v gbt %v): %v %v\n",
+					finished, len(trials), t.MTry, t.LeafSize, t.MaxDepth, t.NSamples, t.Impurity, t.GradBoost, metric, t.Score)
+				if t.Err != nil {
+					fmt.Printf("Error: %v\n", t.Err)
+				}
+				printing.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	fmt.Printf("Total search time (seconds): %v\n", time.Now().Sub(start).Seconds())
+
+	sort.Sort(byScore{trials, metrics.HigherIsBetter(metric)})
+
+	resultsfile, err := os.Create(*resultsfn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer resultsfile.Close()
+	fmt.Fprintf(resultsfile, "rank\t%v\tmTry\tleafSize\tmaxDepth\tnSamples\timpurity\tgbt\n", metric)
+	for i, t := range trials {
+		fmt.Fprintf(resultsfile, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n", i+1, t.Score, t.MTry, t.LeafSize, t.MaxDepth, t.NSamples, t.Impurity, t.GradBoost)
+	}
+
+	if math.IsNaN(trials[0].Score) {
+		log.Fatal("No configuration could be scored.")
+	}
+	best, err := json.MarshalIndent(trials[0].options(base, costmap), "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Best configuration (%v %v) written to %v:\n%s\n", metric, trials[0].Score, *bestfn, best)
+	bestfile, err := os.Create(*bestfn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer bestfile.Close()
+	fmt.Fprintf(bestfile, "%s\n", best)
+}
@@ -0,0 +1,60 @@
+package CloudForest
+
+import (
+	"fmt"
+)
+
+//UnsupervisedTarget is the name of the target feature added by FeatureMatrix.UnsupervisedCopy.
+const UnsupervisedTarget = "C:UNSUPERVISED"
+
+/*
+UnsupervisedCopy returns a feature matrix for Breiman's unsupervised random forest. It holds
+the cases of fm followed by as many synthetic cases, built from a ShuffledCopy of each feature
+so that every feature keeps its marginal distribution but the dependence between features is
+destroyed, and a categorical target named UnsupervisedTarget that is "real" for the cases of fm
+and "synthetic" for the others.
+
+A forest classifying real versus synthetic cases splits on the structure in the real cases and
+the proximity of the real cases (the first nCases of the copy, which have the same indexes as
+in fm) in it can be used for clustering. Synthetic cases are labeled synthetic_i.
+*/
+func (fm *FeatureMatrix) UnsupervisedCopy() (ufm *FeatureMatrix) {
+	nCases := fm.Data[0].Length()
+	ufm = &FeatureMatrix{make([]Feature, 0, len(fm.Data)+1), make(map[string]int), make([]string, 0, 2*nCases)}
+
+	for _, f := range fm.Data {
+		if f.GetName() == UnsupervisedTarget {
+			continue
+		}
+		realf := f.Copy()
+		synthetic := f.ShuffledCopy()
+		for i := 0; i < nCases; i++ {
+			realf.Append(synthetic.GetStr(i))
+		}
+		ufm.Map[realf.GetName()] = len(ufm.Data)
+		ufm.Data = append(ufm.Data, realf)
+	}
+
+	target := &DenseCatFeature{
+		&CatMap{make(map[string]int, 0),
+			make([]string, 0, 0)},
+		make([]int, 0, 2*nCases),
+		make([]bool, 0, 2*nCases),
+		UnsupervisedTarget,
+		false,
+		false}
+	for i := 0; i < nCases; i++ {
+		target.Append("real")
+	}
+	for i := 0; i < nCases; i++ {
+		target.Append("synthetic")
+	}
+	ufm.Map[UnsupervisedTarget] = len(ufm.Data)
+	ufm.Data = append(ufm.Data, target)
+
+	ufm.CaseLabels = append(ufm.CaseLabels, fm.CaseLabels...)
+	for i := 0; i < nCases; i++ {
+		ufm.CaseLabels = append(ufm.CaseLabels, fmt.Sprintf("synthetic_%v", i))
+	}
+	return
+}
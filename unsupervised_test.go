@@ -0,0 +1,50 @@
+package CloudForest
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnsupervisedCopy(t *testing.T) {
+	fm := ParseAFM(strings.NewReader(".\ta\tb\tc\tf\nN:x\t1\t2\tNA\t4\nC:y\tu\tv\tu\tw\n"))
+	ufm := fm.UnsupervisedCopy()
+
+	if len(ufm.Data) != 3 || len(ufm.CaseLabels) != 8 {
+		t.Fatalf("Unsupervised copy had %v features and %v cases.", len(ufm.Data), len(ufm.CaseLabels))
+	}
+	target := ufm.Data[ufm.Map[UnsupervisedTarget]]
+	for i := 0; i < 8; i++ {
+		want := "real"
+		if i >= 4 {
+			want = "synthetic"
+		}
+		if target.GetStr(i) != want {
+			t.Errorf("Case %v was %v not %v.", i, target.GetStr(i), want)
+		}
+	}
+
+	for _, name := range []string{"N:x", "C:y"} {
+		f := fm.Data[fm.Map[name]]
+		uf := ufm.Data[ufm.Map[name]]
+		if uf.Length() != 8 {
+			t.Errorf("Feature %v had length %v not 8.", name, uf.Length())
+		}
+		realCounts := make(map[string]int)
+		synthCounts := make(map[string]int)
+		for i := 0; i < 4; i++ {
+			if uf.GetStr(i) != f.GetStr(i) {
+				t.Errorf("Real case %v of %v was %v not %v.", i, name, uf.GetStr(i), f.GetStr(i))
+			}
+			realCounts[uf.GetStr(i)]++
+			synthCounts[uf.GetStr(i+4)]++
+		}
+		for v, n := range realCounts {
+			if synthCounts[v] != n {
+				t.Errorf("Synthetic %v had %v cases of %v not %v.", name, synthCounts[v], v, n)
+			}
+		}
+	}
+	if fm.Data[0].Length() != 4 {
+		t.Error("Unsupervised copy changed the original feature matrix.")
+	}
+}
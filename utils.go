@@ -107,6 +107,66 @@ func (sc *SparseCounter) WriteTsv(writer io.Writer) {
 
 }
 
+//AddRow increases the count in i,j by val for every j in js locking only once.
+func (sc *SparseCounter) AddRow(i int, js []int, val int) {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+	if sc.Map == nil {
+		sc.Map = make(map[int]map[int]int, 0)
+	}
+	row, ok := sc.Map[i]
+	if !ok || row == nil {
+		row = make(map[int]int, len(js))
+		sc.Map[i] = row
+	}
+	for _, j := range js {
+		row[j] += val
+	}
+}
+
+/*
+ShardedCounter is a SparseCounter split by row into shards that are locked separately so
+many threads can count at once. Row i is stored in Shards[i%len(Shards)].
+*/
+type ShardedCounter struct {
+	Shards []*SparseCounter
+}
+
+//NewShardedCounter returns a ShardedCounter with n shards.
+func NewShardedCounter(n int) *ShardedCounter {
+	if n < 1 {
+		n = 1
+	}
+	sc := &ShardedCounter{make([]*SparseCounter, 0, n)}
+	for i := 0; i < n; i++ {
+		sc.Shards = append(sc.Shards, new(SparseCounter))
+	}
+	return sc
+}
+
+//Add increases the count in i,j by val.
+func (sc *ShardedCounter) Add(i int, j int, val int) {
+	sc.Shards[i%len(sc.Shards)].Add(i, j, val)
+}
+
+//AddRow increases the count in i,j by val for every j in js.
+func (sc *ShardedCounter) AddRow(i int, js []int, val int) {
+	sc.Shards[i%len(sc.Shards)].AddRow(i, js, val)
+}
+
+//Row returns the non zero counts in row i. It should not be called while counts are being added.
+func (sc *ShardedCounter) Row(i int) map[int]int {
+	return sc.Shards[i%len(sc.Shards)].Map[i]
+}
+
+//WriteTsv writes the non zero counts of all shards out into a three column tsv containing
+//i, j, and count in the columns.
+func (sc *ShardedCounter) WriteTsv(writer io.Writer) {
+	for _, shard := range sc.Shards {
+		shard.WriteTsv(writer)
+	}
+}
+
 /*
 ParseAsIntOrFractionOfTotal parses strings that may specify an count or a percent of
 the total for use in specifying paramaters.
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"github.com/ryanbressler/CloudForest"
+	"io"
+	"log"
+	"os"
+)
+
+func main() {
+	infn := flag.String("in",
+		"", "Forest to convert in .sf or binary format (detected from the file).")
+	outfn := flag.String("out",
+		"", "The name of a file to write the converted forest to.")
+	format := flag.String("format",
+		"", "Format to write: binary or sf. Defaults to the format the input isn't in.")
+
+	flag.Parse()
+
+	infile, err := os.Open(*infn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer infile.Close()
+	r := bufio.NewReader(infile)
+	magic, _ := r.Peek(len(CloudForest.BinaryForestMagic))
+	binary := string(magic) == CloudForest.BinaryForestMagic
+
+	if *format == "" {
+		*format = "binary"
+		if binary {
+			*format = "sf"
+		}
+	}
+	if *format != "binary" && *format != "sf" {
+		log.Fatal("-format must be binary or sf.")
+	}
+
+	outfile, err := os.Create(*outfn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer outfile.Close()
+
+	var read func() (*CloudForest.Forest, error)
+	if binary {
+		read = CloudForest.NewBinaryForestReader(r).ReadForest
+	} else {
+		read = CloudForest.NewForestReader(r).ReadForest
+	}
+	binarywriter := CloudForest.NewBinaryForestWriter(outfile)
+	sfwriter := CloudForest.NewForestWriter(outfile)
+
+	nForests, nTrees := 0, 0
+	for {
+		forest, err := read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *format == "binary" {
+			err = binarywriter.WriteForest(forest)
+		} else {
+			if nForests > 0 || forest.Intercept != 0.0 || forest.Metadata != nil {
+				sfwriter.WriteForestHeader(nForests, forest.Target, forest.Intercept)
+			}
+			if forest.Metadata != nil {
+				sfwriter.WriteMetadata(forest.Metadata)
+			}
+			for i, tree := range forest.Trees {
+				sfwriter.WriteTree(tree, i)
+			}
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		nForests++
+		nTrees += len(forest.Trees)
+	}
+	fmt.Printf("Wrote %v forests with %v trees to %v in %v format.\n", nForests, nTrees, *outfn, *format)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"github.com/ryanbressler/CloudForest"
+	"io"
+	"log"
+	"os"
+)
+
+func main() {
+	fm := flag.String("fm",
+		"featurematrix.afm", "AFM formated feature matrix containing data.")
+
+	outfn := flag.String("out",
+		"imputed.afm", "The name of a file to write the imputed feature matrix too.")
+
+	reportfn := flag.String("report",
+		"", "File to write a tsv of the out of bag error of the forest used to impute each feature.")
+
+	blacklist := flag.String("blacklist",
+		"", "A list of feature id's to exclude from the set of predictors and leave unimputed.")
+
+	var nTrees int
+	flag.IntVar(&nTrees, "nTrees", 100, "Number of trees to grow to impute each feature.")
+
+	var maxIter int
+	flag.IntVar(&maxIter, "maxIter", 10, "Maximum number of iterations.")
+
+	flag.Parse()
+
+	//Parse Data
+	data, err := CloudForest.LoadAFM(*fm)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	blacklisted := 0
+	blacklistis := make([]bool, len(data.Data))
+	if *blacklist != "" {
+		fmt.Printf("Loading blacklist from: %v\n", *blacklist)
+		blackfile, err := os.Open(*blacklist)
+		if err != nil {
+			log.Fatal(err)
+		}
+		tsv := csv.NewReader(blackfile)
+		tsv.Comma = '\t'
+		for {
+			id, err := tsv.Read()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				log.Fatal(err)
+			}
+			i, ok := data.Map[id[0]]
+			if !ok {
+				fmt.Printf("Ignoring blacklist feature not found in data: %v\n", id[0])
+				continue
+			}
+			if !blacklistis[i] {
+				blacklisted += 1
+				blacklistis[i] = true
+			}
+
+		}
+		blackfile.Close()
+		fmt.Printf("Excluding %v blacklisted features from imputation.\n", blacklisted)
+	}
+
+	fmt.Printf("Imputing missing values using up to %v iterations of %v trees per feature.\n", maxIter, nTrees)
+	errs := data.ImputeByForest(nTrees, maxIter, blacklistis)
+	fmt.Printf("Imputed %v features.\n", len(errs))
+
+	ncases := data.Data[0].Length()
+	cases := make([]int, ncases, ncases)
+	for i := 0; i < ncases; i++ {
+		cases[i] = i
+	}
+
+	outfile, err := os.Create(*outfn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer outfile.Close()
+	err = data.WriteCases(outfile, cases)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *reportfn != "" {
+		reportfile, err := os.Create(*reportfn)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer reportfile.Close()
+		for _, e := range errs {
+			fmt.Fprintf(reportfile, "%v\t%v\t%v\n", e.Feature, e.NMissing, e.Error)
+		}
+	}
+
+}
@@ -72,12 +72,24 @@ func main() {
 	var folds int
 	flag.IntVar(&folds, "folds", 5, "Number of folds to generate.")
 
+	var groupby string
+	flag.StringVar(&groupby, "groupby", "", "Keep all cases with the same value of this feature in the same fold.")
+
+	var timeseries string
+	flag.StringVar(&timeseries, "timeseries", "", "Generate forward chaining folds ordered by this numerical feature (each fold trains on earlier cases only).")
+
 	var maxcats int
 	flag.IntVar(&maxcats, "maxcats", -1, "Maximum number of categories to allow in a feature.")
 
 	var impute bool
 	flag.BoolVar(&impute, "impute", false, "Impute missing values to feature mean/mode.")
 
+	var proxImpute int
+	flag.IntVar(&proxImpute, "proximpute", 0, "Impute missing values using n iterations of forest proximity weighted imputation (rfImpute). Requires a target.")
+
+	var nTrees int
+	flag.IntVar(&nTrees, "nTrees", 100, "Number of trees to grow in each iteration of proximity imputation.")
+
 	var onehot bool
 	flag.BoolVar(&onehot, "onehot", false, "Do one hot encoding of categorical features to boolean true false.")
 
@@ -145,6 +157,14 @@ func main() {
 		data.ImputeMissing()
 	}
 
+	if proxImpute > 0 {
+		fmt.Printf("Imputing missing values using proximities from %v iterations of %v trees.\n", proxImpute, nTrees)
+		err = data.ImputeByProximityTrees(*targetname, nTrees, proxImpute)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	if onehot {
 		fmt.Println("OneHot encoding.")
 		data.OneHot()
@@ -181,7 +201,40 @@ func main() {
 			unstratified = true
 		}
 	}
-	if unstratified {
+
+	//Grouped and time series folds leave out cases missing the target.
+	labeled := make([]int, 0, len(data.CaseLabels))
+	for i := range data.CaseLabels {
+		if targetf == nil || !targetf.IsMissing(i) {
+			labeled = append(labeled, i)
+		}
+	}
+
+	var ordered []*CloudForest.CVFold
+	switch {
+	case timeseries != "":
+		orderi, ok := data.Map[timeseries]
+		if !ok {
+			log.Fatal("Time series ordering feature not found in data.")
+		}
+		fmt.Printf("Generating forward chaining folds ordered by %v.\n", timeseries)
+		ordered, err = CloudForest.TimeSeriesFolds(data.Data[orderi], labeled, folds)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for i, fold := range ordered {
+			foldis[i] = fold.Test
+		}
+
+	case groupby != "":
+		groupi, ok := data.Map[groupby]
+		if !ok {
+			log.Fatal("Groupby feature not found in data.")
+		}
+		fmt.Printf("Grouping cases by %v.\n", groupby)
+		foldis = CloudForest.GroupedFolds(data.Data[groupi], labeled, folds)
+
+	case unstratified:
 		ncases := len(data.CaseLabels)
 		cases := make([]int, ncases, ncases)
 		for i := 0; i < ncases; i++ {
@@ -194,7 +247,7 @@ func main() {
 			}
 		}
 
-	} else {
+	default:
 		//sample folds stratified by case
 		fmt.Printf("Stratifying by %v classes.\n", targetf.(*CloudForest.DenseCatFeature).NCats())
 		bSampler := CloudForest.NewBalancedSampler(targetf.(*CloudForest.DenseCatFeature))
@@ -236,7 +289,10 @@ func main() {
 		testfn := fmt.Sprintf(*test, i)
 
 		trainis = trainis[0:0]
-		for j := 0; j < folds; j++ {
+		if ordered != nil {
+			trainis = append(trainis, ordered[i].Train...)
+		}
+		for j := 0; j < folds && ordered == nil; j++ {
 			if i != j {
 				trainis = append(trainis, foldis[j]...)
 			}
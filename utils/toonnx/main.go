@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/ryanbressler/CloudForest"
+	"log"
+	"os"
+)
+
+func main() {
+	rf := flag.String("rfpred",
+		"rface.sf", "A predictor forest in .sf or binary format.")
+	fm := flag.String("fm",
+		"", "AFM formated feature matrix to describe the features and categories from if the forest has no metadata.")
+	outfn := flag.String("out",
+		"forest.onnx", "The name of a file to write the ONNX model to.")
+	method := flag.String("method",
+		"", "How trees are combined: vote, average, sum or expit. Inferred from the target, intercept and metadata if empty.")
+
+	flag.Parse()
+
+	forest, err := CloudForest.LoadForest(*rf)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var meta *CloudForest.ForestMetadata
+	if *fm != "" {
+		data, err := CloudForest.LoadAFM(*fm)
+		if err != nil {
+			log.Fatal(err)
+		}
+		targeti, ok := data.Map[forest.Target]
+		if !ok {
+			targeti = -1
+		}
+		candidates := make([]int, 0, len(data.Data))
+		for i := range data.Data {
+			if i != targeti {
+				candidates = append(candidates, i)
+			}
+		}
+		meta = CloudForest.NewForestMetadata(data, targeti, candidates, nil)
+	}
+
+	outfile, err := os.Create(*outfn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer outfile.Close()
+	if err = CloudForest.WriteONNX(outfile, forest, meta, *method); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Wrote %v trees to %v as ONNX.\n", len(forest.Trees), *outfn)
+}
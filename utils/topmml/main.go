@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/ryanbressler/CloudForest"
+	"log"
+	"os"
+)
+
+func main() {
+	rf := flag.String("rfpred",
+		"rface.sf", "A predictor forest in .sf or binary format.")
+	fm := flag.String("fm",
+		"", "AFM formated feature matrix to describe the features and categories from if the forest has no metadata.")
+	outfn := flag.String("out",
+		"forest.pmml", "The name of a file to write the PMML to.")
+	method := flag.String("method",
+		"", "How trees are combined: vote, average or sum. Inferred from the target and intercept if empty.")
+
+	flag.Parse()
+
+	forest, err := CloudForest.LoadForest(*rf)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var meta *CloudForest.ForestMetadata
+	if *fm != "" {
+		data, err := CloudForest.LoadAFM(*fm)
+		if err != nil {
+			log.Fatal(err)
+		}
+		targeti, ok := data.Map[forest.Target]
+		if !ok {
+			targeti = -1
+		}
+		candidates := make([]int, 0, len(data.Data))
+		for i := range data.Data {
+			if i != targeti {
+				candidates = append(candidates, i)
+			}
+		}
+		meta = CloudForest.NewForestMetadata(data, targeti, candidates, nil)
+	}
+
+	outfile, err := os.Create(*outfn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer outfile.Close()
+	if err = CloudForest.WritePMML(outfile, forest, meta, *method); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Wrote %v trees to %v as PMML.\n", len(forest.Trees), *outfn)
+}